@@ -0,0 +1,101 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// armCode converts the addresses of the ARM BL instruction. The
+// instructions are 4-byte aligned and the branch offset is relative to
+// the instruction address plus 8.
+func armCode(pos uint32, encoder bool, p []byte) int {
+	n := len(p) &^ 3
+	for i := 0; i < n; i += 4 {
+		if p[i+3] != 0xeb {
+			continue
+		}
+		src := uint32(p[i+2])<<16 | uint32(p[i+1])<<8 | uint32(p[i])
+		src <<= 2
+		var dest uint32
+		if encoder {
+			dest = pos + uint32(i) + 8 + src
+		} else {
+			dest = src - (pos + uint32(i) + 8)
+		}
+		dest >>= 2
+		p[i+2] = byte(dest >> 16)
+		p[i+1] = byte(dest >> 8)
+		p[i] = byte(dest)
+	}
+	return n
+}
+
+// armThumbCode converts the addresses of the ARM-Thumb BL instruction
+// pair. The instructions are 2-byte aligned.
+func armThumbCode(pos uint32, encoder bool, p []byte) int {
+	if len(p) < 4 {
+		return 0
+	}
+	limit := len(p) - 4
+	i := 0
+	for ; i <= limit; i += 2 {
+		if p[i+1]&0xf8 != 0xf0 || p[i+3]&0xf8 != 0xf8 {
+			continue
+		}
+		src := (uint32(p[i+1])&7)<<19 | uint32(p[i])<<11 |
+			(uint32(p[i+3])&7)<<8 | uint32(p[i+2])
+		src <<= 1
+		var dest uint32
+		if encoder {
+			dest = pos + uint32(i) + 4 + src
+		} else {
+			dest = src - (pos + uint32(i) + 4)
+		}
+		dest >>= 1
+		p[i+1] = 0xf0 | byte((dest>>19)&7)
+		p[i] = byte(dest >> 11)
+		p[i+3] = 0xf8 | byte((dest>>8)&7)
+		p[i+2] = byte(dest)
+		i += 2
+	}
+	return i
+}
+
+// arm64Code converts the addresses of the ARM64 BL and ADRP
+// instructions. ADRP instructions are only converted if the address is
+// in the range of +/-512 MiB, because larger values would reduce the
+// compression ratio.
+func arm64Code(pos uint32, encoder bool, p []byte) int {
+	n := len(p) &^ 3
+	for i := 0; i < n; i += 4 {
+		pc := pos + uint32(i)
+		instr := uint32LE(p[i:])
+		switch {
+		case instr>>26 == 0x25:
+			// BL instruction
+			src := instr
+			pc >>= 2
+			if !encoder {
+				pc = -pc
+			}
+			instr = 0x94000000 | (src+pc)&0x03ffffff
+			putUint32LE(p[i:], instr)
+		case instr&0x9f000000 == 0x90000000:
+			// ADRP instruction
+			src := (instr>>29)&3 | (instr>>3)&0x001ffffc
+			if (src+0x00020000)&0x001c0000 != 0 {
+				continue
+			}
+			instr &= 0x9000001f
+			pc >>= 12
+			if !encoder {
+				pc = -pc
+			}
+			dest := src + pc
+			instr |= (dest & 3) << 29
+			instr |= (dest & 0x0003fffc) << 3
+			instr |= (-(dest & 0x00020000)) & 0x00e00000
+			putUint32LE(p[i:], instr)
+		}
+	}
+	return n
+}
@@ -0,0 +1,343 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BCJ identifies a branch/call/jump (BCJ) converter filter. BCJ filters
+// convert relative branch addresses in executable code into absolute
+// addresses, which improves the compression of executables. The value
+// of a BCJ constant is the ID of the filter in the xz format.
+type BCJ byte
+
+// Supported BCJ filters.
+const (
+	// NoBCJ requests no BCJ filter.
+	NoBCJ BCJ = 0x00
+	// X86 is the BCJ filter for x86 and x86-64 code.
+	X86 BCJ = 0x04
+	// PowerPC is the BCJ filter for big-endian PowerPC code.
+	PowerPC BCJ = 0x05
+	// IA64 is the BCJ filter for Itanium code.
+	IA64 BCJ = 0x06
+	// ARM is the BCJ filter for 32-bit ARM code.
+	ARM BCJ = 0x07
+	// ARMThumb is the BCJ filter for ARM-Thumb code.
+	ARMThumb BCJ = 0x08
+	// SPARC is the BCJ filter for SPARC code.
+	SPARC BCJ = 0x09
+	// ARM64 is the BCJ filter for ARM64 code.
+	ARM64 BCJ = 0x0a
+	// RISCV is the BCJ filter for RISC-V code.
+	RISCV BCJ = 0x0b
+)
+
+// bcjStrings maps BCJ values to their names.
+var bcjStrings = map[BCJ]string{
+	NoBCJ:    "none",
+	X86:      "x86",
+	PowerPC:  "powerpc",
+	IA64:     "ia64",
+	ARM:      "arm",
+	ARMThumb: "armthumb",
+	SPARC:    "sparc",
+	ARM64:    "arm64",
+	RISCV:    "riscv",
+}
+
+// String returns the name of the BCJ filter.
+func (b BCJ) String() string {
+	s, ok := bcjStrings[b]
+	if !ok {
+		return "unknown"
+	}
+	return s
+}
+
+// bcjAlignment provides the alignment of the instructions for each BCJ
+// filter. The start offset must be a multiple of it.
+var bcjAlignment = map[BCJ]uint32{
+	X86:      1,
+	PowerPC:  4,
+	IA64:     16,
+	ARM:      4,
+	ARMThumb: 2,
+	SPARC:    4,
+	ARM64:    4,
+	RISCV:    2,
+}
+
+// verifyBCJ checks whether the BCJ filter is supported and whether the
+// start offset is correctly aligned.
+func verifyBCJ(b BCJ, startOffset uint32) error {
+	a, ok := bcjAlignment[b]
+	if !ok {
+		return errors.New("xz: unsupported BCJ filter")
+	}
+	if startOffset%a != 0 {
+		return fmt.Errorf("xz: start offset for %s filter must be "+
+			"a multiple of %d", b, a)
+	}
+	return nil
+}
+
+// BCJFilter declares a BCJ filter stored in an xz block header.
+type BCJFilter struct {
+	BCJ BCJ
+	// start offset of the data in the executable; must be a
+	// multiple of the instruction alignment
+	StartOffset uint32
+}
+
+// String returns a representation of the BCJ filter.
+func (f BCJFilter) String() string {
+	if f.StartOffset == 0 {
+		return fmt.Sprintf("BCJ %s", f.BCJ)
+	}
+	return fmt.Sprintf("BCJ %s start offset %#x", f.BCJ, f.StartOffset)
+}
+
+// ID returns the ID for the BCJ filter.
+func (f BCJFilter) ID() uint64 { return uint64(f.BCJ) }
+
+// MarshalBinary converts the BCJFilter in its encoded representation.
+// The start offset is only written if it is not zero.
+func (f BCJFilter) MarshalBinary() (data []byte, err error) {
+	if err = verifyBCJ(f.BCJ, f.StartOffset); err != nil {
+		return nil, err
+	}
+	if f.StartOffset == 0 {
+		return []byte{byte(f.BCJ), 0}, nil
+	}
+	data = []byte{byte(f.BCJ), 4, 0, 0, 0, 0}
+	putUint32LE(data[2:], f.StartOffset)
+	return data, nil
+}
+
+// UnmarshalBinary unmarshals the given data representation of the BCJ
+// filter.
+func (f *BCJFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return errors.New("xz: data for BCJ filter has wrong length")
+	}
+	b := BCJ(data[0])
+	if _, ok := bcjAlignment[b]; !ok {
+		return errors.New("xz: wrong BCJ filter id")
+	}
+	var startOffset uint32
+	switch data[1] {
+	case 0:
+		if len(data) != 2 {
+			return errors.New(
+				"xz: data for BCJ filter has wrong length")
+		}
+	case 4:
+		if len(data) != 6 {
+			return errors.New(
+				"xz: data for BCJ filter has wrong length")
+		}
+		startOffset = uint32LE(data[2:])
+	default:
+		return errors.New("xz: wrong BCJ filter size")
+	}
+	f.BCJ = b
+	f.StartOffset = startOffset
+	return nil
+}
+
+// Reader creates a new reader for the BCJ filter.
+func (f BCJFilter) Reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
+	err error) {
+
+	conv, err := newBCJConverter(f.BCJ, f.StartOffset, false)
+	if err != nil {
+		return nil, err
+	}
+	return &bcjReader{r: r, conv: conv}, nil
+}
+
+// WriteCloser creates a io.WriteCloser for the BCJ filter.
+func (f BCJFilter) WriteCloser(w io.WriteCloser, c *WriterConfig,
+) (fw io.WriteCloser, err error) {
+	if err = verifyBCJ(f.BCJ, f.StartOffset); err != nil {
+		return nil, err
+	}
+	conv, err := newBCJConverter(f.BCJ, f.StartOffset, true)
+	if err != nil {
+		return nil, err
+	}
+	return &bcjWriter{w: w, conv: conv}, nil
+}
+
+// Last returns false, because a BCJ filter cannot be the last filter in
+// the filter list.
+func (f BCJFilter) Last() bool { return false }
+
+// bcjConverter converts the branch instructions of a specific
+// architecture. The converter tracks the position of the data in the
+// uncompressed stream.
+type bcjConverter interface {
+	// convert converts the data in p and returns the number of
+	// bytes that have been processed. The remaining bytes must be
+	// provided again at the start of the slice for the next call.
+	convert(p []byte) int
+	// reset moves the converter back to the start offset.
+	reset()
+}
+
+// newBCJConverter creates the converter for the given BCJ filter. The
+// encoder flag selects whether the converter encodes or decodes.
+func newBCJConverter(b BCJ, startOffset uint32, encoder bool,
+) (conv bcjConverter, err error) {
+	var code func(pos uint32, encoder bool, p []byte) int
+	switch b {
+	case X86:
+		return newX86Converter(startOffset, encoder), nil
+	case PowerPC:
+		code = powerPCCode
+	case IA64:
+		code = ia64Code
+	case ARM:
+		code = armCode
+	case ARMThumb:
+		code = armThumbCode
+	case SPARC:
+		code = sparcCode
+	case ARM64:
+		code = arm64Code
+	case RISCV:
+		code = riscvCode
+	default:
+		return nil, errors.New("xz: unsupported BCJ filter")
+	}
+	return &simpleConverter{start: startOffset, pos: startOffset,
+		encoder: encoder, code: code}, nil
+}
+
+// simpleConverter supports the BCJ filters that don't need to keep
+// state besides the position in the stream.
+type simpleConverter struct {
+	start   uint32
+	pos     uint32
+	encoder bool
+	// code converts the data in p located at position pos and
+	// returns the number of bytes processed.
+	code func(pos uint32, encoder bool, p []byte) int
+}
+
+// convert converts the data in p and advances the position.
+func (c *simpleConverter) convert(p []byte) int {
+	n := c.code(c.pos, c.encoder, p)
+	c.pos += uint32(n)
+	return n
+}
+
+// reset moves the converter back to the start offset.
+func (c *simpleConverter) reset() {
+	c.pos = c.start
+}
+
+// bcjBufSize defines the size of the buffers used by the BCJ reader and
+// writer.
+const bcjBufSize = 4096
+
+// bcjReader decodes the data read from the underlying reader.
+type bcjReader struct {
+	r    io.Reader
+	conv bcjConverter
+	buf  [bcjBufSize]byte
+	// buf[start:mid] contains converted and buf[mid:end]
+	// unconverted data.
+	start, mid, end int
+	err             error
+}
+
+// Read reads data from the underlying reader and converts the branch
+// instructions. The bytes at the end of the stream that cannot be
+// converted are returned as they are.
+func (br *bcjReader) Read(p []byte) (n int, err error) {
+	for {
+		if br.start < br.mid {
+			n = copy(p, br.buf[br.start:br.mid])
+			br.start += n
+			return n, nil
+		}
+		if br.err != nil {
+			if br.start < br.end {
+				// The tail of the stream cannot be converted.
+				br.mid = br.end
+				continue
+			}
+			return 0, br.err
+		}
+		br.end = copy(br.buf[:], br.buf[br.start:br.end])
+		br.start = 0
+		var k int
+		k, br.err = br.r.Read(br.buf[br.end:])
+		br.end += k
+		br.mid = br.conv.convert(br.buf[:br.end])
+	}
+}
+
+// Reset resets the converter and reads the data to decode from r.
+func (br *bcjReader) Reset(r io.Reader) error {
+	br.r = r
+	br.conv.reset()
+	br.start, br.mid, br.end = 0, 0, 0
+	br.err = nil
+	return nil
+}
+
+// bcjWriter converts the data written into it and writes the result
+// into the underlying WriteCloser.
+type bcjWriter struct {
+	w    io.WriteCloser
+	conv bcjConverter
+	buf  [bcjBufSize]byte
+	// number of unconverted bytes in the buffer
+	n int
+}
+
+// Write converts the data and writes it to the underlying writer.
+func (bw *bcjWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		k := copy(bw.buf[bw.n:], p[n:])
+		bw.n += k
+		n += k
+		c := bw.conv.convert(bw.buf[:bw.n])
+		if _, err = bw.w.Write(bw.buf[:c]); err != nil {
+			return n, err
+		}
+		bw.n = copy(bw.buf[:], bw.buf[c:bw.n])
+	}
+	return n, nil
+}
+
+// Close writes the bytes that couldn't be converted unchanged and
+// closes the underlying WriteCloser.
+func (bw *bcjWriter) Close() error {
+	if _, err := bw.w.Write(bw.buf[:bw.n]); err != nil {
+		return err
+	}
+	bw.n = 0
+	return bw.w.Close()
+}
+
+// Reset resets the converter and writes the converted data to w, which
+// must be an io.WriteCloser.
+func (bw *bcjWriter) Reset(w io.Writer) error {
+	wc, ok := w.(io.WriteCloser)
+	if !ok {
+		return errors.New("xz: BCJ writer requires an io.WriteCloser")
+	}
+	bw.w = wc
+	bw.conv.reset()
+	bw.n = 0
+	return nil
+}
@@ -0,0 +1,329 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+// x86TestData generates the data compressed in testdata/x86.xz and
+// testdata/x86-start.xz. It mixes random bytes with CALL and JMP
+// instructions with relative addresses.
+func x86TestData() []byte {
+	r := rand.New(rand.NewSource(7))
+	p := make([]byte, 0, 1<<13)
+	for len(p) < 1<<13-16 {
+		switch r.Intn(4) {
+		case 0:
+			rel := uint32(int32(r.Intn(1<<17) - 1<<16))
+			p = append(p, 0xe8|byte(r.Intn(2)), byte(rel),
+				byte(rel>>8), byte(rel>>16), byte(rel>>24))
+		default:
+			p = append(p, byte(r.Intn(256)))
+		}
+	}
+	return p
+}
+
+// bcjTestData generates test data for a BCJ filter. It mixes random
+// bytes with instructions generated by instr. All chunks are multiples
+// of the given alignment.
+func bcjTestData(seed int64, align int, instr func(r *rand.Rand) []byte,
+) []byte {
+	r := rand.New(rand.NewSource(seed))
+	p := make([]byte, 0, 1<<12+64)
+	for len(p) < 1<<12 {
+		if r.Intn(4) == 0 {
+			p = append(p, instr(r)...)
+			continue
+		}
+		for i := 0; i < align; i++ {
+			p = append(p, byte(r.Intn(256)))
+		}
+	}
+	return p
+}
+
+// le32 returns the little-endian representation of x.
+func le32(x uint32) []byte {
+	p := make([]byte, 4)
+	putUint32LE(p, x)
+	return p
+}
+
+// be32 returns the big-endian representation of x.
+func be32(x uint32) []byte {
+	p := make([]byte, 4)
+	putUint32BE(p, x)
+	return p
+}
+
+func powerPCTestData() []byte {
+	return bcjTestData(5, 4, func(r *rand.Rand) []byte {
+		return be32(0x48000001 | r.Uint32()&0x03fffffc)
+	})
+}
+
+// ia64SetBits sets n bits at bit position pos in the little-endian
+// bit sequence p.
+func ia64SetBits(p []byte, pos, n uint, x uint64) {
+	for i := uint(0); i < n; i++ {
+		j := pos + i
+		p[j>>3] &^= 1 << (j & 7)
+		p[j>>3] |= byte((x>>i)&1) << (j & 7)
+	}
+}
+
+func ia64TestData() []byte {
+	return bcjTestData(6, 16, func(r *rand.Rand) []byte {
+		p := make([]byte, 16)
+		r.Read(p)
+		templates := []byte{0x10, 0x12, 0x16, 0x17, 0x1c}
+		p[0] = p[0]&^0x1f | templates[r.Intn(len(templates))]
+		for slot := uint(0); slot < 3; slot++ {
+			if r.Intn(2) == 0 {
+				continue
+			}
+			pos := 5 + 41*slot
+			// opcode
+			ia64SetBits(p, pos+37, 4, 5)
+			ia64SetBits(p, pos+9, 3, 0)
+		}
+		return p
+	})
+}
+
+func armTestData() []byte {
+	return bcjTestData(8, 4, func(r *rand.Rand) []byte {
+		return le32(0xeb000000 | r.Uint32()&0x00ffffff)
+	})
+}
+
+func armThumbTestData() []byte {
+	return bcjTestData(9, 2, func(r *rand.Rand) []byte {
+		return []byte{byte(r.Intn(256)), 0xf0 | byte(r.Intn(8)),
+			byte(r.Intn(256)), 0xf8 | byte(r.Intn(8))}
+	})
+}
+
+func sparcTestData() []byte {
+	return bcjTestData(10, 4, func(r *rand.Rand) []byte {
+		if r.Intn(2) == 0 {
+			return be32(0x40000000 | r.Uint32()&0x003fffff)
+		}
+		return be32(0x7fc00000 | r.Uint32()&0x003fffff)
+	})
+}
+
+func arm64TestData() []byte {
+	return bcjTestData(11, 4, func(r *rand.Rand) []byte {
+		switch r.Intn(3) {
+		case 0:
+			// BL
+			return le32(0x94000000 | r.Uint32()&0x03ffffff)
+		case 1:
+			// ADRP with an address in the +/-512 MiB range
+			src := uint32(r.Intn(1<<18) - 1<<17)
+			return le32(0x90000000 | (src&3)<<29 |
+				(src>>2&0x7ffff)<<5 | uint32(r.Intn(32)))
+		default:
+			// ADRP with an arbitrary address
+			return le32(0x90000000 | r.Uint32()&0x60ffffff)
+		}
+	})
+}
+
+func riscvTestData() []byte {
+	return bcjTestData(12, 2, func(r *rand.Rand) []byte {
+		switch r.Intn(4) {
+		case 0:
+			// JAL
+			return []byte{0xef, byte(r.Intn(256)) &^ 0x0d,
+				byte(r.Intn(256)), byte(r.Intn(256))}
+		case 1:
+			// AUIPC with a following instruction using rd
+			rd := uint32(1 + r.Intn(31))
+			if rd == 2 {
+				rd = 3
+			}
+			auipc := r.Uint32()&0xfffff000 | rd<<7 | 0x17
+			inst2 := r.Uint32()&0xfff07ffc | rd<<15 | 3
+			return append(le32(auipc), le32(inst2)...)
+		case 2:
+			// AUIPC with rd x0 or x2
+			rd := uint32(2 * r.Intn(2))
+			auipc := r.Uint32()&0xfffff000 | rd<<7 | 0x17
+			return append(le32(auipc), le32(r.Uint32())...)
+		default:
+			// AUIPC not followed by a matching instruction
+			return le32(r.Uint32()&0xfffff000 | 5<<7 | 0x17)
+		}
+	})
+}
+
+// bcjTest describes the test vectors for a BCJ filter. The SHA-256
+// checksum for the encoded data has been computed with xz-utils.
+type bcjTest struct {
+	file        string
+	bcj         BCJ
+	startOffset uint32
+	data        func() []byte
+	encodedSum  string
+}
+
+var bcjTests = []bcjTest{
+	{"testdata/x86.xz", X86, 0, x86TestData,
+		"bae9ece736dcb83f805c23d9a1d295649cf8511e9ccfe8aa54a911c711d614a7"},
+	{"testdata/x86-start.xz", X86, 0x1000, x86TestData,
+		"8e6cfaca32523ff5cd92f7e2767088cb9139b02db3d537209868a898e4fb34d6"},
+	{"testdata/powerpc.xz", PowerPC, 0, powerPCTestData,
+		"6c760ad660c7102c04cfff81b19ab19af9e5c6230d2c61f50fc39ae444edbaf3"},
+	{"testdata/ia64.xz", IA64, 0, ia64TestData,
+		"5108018c1a6e6c84f51ba4f660f66123dc37ce15bf52cc5dd4fe752aca1b1d9d"},
+	{"testdata/arm.xz", ARM, 0, armTestData,
+		"78c2294b53f84d62475bfdcd91264b63dc12d5ed857ff260ef5c926eabe92771"},
+	{"testdata/armthumb.xz", ARMThumb, 0, armThumbTestData,
+		"28192cd8291656086c70c58f85d425f1f3d582728b8e39d1fe27809f30ab7da5"},
+	{"testdata/sparc.xz", SPARC, 0, sparcTestData,
+		"4c5bbed403daeeca060fccec5f815db127545c7e34a12eb00c247c99368248fd"},
+	{"testdata/arm64.xz", ARM64, 0, arm64TestData,
+		"4dca1fd06167568ad15316055d14dde71345dc5526e3178d3896598a20f41940"},
+	{"testdata/riscv.xz", RISCV, 0, riscvTestData,
+		"d6e604f41f1fe0d0538854be0827021c0595760742cf841db1eb7235204fef7c"},
+	{"testdata/riscv-start.xz", RISCV, 0x1000, riscvTestData,
+		"cffc186b3d70327f7e93538cd47a27de451af767851fdabd475bd115273f4a53"},
+}
+
+func TestBCJFilterMarshalling(t *testing.T) {
+	for _, f := range []BCJFilter{{X86, 0}, {X86, 0x1000}, {ARM, 0x40},
+		{RISCV, 0x1002}} {
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary error %s", err)
+		}
+		var g BCJFilter
+		if err = g.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary error %s", err)
+		}
+		if g != f {
+			t.Fatalf("unmarshalled %#v; want %#v", g, f)
+		}
+	}
+}
+
+// chunkWrite writes the data in chunks of the given sizes.
+func chunkWrite(w io.Writer, p []byte, sizes []int) error {
+	for i := 0; len(p) > 0; i++ {
+		n := sizes[i%len(sizes)]
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+func TestBCJEncoding(t *testing.T) {
+	chunkSizes := [][]int{{1 << 20}, {1}, {3, 7, 4096, 5}}
+	for _, c := range bcjTests {
+		data := c.data()
+		for _, sizes := range chunkSizes {
+			f := BCJFilter{c.bcj, c.startOffset}
+			var buf bytes.Buffer
+			w, err := f.WriteCloser(nopWriteCloser(&buf), nil)
+			if err != nil {
+				t.Fatalf("writeCloser error %s", err)
+			}
+			if err = chunkWrite(w, data, sizes); err != nil {
+				t.Fatalf("chunkWrite error %s", err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("w.Close error %s", err)
+			}
+			sum := fmt.Sprintf("%x", sha256.Sum256(buf.Bytes()))
+			if sum != c.encodedSum {
+				t.Fatalf("%s chunks %v: encoded sum %s; want %s",
+					f, sizes, sum, c.encodedSum)
+			}
+
+			r, err := f.Reader(iotest.OneByteReader(&buf), nil)
+			if err != nil {
+				t.Fatalf("reader error %s", err)
+			}
+			decoded, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("io.ReadAll error %s", err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Fatalf("%s: decoded data differs from original",
+					f)
+			}
+		}
+	}
+}
+
+func TestReaderBCJ(t *testing.T) {
+	for _, c := range bcjTests {
+		f, err := os.Open(c.file)
+		if err != nil {
+			t.Fatalf("os.Open(%q) error %s", c.file, err)
+		}
+		r, err := NewReader(f)
+		if err != nil {
+			f.Close()
+			t.Fatalf("NewReader error %s", err)
+		}
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		f.Close()
+		if err != nil {
+			t.Fatalf("io.Copy error %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), c.data()) {
+			t.Fatalf("%s: decompressed data differs from original",
+				c.file)
+		}
+	}
+}
+
+func TestWriterBCJ(t *testing.T) {
+	for _, c := range bcjTests {
+		data := c.data()
+		var buf bytes.Buffer
+		cfg := WriterConfig{BCJ: c.bcj, BCJStartOffset: c.startOffset}
+		w, err := cfg.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write(data); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		var out bytes.Buffer
+		if _, err = io.Copy(&out, r); err != nil {
+			t.Fatalf("io.Copy error %s", err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("%s: decompressed data differs from original",
+				c.bcj)
+		}
+	}
+}
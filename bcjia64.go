@@ -0,0 +1,59 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// ia64BranchTable provides for each bundle template a mask of the
+// instruction slots that may contain a branch instruction.
+var ia64BranchTable = [32]uint32{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	4, 4, 6, 6, 0, 0, 7, 7,
+	4, 4, 0, 0, 4, 4, 0, 0,
+}
+
+// ia64Code converts the addresses of the IA-64 branch instructions. The
+// code consists of 16-byte bundles containing three 41-bit instruction
+// slots.
+func ia64Code(pos uint32, encoder bool, p []byte) int {
+	i := 0
+	for ; i+16 <= len(p); i += 16 {
+		mask := ia64BranchTable[p[i]&0x1f]
+		bitPos := uint32(5)
+		for slot := 0; slot < 3; slot, bitPos = slot+1, bitPos+41 {
+			if (mask>>uint(slot))&1 == 0 {
+				continue
+			}
+			bytePos := i + int(bitPos>>3)
+			bitRes := bitPos & 7
+			var instr uint64
+			for j := 0; j < 6; j++ {
+				instr |= uint64(p[bytePos+j]) << (8 * uint(j))
+			}
+			norm := instr >> bitRes
+			if (norm>>37)&0xf != 0x5 || (norm>>9)&0x7 != 0 {
+				continue
+			}
+			src := uint32((norm >> 13) & 0xfffff)
+			src |= uint32((norm>>36)&1) << 20
+			src <<= 4
+			var dest uint32
+			if encoder {
+				dest = pos + uint32(i) + src
+			} else {
+				dest = src - (pos + uint32(i))
+			}
+			dest >>= 4
+			norm &^= uint64(0x8fffff) << 13
+			norm |= uint64(dest&0xfffff) << 13
+			norm |= uint64(dest&0x100000) << (36 - 20)
+			instr &= 1<<bitRes - 1
+			instr |= norm << bitRes
+			for j := 0; j < 6; j++ {
+				p[bytePos+j] = byte(instr >> (8 * uint(j)))
+			}
+		}
+	}
+	return i
+}
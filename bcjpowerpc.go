@@ -0,0 +1,30 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// powerPCCode converts the addresses of the big-endian PowerPC branch
+// instruction with the link bit set and the absolute-address bit
+// cleared.
+func powerPCCode(pos uint32, encoder bool, p []byte) int {
+	n := len(p) &^ 3
+	for i := 0; i < n; i += 4 {
+		if p[i]>>2 != 0x12 || p[i+3]&3 != 1 {
+			continue
+		}
+		src := (uint32(p[i])&3)<<24 | uint32(p[i+1])<<16 |
+			uint32(p[i+2])<<8 | uint32(p[i+3])&^3
+		var dest uint32
+		if encoder {
+			dest = pos + uint32(i) + src
+		} else {
+			dest = src - (pos + uint32(i))
+		}
+		p[i] = 0x48 | byte((dest>>24)&3)
+		p[i+1] = byte(dest >> 16)
+		p[i+2] = byte(dest >> 8)
+		p[i+3] = p[i+3]&3 | byte(dest)
+	}
+	return n
+}
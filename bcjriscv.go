@@ -0,0 +1,187 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// The RISC-V filter converts the JAL instruction and pairs of an AUIPC
+// instruction followed by an instruction using the register set by
+// AUIPC. The encoder stores the absolute address of the pair in
+// big-endian order in place of the second instruction and marks the
+// pair by setting the destination register of AUIPC to x2. AUIPC
+// instructions that look like such a converted pair are rearranged in
+// a simpler way, which keeps the filter bijective for arbitrary data.
+//
+// The algorithm follows the RISC-V BCJ filter of xz-utils.
+
+// uint32BE converts a big-endian representation to an uint32 value.
+func uint32BE(p []byte) uint32 {
+	return uint32(p[0])<<24 | uint32(p[1])<<16 | uint32(p[2])<<8 |
+		uint32(p[3])
+}
+
+// putUint32BE puts the big-endian representation of x into the first
+// four bytes of p.
+func putUint32BE(p []byte, x uint32) {
+	p[0] = byte(x >> 24)
+	p[1] = byte(x >> 16)
+	p[2] = byte(x >> 8)
+	p[3] = byte(x)
+}
+
+// riscvNotAUIPCPair checks whether the AUIPC instruction and inst2 are
+// not a pair. For a pair the destination register of AUIPC must be the
+// source register rs1 of inst2 and the lowest two opcode bits of inst2
+// must be set.
+func riscvNotAUIPCPair(auipc, inst2 uint32) bool {
+	return ((auipc<<8)^(inst2-3))&0xf8003 != 0
+}
+
+// riscvNotSpecialAUIPC checks whether the AUIPC instruction doesn't
+// have the special format used for converted pairs. The special format
+// has the destination register x2 and the lowest opcode bits of the
+// packed second instruction set. The packed register rs1 must not be
+// x0 or x2.
+func riscvNotSpecialAUIPC(auipc, rs1 uint32) bool {
+	return (auipc-0x3117)<<18 >= rs1&0x1d
+}
+
+// riscvCode converts the addresses of the RISC-V instructions. Encoder
+// and decoder differ in more than the sign of the address adjustment.
+func riscvCode(pos uint32, encoder bool, p []byte) int {
+	if encoder {
+		return riscvEncode(pos, p)
+	}
+	return riscvDecode(pos, p)
+}
+
+// riscvEncode converts the RISC-V instructions for the encoder. JAL
+// instructions in the last six bytes are not converted.
+func riscvEncode(pos uint32, p []byte) int {
+	if len(p) < 8 {
+		return 0
+	}
+	limit := len(p) - 8
+	i := 0
+	for ; i <= limit; i += 2 {
+		inst := uint32(p[i])
+		if inst == 0xef {
+			// JAL
+			b1 := uint32(p[i+1])
+			if b1&0x0d != 0 {
+				continue
+			}
+			b2 := uint32(p[i+2])
+			b3 := uint32(p[i+3])
+			pc := pos + uint32(i)
+			addr := (b1&0xf0)<<8 | (b2&0x0f)<<16 | (b2&0x10)<<7 |
+				(b2&0xe0)>>4 | (b3&0x7f)<<4 | (b3&0x80)<<13
+			addr += pc
+			p[i+1] = byte(b1&0x0f | (addr>>13)&0xf0)
+			p[i+2] = byte(addr >> 9)
+			p[i+3] = byte(addr >> 1)
+			i += 4 - 2
+			continue
+		}
+		if inst&0x7f != 0x17 {
+			continue
+		}
+		// AUIPC
+		inst = uint32LE(p[i:])
+		if inst&0xe80 != 0 {
+			// The destination register is neither x0 nor x2.
+			inst2 := uint32LE(p[i+4:])
+			if riscvNotAUIPCPair(inst, inst2) {
+				// Skip enough bytes that the start of the
+				// second instruction cannot be converted.
+				i += 6 - 2
+				continue
+			}
+			addr := inst & 0xfffff000
+			addr += (inst2 >> 20) - ((inst2 >> 19) & 0x1000)
+			addr += pos + uint32(i)
+			inst = 0x17 | 2<<7 | inst2<<12
+			putUint32LE(p[i:], inst)
+			putUint32BE(p[i+4:], addr)
+		} else {
+			// The destination register is x0 or x2. Data
+			// looking like a converted pair is rearranged.
+			rs1 := inst >> 27
+			if riscvNotSpecialAUIPC(inst, rs1) {
+				i += 4 - 2
+				continue
+			}
+			addr := uint32LE(p[i+4:])
+			inst2 := inst>>12 | addr<<20
+			inst = 0x17 | rs1<<7 | addr&0xfffff000
+			putUint32LE(p[i:], inst)
+			putUint32LE(p[i+4:], inst2)
+		}
+		i += 8 - 2
+	}
+	return i
+}
+
+// riscvDecode reverts the conversion of riscvEncode.
+func riscvDecode(pos uint32, p []byte) int {
+	if len(p) < 8 {
+		return 0
+	}
+	limit := len(p) - 8
+	i := 0
+	for ; i <= limit; i += 2 {
+		inst := uint32(p[i])
+		if inst == 0xef {
+			// JAL
+			b1 := uint32(p[i+1])
+			if b1&0x0d != 0 {
+				continue
+			}
+			b2 := uint32(p[i+2])
+			b3 := uint32(p[i+3])
+			pc := pos + uint32(i)
+			addr := (b1&0xf0)<<13 | b2<<9 | b3<<1
+			addr -= pc
+			p[i+1] = byte(b1&0x0f | (addr>>8)&0xf0)
+			p[i+2] = byte((addr>>16)&0x0f | (addr>>7)&0x10 |
+				(addr<<4)&0xe0)
+			p[i+3] = byte((addr>>4)&0x7f | (addr>>13)&0x80)
+			i += 4 - 2
+			continue
+		}
+		if inst&0x7f != 0x17 {
+			continue
+		}
+		// AUIPC
+		var inst2 uint32
+		inst = uint32LE(p[i:])
+		if inst&0xe80 != 0 {
+			// Rearranged data that looked like a converted
+			// pair.
+			inst2 = uint32LE(p[i+4:])
+			if riscvNotAUIPCPair(inst, inst2) {
+				i += 6 - 2
+				continue
+			}
+			addr := inst & 0xfffff000
+			addr += inst2 >> 20
+			inst = 0x17 | 2<<7 | inst2<<12
+			inst2 = addr
+		} else {
+			// converted pair
+			rs1 := inst >> 27
+			if riscvNotSpecialAUIPC(inst, rs1) {
+				i += 4 - 2
+				continue
+			}
+			addr := uint32BE(p[i+4:])
+			addr -= pos + uint32(i)
+			inst2 = inst>>12 | addr<<20
+			inst = 0x17 | rs1<<7 | (addr+0x800)&0xfffff000
+		}
+		putUint32LE(p[i:], inst)
+		putUint32LE(p[i+4:], inst2)
+		i += 8 - 2
+	}
+	return i
+}
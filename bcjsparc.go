@@ -0,0 +1,33 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// sparcCode converts the addresses of the SPARC CALL instruction.
+func sparcCode(pos uint32, encoder bool, p []byte) int {
+	n := len(p) &^ 3
+	for i := 0; i < n; i += 4 {
+		if !(p[i] == 0x40 && p[i+1]&0xc0 == 0x00) &&
+			!(p[i] == 0x7f && p[i+1]&0xc0 == 0xc0) {
+			continue
+		}
+		src := uint32(p[i])<<24 | uint32(p[i+1])<<16 |
+			uint32(p[i+2])<<8 | uint32(p[i+3])
+		src <<= 2
+		var dest uint32
+		if encoder {
+			dest = pos + uint32(i) + src
+		} else {
+			dest = src - (pos + uint32(i))
+		}
+		dest >>= 2
+		dest = ((-((dest >> 22) & 1))<<22)&0x3fffffff |
+			dest&0x3fffff | 0x40000000
+		p[i] = byte(dest >> 24)
+		p[i+1] = byte(dest >> 16)
+		p[i+2] = byte(dest >> 8)
+		p[i+3] = byte(dest)
+	}
+	return n
+}
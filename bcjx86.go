@@ -0,0 +1,116 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+// x86Converter converts the relative addresses of the x86 CALL (0xE8)
+// and JMP (0xE9) instructions. The algorithm follows the x86 BCJ filter
+// of xz-utils. Since x86 instructions don't have a fixed length, the
+// converter has to keep track of bytes that look like instruction
+// opcodes using prevMask and prevPos.
+type x86Converter struct {
+	start uint32
+	// position of the next byte in the uncompressed stream
+	pos      uint32
+	prevMask uint32
+	prevPos  uint32
+	encoder  bool
+}
+
+// newX86Converter creates a new x86 converter.
+func newX86Converter(startOffset uint32, encoder bool) *x86Converter {
+	c := &x86Converter{start: startOffset, encoder: encoder}
+	c.reset()
+	return c
+}
+
+// reset moves the converter back to the start offset.
+func (c *x86Converter) reset() {
+	c.pos = c.start
+	c.prevMask = 0
+	c.prevPos = c.start - 5
+}
+
+// x86TestMSByte checks whether the byte is 0x00 or 0xFF, which are the
+// most-significant bytes of addresses near the current position.
+func x86TestMSByte(b byte) bool {
+	return b == 0x00 || b == 0xff
+}
+
+// x86MaskToBitNumber translates the prevMask into the bit positions
+// that will be checked.
+var x86MaskToBitNumber = [8]uint32{0, 1, 2, 2, 3, 0, 0, 0}
+
+// convert converts the CALL and JMP instructions in p. The last four
+// bytes of p will not be processed unless they are part of a converted
+// instruction.
+func (c *x86Converter) convert(p []byte) int {
+	if len(p) < 5 {
+		return 0
+	}
+	if c.pos-c.prevPos > 5 {
+		c.prevPos = c.pos - 5
+	}
+	prevMask := c.prevMask
+	limit := len(p) - 5
+	i := 0
+	for i <= limit {
+		b := p[i]
+		if b != 0xe8 && b != 0xe9 {
+			i++
+			continue
+		}
+		pos := c.pos + uint32(i)
+		offset := pos - c.prevPos
+		c.prevPos = pos
+		if offset > 5 {
+			prevMask = 0
+		} else {
+			for j := uint32(0); j < offset; j++ {
+				prevMask &= 0x77
+				prevMask <<= 1
+			}
+		}
+
+		b = p[i+4]
+		if !x86TestMSByte(b) || (prevMask>>1) > 4 ||
+			(prevMask>>1) == 3 {
+			i++
+			prevMask |= 1
+			if x86TestMSByte(b) {
+				prevMask |= 0x10
+			}
+			continue
+		}
+
+		src := uint32(b)<<24 | uint32(p[i+3])<<16 |
+			uint32(p[i+2])<<8 | uint32(p[i+1])
+		var dest uint32
+		for {
+			if c.encoder {
+				dest = src + (pos + 5)
+			} else {
+				dest = src - (pos + 5)
+			}
+			if prevMask == 0 {
+				break
+			}
+			k := x86MaskToBitNumber[prevMask>>1]
+			b = byte(dest >> (24 - k*8))
+			if !x86TestMSByte(b) {
+				break
+			}
+			src = dest ^ (1<<(32-k*8) - 1)
+		}
+		p[i+4] = ^byte(((dest >> 24) & 1) - 1)
+		p[i+3] = byte(dest >> 16)
+		p[i+2] = byte(dest >> 8)
+		p[i+1] = byte(dest)
+		i += 5
+		prevMask = 0
+	}
+	c.prevMask = prevMask
+	c.pos += uint32(i)
+	return i
+}
@@ -0,0 +1,122 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "hash"
+
+// maxCheckID is the largest check ID defined by the xz specification.
+const maxCheckID = 0x0f
+
+// checkSizes provides the sizes of the check values for all check IDs
+// as defined by the specification. The sizes are known for check IDs
+// that are reserved, so streams using them can be decoded without
+// verifying the check values.
+var checkSizes = [maxCheckID + 1]int{
+	0,
+	4, 4, 4,
+	8, 8, 8,
+	16, 16, 16,
+	32, 32, 32,
+	64, 64, 64,
+}
+
+// checkSize returns the size of the check value for the check ID.
+func checkSize(id byte) int {
+	if id > maxCheckID {
+		panic("xz: check ID out of range")
+	}
+	return checkSizes[id]
+}
+
+// verifyCheckID returns errInvalidFlags if the check ID is not defined
+// by the specification. Reserved check IDs are accepted.
+func verifyCheckID(id byte) error {
+	if id > maxCheckID {
+		return errInvalidFlags
+	}
+	return nil
+}
+
+// CheckPolicy defines how a reader handles streams using a check
+// method that the package doesn't support. The check values are
+// skipped using the sizes assigned to the check IDs by the
+// specification.
+type CheckPolicy byte
+
+const (
+	// FailUnsupportedCheck rejects streams with unsupported checks
+	// with an error of kind ErrUnsupported.
+	FailUnsupportedCheck CheckPolicy = iota
+	// WarnUnsupportedCheck calls the function WarnCheck of the
+	// reader configuration and decodes the stream without verifying
+	// the check values.
+	WarnUnsupportedCheck
+	// SkipUnsupportedCheck decodes the stream without verifying the
+	// check values.
+	SkipUnsupportedCheck
+)
+
+// errUnsupportedCheck is returned for unsupported checks under the
+// FailUnsupportedCheck policy.
+var errUnsupportedCheck = formatError(ErrUnsupported,
+	"xz: unsupported check method")
+
+// checkStream applies the policy for unsupported checks to the stream
+// starting at offset, which uses the check ID. An error is returned for
+// an unsupported check under the FailUnsupportedCheck policy.
+func (c *ReaderConfig) checkStream(offset int64, id byte) error {
+	if _, err := newHashFunc(id); err == nil {
+		return nil
+	}
+	switch c.UnsupportedCheck {
+	case WarnUnsupportedCheck:
+		c.WarnCheck(offset, id)
+	case SkipUnsupportedCheck:
+	default:
+		return errUnsupportedCheck
+	}
+	return nil
+}
+
+// newCheckFunc returns the function that creates the hashes for the
+// check ID. Unsupported checks are skipped if the policy allows it.
+func (c *ReaderConfig) newCheckFunc(id byte) (newHash func() hash.Hash,
+	err error) {
+
+	if newHash, err = newHashFunc(id); err == nil {
+		return newHash, nil
+	}
+	if c.UnsupportedCheck == FailUnsupportedCheck || id > maxCheckID {
+		return nil, errUnsupportedCheck
+	}
+	size := checkSize(id)
+	return func() hash.Hash { return skipHash{size} }, nil
+}
+
+// skipHash is used for unsupported checks. It has the size of the check
+// values but doesn't compute them. The block reader doesn't compare
+// the check values.
+type skipHash struct {
+	size int
+}
+
+// computesCheck reports whether the hash computes check values that
+// must be verified.
+func computesCheck(h hash.Hash) bool {
+	if _, ok := h.(skipHash); ok {
+		return false
+	}
+	return h.Size() > 0
+}
+
+func (h skipHash) Write(p []byte) (n int, err error) { return len(p), nil }
+
+func (h skipHash) Sum(b []byte) []byte { return append(b, make([]byte, h.size)...) }
+
+func (h skipHash) Reset() {}
+
+func (h skipHash) Size() int { return h.size }
+
+func (h skipHash) BlockSize() int { return 1 }
@@ -0,0 +1,143 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// setCheckID replaces the check ID in the header and the footer of the
+// single stream in xzData. The check values are not changed.
+func setCheckID(xzData []byte, id byte) []byte {
+	p := bytes.Clone(xzData)
+	p[7] = id
+	putUint32LE(p[8:], crc32.ChecksumIEEE(p[6:8]))
+	f := p[len(p)-footerLen:]
+	f[9] = id
+	putUint32LE(f, crc32.ChecksumIEEE(f[4:10]))
+	return p
+}
+
+func TestCheckSize(t *testing.T) {
+	tests := []struct {
+		id   byte
+		size int
+	}{
+		{None, 0}, {CRC32, 4}, {0x02, 4}, {CRC64, 8}, {0x06, 8},
+		{0x07, 16}, {SHA256, 32}, {0x0c, 32}, {0x0d, 64}, {0x0f, 64},
+	}
+	for _, c := range tests {
+		if n := checkSize(c.id); n != c.size {
+			t.Errorf("checkSize(%#02x) returned %d; want %d", c.id,
+				n, c.size)
+		}
+	}
+}
+
+func TestUnsupportedCheck(t *testing.T) {
+	data := blocksTestData()
+	files := map[byte][]byte{
+		0x05: setCheckID(compressXZ(t,
+			WriterConfig{BlockSize: 4000, CheckSum: CRC64}, data), 0x05),
+		0x0b: setCheckID(compressXZ(t,
+			WriterConfig{CheckSum: SHA256}, data), 0x0b),
+	}
+	for id, xzData := range files {
+		_, err := NewReader(bytes.NewReader(xzData))
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("check %#02x: NewReader returned error %v;"+
+				" want ErrUnsupported", id, err)
+		}
+		_, err = NewReaderAt(bytes.NewReader(xzData),
+			int64(len(xzData)))
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("check %#02x: NewReaderAt returned error %v;"+
+				" want ErrUnsupported", id, err)
+		}
+
+		var warnings []byte
+		configs := []ReaderConfig{
+			{UnsupportedCheck: SkipUnsupportedCheck},
+			{UnsupportedCheck: WarnUnsupportedCheck,
+				WarnCheck: func(offset int64, check byte) {
+					if offset != 0 {
+						t.Errorf("WarnCheck offset %d;"+
+							" want 0", offset)
+					}
+					warnings = append(warnings, check)
+				}},
+			{UnsupportedCheck: SkipUnsupportedCheck, Workers: 2},
+		}
+		for i, cfg := range configs {
+			r, err := cfg.NewReader(bytes.NewReader(xzData))
+			if err != nil {
+				t.Fatalf("check %#02x: config %d: NewReader"+
+					" error %s", id, i, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("check %#02x: config %d: io.ReadAll"+
+					" error %s", id, i, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("check %#02x: config %d: data differs",
+					id, i)
+			}
+
+			ra, err := cfg.NewReaderAt(bytes.NewReader(xzData),
+				int64(len(xzData)))
+			if err != nil {
+				t.Fatalf("check %#02x: config %d: NewReaderAt"+
+					" error %s", id, i, err)
+			}
+			got, err = io.ReadAll(io.NewSectionReader(ra, 0,
+				ra.Size()))
+			if err != nil {
+				t.Fatalf("check %#02x: config %d: ReaderAt"+
+					" error %s", id, i, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("check %#02x: config %d: ReaderAt data"+
+					" differs", id, i)
+			}
+		}
+		if !bytes.Equal(warnings, []byte{id, id}) {
+			t.Fatalf("check %#02x: got warnings %v", id, warnings)
+		}
+
+		info, err := Info(bytes.NewReader(xzData), int64(len(xzData)))
+		if err != nil {
+			t.Fatalf("check %#02x: Info error %s", id, err)
+		}
+		if info.UncompressedSize != int64(len(data)) {
+			t.Fatalf("check %#02x: Info uncompressed size %d;"+
+				" want %d", id, info.UncompressedSize, len(data))
+		}
+	}
+
+	// The check values of unsupported checks are not verified.
+	xzData := files[0x05]
+	f := xzData[len(xzData)-footerLen:]
+	indexSize := (int(uint32LE(f[4:])) + 1) * 4
+	xzData[len(xzData)-footerLen-indexSize-1] ^= 0xff
+	cfg := ReaderConfig{UnsupportedCheck: SkipUnsupportedCheck}
+	r, err := cfg.NewReader(bytes.NewReader(xzData))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.ReadAll(r); err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+
+	cfg = ReaderConfig{UnsupportedCheck: WarnUnsupportedCheck}
+	if err = cfg.Verify(); err == nil {
+		t.Fatalf("Verify accepted WarnUnsupportedCheck without" +
+			" WarnCheck")
+	}
+}
@@ -54,15 +54,19 @@ type format struct {
 // sizes.
 var lzmaDictCapExps = []uint{18, 20, 21, 22, 22, 23, 23, 24, 25, 26}
 
+// lzmaPreset returns the compression preset selected by the options.
+func (o *options) lzmaPreset() lzma.Preset {
+	return lzma.Preset0 + lzma.Preset(o.preset)
+}
+
 // formats contains the formats supported by gxz.
 var formats = map[string]*format{
 	"lzma": &format{
 		newCompressor: func(w io.Writer, opts *options,
 		) (c io.WriteCloser, err error) {
 			lc := lzma.WriterConfig{
-				Properties: &lzma.Properties{LC: 3, LP: 0,
-					PB: 2},
-				DictCap: 1 << lzmaDictCapExps[opts.preset],
+				Preset:  opts.lzmaPreset(),
+				Extreme: opts.extreme,
 			}
 			return lc.NewWriter(w)
 		},
@@ -85,7 +89,8 @@ var formats = map[string]*format{
 		newCompressor: func(w io.Writer, opts *options,
 		) (c io.WriteCloser, err error) {
 			cfg := xz.WriterConfig{
-				DictCap: 1 << lzmaDictCapExps[opts.preset],
+				Preset:  opts.lzmaPreset(),
+				Extreme: opts.extreme,
 			}
 			return cfg.NewWriter(w)
 		},
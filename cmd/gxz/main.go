@@ -31,6 +31,7 @@ in place).
 
   -c, --stdout      write to standard output and don't delete input files
   -d, --decompress  force decompression
+  -e, --extreme     use the slower extreme variant of the preset
   -f, --force       force overwrite of output file and compress links
   -F, --format <format>
                     Specify the file format to compress or decompress.
@@ -93,6 +94,7 @@ type options struct {
 	help       bool
 	stdout     bool
 	decompress bool
+	extreme    bool
 	force      bool
 	format     string
 	keep       bool
@@ -111,6 +113,7 @@ func (o *options) Init() {
 	gflag.BoolVarP(&o.help, "help", "h", false, "")
 	gflag.BoolVarP(&o.stdout, "stdout", "c", false, "")
 	gflag.BoolVarP(&o.decompress, "decompress", "d", false, "")
+	gflag.BoolVarP(&o.extreme, "extreme", "e", false, "")
 	gflag.BoolVarP(&o.force, "force", "f", false, "")
 	gflag.StringVarP(&o.format, "format", "F", "auto", "")
 	gflag.BoolVarP(&o.keep, "keep", "k", false, "")
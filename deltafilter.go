@@ -0,0 +1,194 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Delta filter constants.
+const (
+	deltaFilterID  = 0x03
+	deltaFilterLen = 3
+)
+
+// Minimum and maximum distance supported by the delta filter.
+const (
+	minDeltaDist = 1
+	maxDeltaDist = 256
+)
+
+// DeltaFilter declares the delta filter information stored in an xz
+// block header.
+type DeltaFilter struct {
+	// distance in the range 1 to 256
+	Dist int
+}
+
+// String returns a representation of the delta filter.
+func (f DeltaFilter) String() string {
+	return fmt.Sprintf("delta dist %d", f.Dist)
+}
+
+// ID returns the ID for the delta filter.
+func (f DeltaFilter) ID() uint64 { return deltaFilterID }
+
+// verifyDeltaDist checks whether the distance is supported by the
+// delta filter.
+func verifyDeltaDist(dist int) error {
+	if !(minDeltaDist <= dist && dist <= maxDeltaDist) {
+		return errors.New("xz: delta distance out of range")
+	}
+	return nil
+}
+
+// MarshalBinary converts the DeltaFilter in its encoded representation.
+func (f DeltaFilter) MarshalBinary() (data []byte, err error) {
+	if err = verifyDeltaDist(f.Dist); err != nil {
+		return nil, err
+	}
+	return []byte{deltaFilterID, 1, byte(f.Dist - 1)}, nil
+}
+
+// UnmarshalBinary unmarshals the given data representation of the delta
+// filter.
+func (f *DeltaFilter) UnmarshalBinary(data []byte) error {
+	if len(data) != deltaFilterLen {
+		return errors.New("xz: data for delta filter has wrong length")
+	}
+	if data[0] != deltaFilterID {
+		return errors.New("xz: wrong delta filter id")
+	}
+	if data[1] != 1 {
+		return errors.New("xz: wrong delta filter size")
+	}
+	f.Dist = int(data[2]) + 1
+	return nil
+}
+
+// Reader creates a new reader for the delta filter.
+func (f DeltaFilter) Reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
+	err error) {
+
+	if err = verifyDeltaDist(f.Dist); err != nil {
+		return nil, err
+	}
+	return &deltaReader{r: r, delta: deltaState{dist: f.Dist}}, nil
+}
+
+// WriteCloser creates a io.WriteCloser for the delta filter.
+func (f DeltaFilter) WriteCloser(w io.WriteCloser, c *WriterConfig,
+) (fw io.WriteCloser, err error) {
+	if err = verifyDeltaDist(f.Dist); err != nil {
+		return nil, err
+	}
+	return &deltaWriter{w: w, delta: deltaState{dist: f.Dist}}, nil
+}
+
+// Last returns false, because the delta filter cannot be the last
+// filter in the filter list.
+func (f DeltaFilter) Last() bool { return false }
+
+// deltaState stores the history of the delta filter. The history is
+// organized as a ring buffer of 256 bytes, which is the maximum
+// distance supported.
+type deltaState struct {
+	dist    int
+	history [maxDeltaDist]byte
+	pos     byte
+}
+
+// reset clears the history.
+func (s *deltaState) reset() {
+	s.history = [maxDeltaDist]byte{}
+	s.pos = 0
+}
+
+// encode replaces the bytes of p by the difference to the byte at the
+// configured distance.
+func (s *deltaState) encode(p []byte) {
+	for i, c := range p {
+		p[i] = c - s.history[byte(s.dist+int(s.pos))]
+		s.history[s.pos] = c
+		s.pos--
+	}
+}
+
+// decode reverts the encoding of the delta filter.
+func (s *deltaState) decode(p []byte) {
+	for i, c := range p {
+		c += s.history[byte(s.dist+int(s.pos))]
+		p[i] = c
+		s.history[s.pos] = c
+		s.pos--
+	}
+}
+
+// deltaReader decodes the data provided by the underlying reader.
+type deltaReader struct {
+	r     io.Reader
+	delta deltaState
+}
+
+// Read reads data from the underlying reader and decodes it.
+func (dr *deltaReader) Read(p []byte) (n int, err error) {
+	n, err = dr.r.Read(p)
+	dr.delta.decode(p[:n])
+	return n, err
+}
+
+// Reset clears the history and reads the data to decode from r.
+func (dr *deltaReader) Reset(r io.Reader) error {
+	dr.r = r
+	dr.delta.reset()
+	return nil
+}
+
+// deltaWriter encodes the data written to it and writes the result into
+// the underlying WriteCloser.
+type deltaWriter struct {
+	w     io.WriteCloser
+	delta deltaState
+	buf   [4096]byte
+}
+
+// Write encodes the data and writes it to the underlying writer.
+func (dw *deltaWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		q := dw.buf[:copy(dw.buf[:], p[n:])]
+		dw.delta.encode(q)
+		k, err := dw.w.Write(q)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Flush flushes the underlying WriteCloser. The delta filter doesn't
+// buffer any data.
+func (dw *deltaWriter) Flush() error {
+	return flushWriter(dw.w)
+}
+
+// Close closes the underlying WriteCloser.
+func (dw *deltaWriter) Close() error {
+	return dw.w.Close()
+}
+
+// Reset clears the history and writes the encoded data to w, which
+// must be an io.WriteCloser.
+func (dw *deltaWriter) Reset(w io.Writer) error {
+	wc, ok := w.(io.WriteCloser)
+	if !ok {
+		return errors.New("xz: delta writer requires an io.WriteCloser")
+	}
+	dw.w = wc
+	dw.delta.reset()
+	return nil
+}
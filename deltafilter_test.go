@@ -0,0 +1,110 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// deltaTestData generates the data compressed in testdata/delta4.xz. It
+// consists of two interleaved 16-bit little-endian channels.
+func deltaTestData() []byte {
+	p := make([]byte, 0, 2048*4)
+	for i := 0; i < 2048; i++ {
+		a := uint16((i*37)%2000 - 1000)
+		b := uint16((i*53)%3000 - 1500)
+		p = append(p, byte(a), byte(a>>8), byte(b), byte(b>>8))
+	}
+	return p
+}
+
+func TestDeltaState(t *testing.T) {
+	orig := []byte("abcabcabdabcabcabdxyz")
+	for _, dist := range []int{1, 3, 255, 256} {
+		p := make([]byte, len(orig))
+		copy(p, orig)
+		e := deltaState{dist: dist}
+		e.encode(p[:5])
+		e.encode(p[5:])
+		d := deltaState{dist: dist}
+		d.decode(p[:7])
+		d.decode(p[7:])
+		if !bytes.Equal(p, orig) {
+			t.Fatalf("dist %d: got %q; want %q", dist, p, orig)
+		}
+	}
+}
+
+func TestDeltaFilterMarshalling(t *testing.T) {
+	f := DeltaFilter{Dist: 256}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error %s", err)
+	}
+	var g DeltaFilter
+	if err = g.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error %s", err)
+	}
+	if g != f {
+		t.Fatalf("unmarshalled %#v; want %#v", g, f)
+	}
+	if _, err = (DeltaFilter{Dist: 257}).MarshalBinary(); err == nil {
+		t.Fatalf("MarshalBinary accepts distance 257")
+	}
+}
+
+func TestReaderDelta(t *testing.T) {
+	const file = "testdata/delta4.xz"
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("os.Open(%q) error %s", file, err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, r); err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), deltaTestData()) {
+		t.Fatalf("decompressed data differs from original")
+	}
+}
+
+func TestWriterDelta(t *testing.T) {
+	data := deltaTestData()
+	var buf bytes.Buffer
+	w, err := WriterConfig{DeltaDist: 4}.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	t.Logf("buf.Len() %d", buf.Len())
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var out bytes.Buffer
+	if _, err = io.Copy(&out, r); err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("decompressed data differs from original")
+	}
+
+	if _, err = (WriterConfig{DeltaDist: 257}).NewWriter(&buf); err == nil {
+		t.Fatalf("NewWriter accepts delta distance 257")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
+	"sync"
 
 	"github.com/ulikunitz/xz/lzma"
 )
@@ -55,6 +56,10 @@ const (
 // errInvalidFlags indicates that flags are invalid.
 var errInvalidFlags = errors.New("xz: invalid flags")
 
+// errUnsupportedFlags indicates unsupported stream flags in the input.
+var errUnsupportedFlags = formatError(ErrUnsupported,
+	"xz: unsupported stream flags")
+
 // verifyFlags returns the error errInvalidFlags if the value is
 // invalid.
 func verifyFlags(flags byte) error {
@@ -76,11 +81,13 @@ var flagstrings = map[byte]string{
 
 // flagString returns the string representation for the given flags.
 func flagString(flags byte) string {
-	s, ok := flagstrings[flags]
-	if !ok {
-		return "invalid"
+	if s, ok := flagstrings[flags]; ok {
+		return s
+	}
+	if flags <= maxCheckID {
+		return fmt.Sprintf("Check-%#02x", flags)
 	}
-	return s
+	return "invalid"
 }
 
 // newHashFunc returns a function that creates hash instances for the
@@ -107,7 +114,7 @@ type header struct {
 }
 
 // Errors returned by readHeader.
-var errHeaderMagic = errors.New("xz: invalid header magic bytes")
+var errHeaderMagic = formatError(ErrCorrupt, "xz: invalid header magic bytes")
 
 // ValidHeader checks whether data is a correct xz file header. The
 // length of data must be HeaderLen.
@@ -126,7 +133,7 @@ func (h header) String() string {
 func (h *header) UnmarshalBinary(data []byte) error {
 	// header length
 	if len(data) != HeaderLen {
-		return errors.New("xz: wrong file header length")
+		return formatError(ErrCorrupt, "xz: wrong file header length")
 	}
 
 	// magic header
@@ -138,16 +145,17 @@ func (h *header) UnmarshalBinary(data []byte) error {
 	crc := crc32.NewIEEE()
 	crc.Write(data[6:8])
 	if uint32LE(data[8:]) != crc.Sum32() {
-		return errors.New("xz: invalid checksum for file header")
+		return formatError(ErrChecksum,
+			"xz: invalid checksum for file header")
 	}
 
 	// stream flags
 	if data[6] != 0 {
-		return errInvalidFlags
+		return errUnsupportedFlags
 	}
 	flags := data[7]
-	if err := verifyFlags(flags); err != nil {
-		return err
+	if verifyCheckID(flags) != nil {
+		return errUnsupportedFlags
 	}
 
 	h.flags = flags
@@ -156,7 +164,7 @@ func (h *header) UnmarshalBinary(data []byte) error {
 
 // MarshalBinary generates the xz file header.
 func (h *header) MarshalBinary() (data []byte, err error) {
-	if err = verifyFlags(h.flags); err != nil {
+	if err = verifyCheckID(h.flags); err != nil {
 		return nil, err
 	}
 
@@ -199,7 +207,7 @@ const (
 // MarshalBinary converts footer values into an xz file footer. Note
 // that the footer value is checked for correctness.
 func (f *footer) MarshalBinary() (data []byte, err error) {
-	if err = verifyFlags(f.flags); err != nil {
+	if err = verifyCheckID(f.flags); err != nil {
 		return nil, err
 	}
 	if !(minIndexSize <= f.indexSize && f.indexSize <= maxIndexSize) {
@@ -232,19 +240,19 @@ func (f *footer) MarshalBinary() (data []byte, err error) {
 // footer.
 func (f *footer) UnmarshalBinary(data []byte) error {
 	if len(data) != footerLen {
-		return errors.New("xz: wrong footer length")
+		return formatError(ErrCorrupt, "xz: wrong footer length")
 	}
 
 	// magic bytes
 	if !bytes.Equal(data[10:], footerMagic) {
-		return errors.New("xz: footer magic invalid")
+		return formatError(ErrCorrupt, "xz: footer magic invalid")
 	}
 
 	// CRC-32
 	crc := crc32.NewIEEE()
 	crc.Write(data[4:10])
 	if uint32LE(data) != crc.Sum32() {
-		return errors.New("xz: footer checksum error")
+		return formatError(ErrChecksum, "xz: footer checksum error")
 	}
 
 	var g footer
@@ -253,11 +261,11 @@ func (f *footer) UnmarshalBinary(data []byte) error {
 
 	// flags
 	if data[8] != 0 {
-		return errInvalidFlags
+		return errUnsupportedFlags
 	}
 	g.flags = data[9]
-	if err := verifyFlags(g.flags); err != nil {
-		return err
+	if verifyCheckID(g.flags) != nil {
+		return errUnsupportedFlags
 	}
 
 	*f = g
@@ -270,7 +278,7 @@ func (f *footer) UnmarshalBinary(data []byte) error {
 type blockHeader struct {
 	compressedSize   int64
 	uncompressedSize int64
-	filters          []filter
+	filters          []Filter
 }
 
 // String converts the block header into a string.
@@ -356,7 +364,8 @@ func readSizeInBlockHeader(r io.ByteReader, present bool) (n int64, err error) {
 		return 0, err
 	}
 	if x >= 1<<63 {
-		return 0, errors.New("xz: size overflow in block header")
+		return 0, formatError(ErrCorrupt,
+			"xz: size overflow in block header")
 	}
 	return int64(x), nil
 }
@@ -370,8 +379,8 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	}
 	headerLen := (int(s) + 1) * 4
 	if len(data) != headerLen {
-		return fmt.Errorf("xz: data length %d; want %d", len(data),
-			headerLen)
+		return formatError(ErrCorrupt, fmt.Sprintf(
+			"xz: data length %d; want %d", len(data), headerLen))
 	}
 	n := headerLen - 4
 
@@ -379,13 +388,15 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	crc := crc32.NewIEEE()
 	crc.Write(data[:n])
 	if crc.Sum32() != uint32LE(data[n:]) {
-		return errors.New("xz: checksum error for block header")
+		return formatError(ErrChecksum,
+			"xz: checksum error for block header")
 	}
 
 	// Block header flags
 	flags := data[1]
 	if flags&reservedBlockFlags != 0 {
-		return errors.New("xz: reserved block header flags set")
+		return formatError(ErrUnsupported,
+			"xz: reserved block header flags set")
 	}
 
 	r := bytes.NewReader(data[2:n])
@@ -395,19 +406,19 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	h.compressedSize, err = readSizeInBlockHeader(
 		r, flags&compressedSizePresent != 0)
 	if err != nil {
-		return err
+		return errBlockHeader(err)
 	}
 
 	// Uncompressed size
 	h.uncompressedSize, err = readSizeInBlockHeader(
 		r, flags&uncompressedSizePresent != 0)
 	if err != nil {
-		return err
+		return errBlockHeader(err)
 	}
 
 	h.filters, err = readFilters(r, int(flags&filterCountMask)+1)
 	if err != nil {
-		return err
+		return errBlockHeader(err)
 	}
 
 	// Check padding
@@ -422,29 +433,35 @@ func (h *blockHeader) UnmarshalBinary(data []byte) error {
 	// The only reasonable approach seems to be to ignore the
 	// padding size. We still check that all padding bytes are zero.
 	if !allZeros(data[n-k : n]) {
-		return errPadding
+		return formatError(ErrCorrupt,
+			"xz: non-zero padding in block header")
 	}
 	return nil
 }
 
+// errBlockHeader converts an error found while parsing the block header
+// into a *FormatError. The header has been read completely, so an
+// unexpected end of data means a corrupt header.
+func errBlockHeader(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return asFormatError(err, ErrCorrupt)
+}
+
 // MarshalBinary marshals the binary header.
 func (h *blockHeader) MarshalBinary() (data []byte, err error) {
+	return h.marshalLen(0)
+}
+
+// marshalLen marshals the binary header and adds padding until the
+// header has at least length n.
+func (h *blockHeader) marshalLen(n int) (data []byte, err error) {
 	if !(minFilters <= len(h.filters) && len(h.filters) <= maxFilters) {
 		return nil, errors.New("xz: filter count wrong")
 	}
-	for i, f := range h.filters {
-		if i < len(h.filters)-1 {
-			if f.id() == lzmaFilterID {
-				return nil, errors.New(
-					"xz: LZMA2 filter is not the last")
-			}
-		} else {
-			// last filter
-			if f.id() != lzmaFilterID {
-				return nil, errors.New("xz: " +
-					"last filter must be the LZMA2 filter")
-			}
-		}
+	if err = verifyFilters(h.filters); err != nil {
+		return nil, err
 	}
 
 	var buf bytes.Buffer
@@ -483,6 +500,9 @@ func (h *blockHeader) MarshalBinary() (data []byte, err error) {
 	for i := padLen(int64(buf.Len())); i > 0; i-- {
 		buf.WriteByte(0)
 	}
+	for buf.Len()+4 < n {
+		buf.WriteByte(0)
+	}
 
 	// crc place holder
 	buf.Write(p[:4])
@@ -512,20 +532,92 @@ const (
 	minReservedID = 1 << 62
 )
 
-// filter represents a filter in the block header.
-type filter interface {
-	id() uint64
+// Filter represents a filter in the block header. The package provides
+// the filters LZMA2Filter, DeltaFilter and BCJFilter, which can be
+// combined into a filter chain using the Filters field of WriterConfig.
+// Additional filters can be supported by implementing the interface and
+// registering the filter with RegisterFilter.
+type Filter interface {
+	// ID returns the filter ID.
+	ID() uint64
+	// UnmarshalBinary decodes the complete filter flags consisting
+	// of the filter ID, the size of the properties and the
+	// properties. The ID and the size are encoded as multibyte
+	// integers as defined by the xz format.
 	UnmarshalBinary(data []byte) error
+	// MarshalBinary encodes the filter flags in the format expected
+	// by UnmarshalBinary.
 	MarshalBinary() (data []byte, err error)
-	reader(r io.Reader, c *ReaderConfig) (fr io.Reader, err error)
-	writeCloser(w io.WriteCloser, c *WriterConfig) (fw io.WriteCloser, err error)
-	// filter must be last filter
-	last() bool
+	// Reader returns a reader that decodes the data read from r.
+	Reader(r io.Reader, c *ReaderConfig) (fr io.Reader, err error)
+	// WriteCloser returns a writer that encodes the data and writes
+	// it to w. The Close method of the returned writer must close
+	// w. The writer may provide a method Flush() error, which must
+	// write all data encoded so far to w and flush w. Writer.Flush
+	// ends the block if a writer in the filter chain doesn't
+	// support flushing.
+	WriteCloser(w io.WriteCloser, c *WriterConfig) (fw io.WriteCloser, err error)
+	// Last reports whether the filter must be the last filter in
+	// the filter chain. Filters compressing the data, like the
+	// LZMA2 filter, must be the last filter. All other filters must
+	// not.
+	Last() bool
 }
 
-// readFilter reads a block filter from the block header. At this point
-// in time only the LZMA2 filter is supported.
-func readFilter(r io.Reader) (f filter, err error) {
+// filterRegistry maps filter IDs to functions creating the filter
+// values used for unmarshalling.
+var filterRegistry = struct {
+	sync.RWMutex
+	factories map[uint64]func() Filter
+}{factories: make(map[uint64]func() Filter)}
+
+// RegisterFilter registers a factory function for the filter ID. The
+// reader uses the function to create the filter value for the filter
+// flags in a block header. The ID must be less than 2^62; larger IDs
+// are reserved by the xz format. RegisterFilter panics if the ID is
+// reserved, the factory is nil or a filter has already been registered
+// for the ID.
+func RegisterFilter(id uint64, factory func() Filter) {
+	if id >= minReservedID {
+		panic("xz: RegisterFilter with reserved filter id")
+	}
+	if factory == nil {
+		panic("xz: RegisterFilter with nil factory")
+	}
+	filterRegistry.Lock()
+	defer filterRegistry.Unlock()
+	if _, dup := filterRegistry.factories[id]; dup {
+		panic(fmt.Sprintf("xz: RegisterFilter called twice for "+
+			"filter id %#x", id))
+	}
+	filterRegistry.factories[id] = factory
+}
+
+// filterFactory returns the factory function registered for the filter
+// ID.
+func filterFactory(id uint64) (factory func() Filter, ok bool) {
+	filterRegistry.RLock()
+	defer filterRegistry.RUnlock()
+	factory, ok = filterRegistry.factories[id]
+	return factory, ok
+}
+
+// init registers the filters supported by the package.
+func init() {
+	RegisterFilter(lzmaFilterID, func() Filter { return new(LZMA2Filter) })
+	RegisterFilter(deltaFilterID, func() Filter { return new(DeltaFilter) })
+	for b := range bcjAlignment {
+		RegisterFilter(uint64(b), func() Filter { return new(BCJFilter) })
+	}
+}
+
+// maxFilterPropsLen limits the size of the filter properties. The
+// block header cannot be larger than 1024 bytes.
+const maxFilterPropsLen = 1024
+
+// readFilter reads a block filter from the block header. The filter
+// value is created by the factory registered for the filter ID.
+func readFilter(r io.Reader) (f Filter, err error) {
 	br := lzma.ByteReader(r)
 
 	// index
@@ -534,39 +626,53 @@ func readFilter(r io.Reader) (f filter, err error) {
 		return nil, err
 	}
 
-	var data []byte
-	switch id {
-	case lzmaFilterID:
-		data = make([]byte, lzmaFilterLen)
-		data[0] = lzmaFilterID
-		if _, err = io.ReadFull(r, data[1:]); err != nil {
-			return nil, err
-		}
-		f = new(lzmaFilter)
-	default:
-		if id >= minReservedID {
-			return nil, errors.New(
-				"xz: reserved filter id in block stream header")
-		}
-		return nil, errors.New("xz: invalid filter id")
+	if id >= minReservedID {
+		return nil, formatError(ErrCorrupt,
+			"xz: reserved filter id in block stream header")
 	}
-	if err = f.UnmarshalBinary(data); err != nil {
+	factory, ok := filterFactory(id)
+	if !ok {
+		return nil, formatError(ErrUnsupported,
+			fmt.Sprintf("xz: unsupported filter id %#x", id))
+	}
+	f = factory()
+
+	// size of properties
+	size, _, err := readUvarint(br)
+	if err != nil {
 		return nil, err
 	}
+	if size > maxFilterPropsLen {
+		return nil, formatError(ErrUnsupported,
+			"xz: filter properties too large")
+	}
+
+	// The filters unmarshal the complete filter flags.
+	data := make([]byte, 20, 20+size)
+	k := putUvarint(data, id)
+	k += putUvarint(data[k:], size)
+	data = data[:k+int(size)]
+	if _, err = io.ReadFull(r, data[k:]); err != nil {
+		return nil, err
+	}
+	if err = f.UnmarshalBinary(data); err != nil {
+		return nil, asFormatError(err, ErrCorrupt)
+	}
 	return f, err
 }
 
-// readFilters reads count filters. At this point in time only the count
-// 1 is supported.
-func readFilters(r io.Reader, count int) (filters []filter, err error) {
-	if count != 1 {
+// readFilters reads count filters.
+func readFilters(r io.Reader, count int) (filters []Filter, err error) {
+	if !(minFilters <= count && count <= maxFilters) {
 		return nil, errors.New("xz: unsupported filter count")
 	}
-	f, err := readFilter(r)
-	if err != nil {
-		return nil, err
+	filters = make([]Filter, count)
+	for i := range filters {
+		if filters[i], err = readFilter(r); err != nil {
+			return nil, err
+		}
 	}
-	return []filter{f}, err
+	return filters, nil
 }
 
 /*** Index ***/
@@ -586,7 +692,8 @@ func readRecord(r io.ByteReader) (rec record, n int, err error) {
 	}
 	rec.unpaddedSize = int64(u)
 	if rec.unpaddedSize < 0 {
-		return rec, n, errors.New("xz: unpadded size negative")
+		return rec, n, formatError(ErrCorrupt,
+			"xz: unpadded size negative")
 	}
 
 	u, k, err = readUvarint(r)
@@ -596,7 +703,8 @@ func readRecord(r io.ByteReader) (rec record, n int, err error) {
 	}
 	rec.uncompressedSize = int64(u)
 	if rec.uncompressedSize < 0 {
-		return rec, n, errors.New("xz: uncompressed size negative")
+		return rec, n, formatError(ErrCorrupt,
+			"xz: uncompressed size negative")
 	}
 
 	return rec, n, nil
@@ -661,7 +769,8 @@ func writeIndex(w io.Writer, index []record) (n int64, err error) {
 }
 
 // readIndexBody reads the index from the reader. It assumes that the
-// index indicator has already been read.
+// index indicator has already been read. The number of records is not
+// checked if expectedRecordLen is negative.
 func readIndexBody(r io.Reader, expectedRecordLen int) (records []record, n int64, err error) {
 	crc := crc32.NewIEEE()
 	// index indicator
@@ -677,22 +786,29 @@ func readIndexBody(r io.Reader, expectedRecordLen int) (records []record, n int6
 	}
 	recLen := int(u)
 	if recLen < 0 || uint64(recLen) != u {
-		return nil, n, errors.New("xz: record number overflow")
+		return nil, n, formatError(ErrCorrupt,
+			"xz: record number overflow")
 	}
-	if recLen != expectedRecordLen {
-		return nil, n, fmt.Errorf(
+	if expectedRecordLen >= 0 && recLen != expectedRecordLen {
+		return nil, n, formatError(ErrCorrupt, fmt.Sprintf(
 			"xz: index length is %d; want %d",
-			recLen, expectedRecordLen)
+			recLen, expectedRecordLen))
 	}
 
-	// list of records
-	records = make([]record, recLen)
-	for i := range records {
-		records[i], k, err = readRecord(br)
+	// list of records; the capacity is limited because recLen
+	// might not have been checked
+	c := recLen
+	if c > 1024 {
+		c = 1024
+	}
+	records = make([]record, 0, c)
+	for i := 0; i < recLen; i++ {
+		rec, k, err := readRecord(br)
 		n += int64(k)
 		if err != nil {
 			return nil, n, err
 		}
+		records = append(records, rec)
 	}
 
 	p := make([]byte, padLen(int64(n+1)), 4)
@@ -702,7 +818,8 @@ func readIndexBody(r io.Reader, expectedRecordLen int) (records []record, n int6
 		return nil, n, err
 	}
 	if !allZeros(p) {
-		return nil, n, errors.New("xz: non-zero byte in index padding")
+		return nil, n, formatError(ErrCorrupt,
+			"xz: non-zero byte in index padding")
 	}
 
 	// crc32
@@ -714,7 +831,8 @@ func readIndexBody(r io.Reader, expectedRecordLen int) (records []record, n int6
 		return records, n, err
 	}
 	if uint32LE(p) != s {
-		return nil, n, errors.New("xz: wrong checksum for index")
+		return nil, n, formatError(ErrChecksum,
+			"xz: wrong checksum for index")
 	}
 
 	return records, n, nil
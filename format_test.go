@@ -6,6 +6,8 @@ package xz
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"testing"
 )
 
@@ -106,7 +108,7 @@ func TestBlockHeader(t *testing.T) {
 	h := blockHeader{
 		compressedSize:   1234,
 		uncompressedSize: -1,
-		filters:          []filter{&lzmaFilter{4096}},
+		filters:          []Filter{&LZMA2Filter{4096}},
 	}
 	data, err := h.MarshalBinary()
 	if err != nil {
@@ -134,9 +136,137 @@ func TestBlockHeader(t *testing.T) {
 		t.Errorf("got len(filters) %d; want %d",
 			len(g.filters), len(h.filters))
 	}
-	glf := g.filters[0].(*lzmaFilter)
-	hlf := h.filters[0].(*lzmaFilter)
-	if glf.dictCap != hlf.dictCap {
-		t.Errorf("got dictCap %d; want %d", glf.dictCap, hlf.dictCap)
+	glf := g.filters[0].(*LZMA2Filter)
+	hlf := h.filters[0].(*LZMA2Filter)
+	if glf.DictCap != hlf.DictCap {
+		t.Errorf("got dictCap %d; want %d", glf.DictCap, hlf.DictCap)
+	}
+}
+
+// xorFilterID is the ID used for xorFilter in the tests.
+const xorFilterID = 0x2d2d2d
+
+// xorFilter is a custom filter XORing all bytes with a key.
+type xorFilter struct {
+	key byte
+}
+
+func (f xorFilter) ID() uint64 { return xorFilterID }
+
+func (f xorFilter) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 20)
+	k := putUvarint(data, xorFilterID)
+	k += putUvarint(data[k:], 1)
+	data[k] = f.key
+	return data[:k+1], nil
+}
+
+func (f *xorFilter) UnmarshalBinary(data []byte) error {
+	id, k, err := readUvarint(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if id != xorFilterID {
+		return errors.New("wrong xor filter id")
+	}
+	if !bytes.Equal(data[k:len(data)-1], []byte{1}) {
+		return errors.New("wrong xor filter size")
+	}
+	f.key = data[len(data)-1]
+	return nil
+}
+
+type xorReader struct {
+	r   io.Reader
+	key byte
+}
+
+func (xr *xorReader) Read(p []byte) (n int, err error) {
+	n, err = xr.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= xr.key
+	}
+	return n, err
+}
+
+func (f xorFilter) Reader(r io.Reader, c *ReaderConfig) (io.Reader, error) {
+	return &xorReader{r, f.key}, nil
+}
+
+type xorWriter struct {
+	w   io.WriteCloser
+	key byte
+}
+
+func (xw *xorWriter) Write(p []byte) (n int, err error) {
+	q := make([]byte, len(p))
+	for i, b := range p {
+		q[i] = b ^ xw.key
+	}
+	return xw.w.Write(q)
+}
+
+func (xw *xorWriter) Close() error { return xw.w.Close() }
+
+func (f xorFilter) WriteCloser(w io.WriteCloser, c *WriterConfig,
+) (io.WriteCloser, error) {
+	return &xorWriter{w, f.key}, nil
+}
+
+func (f xorFilter) Last() bool { return false }
+
+func init() {
+	RegisterFilter(xorFilterID, func() Filter { return new(xorFilter) })
+}
+
+func TestRegisterFilter(t *testing.T) {
+	const text = "The quick brown fox jumps over the lazy dog."
+	var buf bytes.Buffer
+	cfg := WriterConfig{Filters: []Filter{
+		&xorFilter{0x5a}, &LZMA2Filter{}}}
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = io.WriteString(w, text); err != nil {
+		t.Fatalf("WriteString error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if string(out) != text {
+		t.Fatalf("read %q; want %q", out, text)
+	}
+}
+
+func TestRegisterFilterPanics(t *testing.T) {
+	factory := func() Filter { return new(xorFilter) }
+	tests := []struct {
+		id      uint64
+		factory func() Filter
+	}{
+		{lzmaFilterID, factory},
+		{xorFilterID, factory},
+		{minReservedID, factory},
+		{0x2d2d2e, nil},
+	}
+	for _, c := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterFilter(%#x) didn't panic",
+						c.id)
+				}
+			}()
+			RegisterFilter(c.id, c.factory)
+		}()
 	}
 }
@@ -0,0 +1,85 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// FormatError reports a problem with the compressed input. It provides
+// the compressed byte offset, the stream and block index, if known, and
+// the kind of the problem, which can be tested using errors.Is with
+// ErrChecksum, ErrTruncated, ErrUnsupported and ErrCorrupt. The type is
+// shared with the lzma package.
+type FormatError = lzma.FormatError
+
+// The error kinds of a FormatError.
+var (
+	// ErrChecksum indicates a mismatch of a CRC or of a block check.
+	ErrChecksum = lzma.ErrChecksum
+	// ErrTruncated indicates that the input ended unexpectedly.
+	ErrTruncated = lzma.ErrTruncated
+	// ErrUnsupported indicates a feature that is not supported, for
+	// instance an unknown filter or check.
+	ErrUnsupported = lzma.ErrUnsupported
+	// ErrCorrupt indicates that the input doesn't follow the xz
+	// format.
+	ErrCorrupt = lzma.ErrCorrupt
+)
+
+// formatError creates a *FormatError without position information.
+func formatError(kind error, msg string) *FormatError {
+	return &FormatError{
+		Offset: -1,
+		Stream: -1,
+		Block:  -1,
+		Kind:   kind,
+		Msg:    msg,
+	}
+}
+
+// asFormatError returns err if it is a *FormatError, io.EOF or nil.
+// Other errors are wrapped into a *FormatError of the given kind.
+func asFormatError(err error, kind error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	var e *FormatError
+	if errors.As(err, &e) {
+		return err
+	}
+	f := formatError(kind, err.Error())
+	f.Err = err
+	return f
+}
+
+// locate adds the position to a *FormatError without it. The error is
+// copied, because it might be shared. io.ErrUnexpectedEOF is converted
+// into a *FormatError of kind ErrTruncated. All other errors are
+// returned unchanged. Negative arguments are ignored.
+func locate(err error, offset int64, stream, block int) error {
+	var e *FormatError
+	if !errors.As(err, &e) {
+		if err != io.ErrUnexpectedEOF {
+			return err
+		}
+		e = formatError(ErrTruncated, "xz: unexpected end of input")
+		e.Err = err
+	}
+	f := *e
+	if f.Offset < 0 {
+		f.Offset = offset
+	}
+	if f.Stream < 0 {
+		f.Stream = stream
+	}
+	if f.Block < 0 {
+		f.Block = block
+	}
+	return &f
+}
@@ -0,0 +1,106 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestFormatError(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	// The blocks of blocks.xz start at the offsets 12, 4416, 8784,
+	// 13132 and 17504. The block headers have a length of 16 bytes.
+	modify := func(f func(p []byte)) []byte {
+		p := bytes.Clone(blocksXZ)
+		f(p)
+		return p
+	}
+	tests := []struct {
+		name   string
+		data   []byte
+		kind   error
+		offset int64
+		block  int
+	}{
+		{"truncated", blocksXZ[:10000], ErrTruncated, 10000, 2},
+		{"boundary", blocksXZ[:4416], ErrTruncated, 4416, 1},
+		{"checksum", modify(func(p []byte) { p[4415] ^= 1 }),
+			ErrChecksum, 4408, 0},
+		{"filter", modify(func(p []byte) {
+			p[18] = 0x7f
+			putUint32LE(p[24:], crc32.ChecksumIEEE(p[12:24]))
+		}), ErrUnsupported, 12, 0},
+		{"chunk", modify(func(p []byte) { p[4432] = 3 }),
+			ErrCorrupt, 4433, 1},
+		{"magic", modify(func(p []byte) { p[0] ^= 1 }),
+			ErrCorrupt, 0, -1},
+	}
+	for _, c := range tests {
+		for _, workers := range []int{0, 2} {
+			cfg := ReaderConfig{Workers: workers}
+			r, err := cfg.NewReader(onlyReader{bytes.NewReader(c.data)})
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if !errors.Is(err, c.kind) {
+				t.Fatalf("%s: workers %d: got error %v; want %v",
+					c.name, workers, err, c.kind)
+			}
+			var e *FormatError
+			if !errors.As(err, &e) {
+				t.Fatalf("%s: error %v is not a *FormatError",
+					c.name, err)
+			}
+			if e.Offset != c.offset || e.Stream != 0 ||
+				e.Block != c.block {
+				t.Fatalf("%s: workers %d: got offset %d, "+
+					"stream %d, block %d; want %d, 0, %d",
+					c.name, workers, e.Offset, e.Stream,
+					e.Block, c.offset, c.block)
+			}
+			if c.kind == ErrTruncated &&
+				!errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("%s: error %v is not io.ErrUnexpectedEOF",
+					c.name, err)
+			}
+		}
+	}
+}
+
+func TestFormatErrorReaderAt(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	p := bytes.Clone(blocksXZ)
+	// check of the third block
+	p[13131] ^= 1
+	r, err := NewReaderAt(bytes.NewReader(p), int64(len(p)))
+	if err != nil {
+		t.Fatalf("NewReaderAt error %s", err)
+	}
+	_, err = r.ReadAt(make([]byte, 10), 16000)
+	var e *FormatError
+	if !errors.As(err, &e) || !errors.Is(err, ErrChecksum) {
+		t.Fatalf("ReadAt error %v; want checksum *FormatError", err)
+	}
+	if e.Stream != 0 || e.Block != 2 || e.Offset != 13124 {
+		t.Fatalf("got offset %d, stream %d, block %d; "+
+			"want 13124, 0, 2", e.Offset, e.Stream, e.Block)
+	}
+
+	_, err = NewReaderAt(bytes.NewReader(p[:len(p)-8]), int64(len(p)-8))
+	if !errors.As(err, &e) {
+		t.Fatalf("NewReaderAt error %v; want *FormatError", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "io"
+
+// BlockInfo describes a block of an xz stream.
+type BlockInfo struct {
+	// offset of the block header in the file
+	Offset int64
+	// offset of the block data in the uncompressed data of the file
+	UncompressedOffset int64
+	// size of the block header
+	HeaderSize int
+	// size of the compressed data without header, padding and check
+	CompressedSize int64
+	// size of the block without block padding as stored in the index
+	UnpaddedSize     int64
+	UncompressedSize int64
+}
+
+// StreamInfo describes an xz stream.
+type StreamInfo struct {
+	// offset of the stream header in the file
+	Offset int64
+	// offset of the stream data in the uncompressed data of the file
+	UncompressedOffset int64
+	// size of the stream from header to footer
+	CompressedSize   int64
+	UncompressedSize int64
+	// check ID of the stream: None, CRC32, CRC64, SHA256 or an ID
+	// up to 0x0f reserved by the specification, whose check values
+	// are not verified (see ReaderConfig.UnsupportedCheck)
+	CheckSum byte
+	// length of the stream padding following the stream
+	Padding int64
+	// size of the index
+	IndexSize int64
+	Blocks    []BlockInfo
+}
+
+// Ratio returns the compression ratio of the stream, which is the
+// compressed size divided by the uncompressed size. It returns zero if
+// the uncompressed size is zero.
+func (s *StreamInfo) Ratio() float64 {
+	return ratio(s.CompressedSize, s.UncompressedSize)
+}
+
+// FileInfo provides information about an xz file. It is the
+// information shown by the list mode of the xz tool.
+type FileInfo struct {
+	Streams []StreamInfo
+	// total number of blocks
+	BlockCount int
+	// size of the file including stream padding
+	CompressedSize   int64
+	UncompressedSize int64
+}
+
+// Ratio returns the compression ratio of the file, which is the
+// compressed size divided by the uncompressed size. It returns zero if
+// the uncompressed size is zero.
+func (f *FileInfo) Ratio() float64 {
+	return ratio(f.CompressedSize, f.UncompressedSize)
+}
+
+// ratio computes the compression ratio.
+func ratio(compressed, uncompressed int64) float64 {
+	if uncompressed == 0 {
+		return 0
+	}
+	return float64(compressed) / float64(uncompressed)
+}
+
+// Info reads the metadata of the xz file of the given size without
+// decompressing it. The file is read backward from the end using the
+// stream footers and indexes. Only the first byte of each block header
+// is read to determine the header size.
+func Info(xz io.ReaderAt, size int64) (info *FileInfo, err error) {
+	streams, err := scanStreams(xz, size)
+	if err != nil {
+		return nil, err
+	}
+	info = &FileInfo{
+		Streams:        make([]StreamInfo, len(streams)),
+		CompressedSize: size,
+	}
+	p := make([]byte, 1)
+	for i, s := range streams {
+		checkLen := int64(checkSize(s.flags))
+		si := &info.Streams[i]
+		*si = StreamInfo{
+			Offset:             s.offset,
+			UncompressedOffset: info.UncompressedSize,
+			CompressedSize:     s.size,
+			CheckSum:           s.flags,
+			Padding:            s.padding,
+			IndexSize:          s.indexSize,
+			Blocks:             make([]BlockInfo, len(s.index)),
+		}
+		offset := s.offset + HeaderLen
+		for j, rec := range s.index {
+			if err = readAtFull(xz, p, offset); err != nil {
+				return nil, locate(err, offset, i, j)
+			}
+			if p[0] == 0 {
+				return nil, locate(formatError(ErrCorrupt,
+					"xz: block header expected"), offset, i, j)
+			}
+			headerSize := (int(p[0]) + 1) * 4
+			compressedSize := rec.unpaddedSize -
+				int64(headerSize) - checkLen
+			if compressedSize <= 0 {
+				return nil, locate(formatError(ErrCorrupt,
+					"xz: unpadded size in index too small"),
+					offset, i, j)
+			}
+			if rec.uncompressedSize > maxInt64-info.UncompressedSize {
+				return nil, locate(formatError(ErrCorrupt,
+					"xz: uncompressed size overflow"), -1, i, j)
+			}
+			si.Blocks[j] = BlockInfo{
+				Offset:             offset,
+				UncompressedOffset: info.UncompressedSize,
+				HeaderSize:         headerSize,
+				CompressedSize:     compressedSize,
+				UnpaddedSize:       rec.unpaddedSize,
+				UncompressedSize:   rec.uncompressedSize,
+			}
+			offset += rec.unpaddedSize +
+				int64(padLen(rec.unpaddedSize))
+			si.UncompressedSize += rec.uncompressedSize
+			info.UncompressedSize += rec.uncompressedSize
+		}
+		info.BlockCount += len(s.index)
+	}
+	return info, nil
+}
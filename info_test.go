@@ -0,0 +1,125 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestInfoFile(t *testing.T) {
+	data, err := os.ReadFile("testdata/x86.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	info, err := Info(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Info error %s", err)
+	}
+	// values reported by xz --robot -lvv
+	if info.CompressedSize != 7048 || info.UncompressedSize != 8176 {
+		t.Fatalf("file sizes %d %d; want 7048 8176",
+			info.CompressedSize, info.UncompressedSize)
+	}
+	if len(info.Streams) != 1 || info.BlockCount != 1 {
+		t.Fatalf("got %d streams and %d blocks; want 1 and 1",
+			len(info.Streams), info.BlockCount)
+	}
+	s := info.Streams[0]
+	if s.CheckSum != CRC64 {
+		t.Fatalf("check %s; want %s", flagString(s.CheckSum),
+			flagString(CRC64))
+	}
+	want := BlockInfo{
+		Offset:           12,
+		HeaderSize:       12,
+		CompressedSize:   6989,
+		UnpaddedSize:     7009,
+		UncompressedSize: 8176,
+	}
+	if s.Blocks[0] != want {
+		t.Fatalf("block info %+v; want %+v", s.Blocks[0], want)
+	}
+	if r := info.Ratio(); !(0.862 <= r && r < 0.863) {
+		t.Fatalf("ratio %.3f; want 0.862", r)
+	}
+}
+
+func TestInfoMultiStream(t *testing.T) {
+	xzData, data := multiStreamFile(t)
+	info, err := Info(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("Info error %s", err)
+	}
+	if info.UncompressedSize != int64(len(data)) {
+		t.Fatalf("uncompressed size %d; want %d",
+			info.UncompressedSize, len(data))
+	}
+	if len(info.Streams) != 4 {
+		t.Fatalf("got %d streams; want 4", len(info.Streams))
+	}
+	var compressed, uncompressed int64
+	blockCount := 0
+	for i, s := range info.Streams {
+		if s.Offset != compressed {
+			t.Fatalf("stream %d offset %d; want %d", i, s.Offset,
+				compressed)
+		}
+		if s.Padding != int64(4*i) {
+			t.Fatalf("stream %d padding %d; want %d", i,
+				s.Padding, 4*i)
+		}
+		wantCheck := CRC32
+		if i%2 == 1 {
+			wantCheck = SHA256
+		}
+		if s.CheckSum != wantCheck {
+			t.Fatalf("stream %d check %s; want %s", i,
+				flagString(s.CheckSum), flagString(wantCheck))
+		}
+		offset := s.Offset + HeaderLen
+		for j, b := range s.Blocks {
+			if b.Offset != offset {
+				t.Fatalf("stream %d block %d offset %d; want %d",
+					i, j, b.Offset, offset)
+			}
+			if b.UncompressedOffset != uncompressed {
+				t.Fatalf("stream %d block %d uncompressed "+
+					"offset %d; want %d", i, j,
+					b.UncompressedOffset, uncompressed)
+			}
+			offset += b.UnpaddedSize + int64(padLen(b.UnpaddedSize))
+			uncompressed += b.UncompressedSize
+		}
+		if end := offset + s.IndexSize + footerLen; end != s.Offset+s.CompressedSize {
+			t.Fatalf("stream %d ends at %d; want %d", i,
+				s.Offset+s.CompressedSize, end)
+		}
+		compressed += s.CompressedSize + s.Padding
+		blockCount += len(s.Blocks)
+	}
+	if compressed != int64(len(xzData)) {
+		t.Fatalf("sum of stream sizes %d; want %d", compressed,
+			len(xzData))
+	}
+	if blockCount != info.BlockCount {
+		t.Fatalf("block count %d; want %d", info.BlockCount,
+			blockCount)
+	}
+}
+
+func TestInfoReservedCheck(t *testing.T) {
+	xzData := setCheckID(compressXZ(t,
+		WriterConfig{BlockSize: 4000, CheckSum: CRC64},
+		blocksTestData()), 0x05)
+	info, err := Info(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("Info error %s", err)
+	}
+	if c := info.Streams[0].CheckSum; c != 0x05 {
+		t.Fatalf("check %s; want %s", flagString(c), flagString(0x05))
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "errors"
+
+// ErrMaxUncompressed is returned by the Reader if the uncompressed data
+// would exceed the MaxUncompressed limit of the reader configuration.
+var ErrMaxUncompressed = errors.New(
+	"xz: uncompressed size exceeds MaxUncompressed limit")
+
+// ErrMaxRatio is returned by the Reader if the ratio of uncompressed to
+// compressed data would exceed the MaxRatio limit of the reader
+// configuration.
+var ErrMaxRatio = errors.New("xz: compression ratio exceeds MaxRatio limit")
+
+// readLimits provides the limits for the uncompressed data produced by
+// a reader. Zero values mean no limit.
+type readLimits struct {
+	maxUncompressed int64
+	maxRatio        float64
+}
+
+// limits returns the output limits of the reader configuration.
+func (c *ReaderConfig) limits() readLimits {
+	return readLimits{c.MaxUncompressed, c.MaxRatio}
+}
+
+// active reports whether any limit is set.
+func (l readLimits) active() bool {
+	return l.maxUncompressed > 0 || l.maxRatio > 0
+}
+
+// check returns an error if out bytes of uncompressed data produced
+// from in bytes of compressed data exceed the limits.
+func (l readLimits) check(out, in int64) error {
+	if l.maxUncompressed > 0 && out > l.maxUncompressed {
+		return ErrMaxUncompressed
+	}
+	if l.maxRatio > 0 && float64(out) > l.maxRatio*float64(in) {
+		return ErrMaxRatio
+	}
+	return nil
+}
+
+// allowed returns the number of bytes of uncompressed data that may be
+// produced from in bytes of compressed data.
+func (l readLimits) allowed(in int64) int64 {
+	a := int64(maxInt64)
+	if l.maxUncompressed > 0 {
+		a = l.maxUncompressed
+	}
+	if l.maxRatio > 0 {
+		if f := l.maxRatio * float64(in); f < float64(a) {
+			a = int64(f)
+		}
+	}
+	return a
+}
+
+// checkStreams checks the sizes declared by the indexes of the streams
+// against the limits.
+func (l readLimits) checkStreams(streams []streamDesc) error {
+	if len(streams) == 0 {
+		return nil
+	}
+	var out int64
+	for _, s := range streams {
+		for _, rec := range s.index {
+			if rec.uncompressedSize > maxInt64-out {
+				return errors.New("xz: uncompressed size overflow")
+			}
+			out += rec.uncompressedSize
+		}
+	}
+	last := streams[len(streams)-1]
+	return l.check(out, last.offset+last.size+last.padding)
+}
+
+// readProgress tracks the compressed data read by a Reader and the
+// uncompressed size of the blocks completed. It is shared by the
+// stream readers.
+type readProgress struct {
+	ur  unreadReader
+	cxz countingReader
+	// uncompressed size of all blocks completed
+	done int64
+}
+
+// blockUncompressedSize returns the uncompressed size of the next
+// block as declared by the block header or by the index found by
+// scanning a seekable input. It returns -1 if the size isn't known.
+func (r *streamReader) blockUncompressedSize(h *blockHeader) int64 {
+	if h.uncompressedSize >= 0 {
+		return h.uncompressedSize
+	}
+	if i := len(r.index) + len(r.pending); i < len(r.records) {
+		return r.records[i].uncompressedSize
+	}
+	return -1
+}
+
+// checkBlock checks the sizes declared for the next block against the
+// limits. The uncompressed data of the block starts at offset off,
+// which is negative if unknown.
+func (r *streamReader) checkBlock(h *blockHeader, hlen int, off int64) error {
+	size := r.blockUncompressedSize(h)
+	if r.prog == nil || off < 0 || size < 0 {
+		return nil
+	}
+	in := int64(maxInt64)
+	if n := r.blockDataSize(h, hlen); n >= 0 {
+		in = r.prog.cxz.n + n
+	}
+	return r.limits().check(off+size, in)
+}
+
+// addRecord adds the record of a completed block to the index.
+func (r *streamReader) addRecord(rec record) {
+	r.index = append(r.index, rec)
+	if r.prog != nil {
+		r.prog.done += rec.uncompressedSize
+	}
+}
@@ -41,6 +41,13 @@ type binTree struct {
 	root uint32
 	// current x value
 	x uint32
+	// number of nodes checked for matches
+	depth int
+	// length of a match that is accepted without further search
+	niceLen int
+	// maximum number of matches returned by FindMatches; zero means
+	// no limit
+	maxCandidates int
 	// preallocated array
 	data []byte
 }
@@ -63,16 +70,42 @@ func newBinTree(capacity int) (t *binTree, err error) {
 			"newBinTree: capacity must less 2^{32}-1")
 	}
 	t = &binTree{
-		node: make([]node, capacity),
-		hoff: -int64(wordLen),
-		root: null,
-		data: make([]byte, maxMatchLen),
+		node:    make([]node, capacity),
+		hoff:    -int64(wordLen),
+		root:    null,
+		depth:   32,
+		niceLen: maxMatchLen,
+		data:    make([]byte, maxMatchLen),
 	}
 	return t, nil
 }
 
+// setLimits sets the number of nodes checked for matches, the length
+// of a match that is accepted without further search and the maximum
+// number of matches returned by FindMatches. Values less than one are
+// ignored.
+func (t *binTree) setLimits(depth, niceLen, maxCandidates int) {
+	if depth > 0 {
+		t.depth = depth
+	}
+	if niceLen > 0 {
+		t.niceLen = niceLen
+	}
+	if maxCandidates > 0 {
+		t.maxCandidates = maxCandidates
+	}
+}
+
 func (t *binTree) SetDict(d *encoderDict) { t.dict = d }
 
+// Reset removes all nodes from the tree. The allocated memory is kept.
+func (t *binTree) Reset() {
+	t.hoff = -int64(wordLen)
+	t.front = 0
+	t.root = null
+	t.x = 0
+}
+
 // WriteByte writes a single byte into the binary tree.
 func (t *binTree) WriteByte(c byte) error {
 	t.x = (t.x << 8) | uint32(c)
@@ -393,11 +426,15 @@ type matchParams struct {
 	check int
 	// finish if length get shorter
 	stopShorter bool
+	// if not nil all improved matches with a length of at least
+	// minMatchLen are appended
+	ms *[]match
 }
 
 func (t *binTree) match(m match, distIter func() (int, bool), p matchParams,
 ) (r match, checked int, accepted bool) {
 	buf := &t.dict.buf
+	dictLen := t.dict.DictLen()
 	for {
 		if checked >= p.check {
 			return m, checked, true
@@ -407,6 +444,11 @@ func (t *binTree) match(m match, distIter func() (int, bool), p matchParams,
 			return m, checked, false
 		}
 		checked++
+		if dist > dictLen {
+			// The short distances may reach before the start
+			// of the data.
+			continue
+		}
 		if m.n > 0 {
 			i := buf.rear - dist + m.n - 1
 			if i < 0 {
@@ -437,13 +479,45 @@ func (t *binTree) match(m match, distIter func() (int, bool), p matchParams,
 			continue
 		}
 		m = match{int64(dist), n}
+		if p.ms != nil && n >= minMatchLen {
+			*p.ms = append(*p.ms, m)
+		}
 		if n >= p.nAccept {
 			return m, checked, true
 		}
 	}
 }
 
+// NextOp returns the longest match found at the dictionary head. A
+// match using one of the repetition distances is preferred.
 func (t *binTree) NextOp(rep [4]uint32) operation {
+	m := t.bestMatch(matchParams{
+		rep:     rep,
+		nAccept: t.niceLen,
+		check:   t.depth,
+	})
+	if m.n < minMatchLen {
+		// The encoder decides about the short repetition.
+		m = match{}
+	}
+	r := t.dict.repMatch(rep, t.data)
+	return nextOp(m, r, t.data[0])
+}
+
+// FindMatches appends the matches found at the dictionary head to ms.
+func (t *binTree) FindMatches(ms []match) []match {
+	start := len(ms)
+	t.bestMatch(matchParams{
+		nAccept: t.niceLen,
+		check:   t.depth,
+		ms:      &ms,
+	})
+	return limitMatches(ms, start, t.maxCandidates)
+}
+
+// bestMatch searches the longest match at the dictionary head using the
+// parameters p.
+func (t *binTree) bestMatch(p matchParams) match {
 	// retrieve maxMatchLen data
 	n, _ := t.dict.buf.Peek(t.data[:maxMatchLen])
 	if n == 0 {
@@ -456,11 +530,6 @@ func (t *binTree) NextOp(rep [4]uint32) operation {
 		x, u, v            uint32
 		iterPred, iterSucc func() (int, bool)
 	)
-	p := matchParams{
-		rep:     rep,
-		nAccept: maxMatchLen,
-		check:   32,
-	}
 	i := 4
 	iterSmall := func() (dist int, ok bool) {
 		i--
@@ -515,8 +584,5 @@ func (t *binTree) NextOp(rep [4]uint32) operation {
 	}
 	m, _, _ = t.match(m, iterPred, p)
 end:
-	if m.n == 0 {
-		return lit{t.data[0]}
-	}
 	return m
 }
@@ -52,13 +52,13 @@ func newDecoder(br io.ByteReader, state *state, dict *decoderDict, size int64) (
 // Reopen restarts the decoder with a new byte reader and a new size. Reopen
 // resets the Decompressed counter to zero.
 func (d *decoder) Reopen(br io.ByteReader, size int64) error {
-	var err error
-	if d.rd, err = newRangeDecoder(br); err != nil {
+	if err := d.rd.init(br); err != nil {
 		return err
 	}
 	d.start = d.Dict.pos()
 	d.size = size
 	d.eos = false
+	d.eosMarker = false
 	return nil
 }
 
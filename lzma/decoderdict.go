@@ -16,6 +16,42 @@ type decoderDict struct {
 	head int64
 }
 
+// ErrMemLimit reports that the decoding of a stream requires more
+// memory than the configured memory limit allows. The error is returned
+// before the dictionary is allocated.
+type ErrMemLimit struct {
+	// estimated memory required for decoding in bytes
+	Need int64
+	// configured memory limit in bytes
+	Limit int64
+}
+
+// Error returns the error message.
+func (e *ErrMemLimit) Error() string {
+	return fmt.Sprintf("lzma: decoding requires %d bytes of memory;"+
+		" memory limit is %d bytes", e.Need, e.Limit)
+}
+
+// decoderFixedMem is a generous estimate of the memory used by a
+// decoder beside the dictionary and the literal probabilities.
+const decoderFixedMem = 32 * 1024
+
+// decoderMemUsage estimates the memory required by a decoder using a
+// dictionary with the given capacity and the literal parameters lc and
+// lp.
+func decoderMemUsage(dictCap int, lc, lp int) int64 {
+	return int64(dictCap) + 1 + decoderFixedMem + 2*(0x300<<(lc+lp))
+}
+
+// checkMemLimit returns an *ErrMemLimit error if the memory required
+// exceeds the limit. A limit of zero doesn't restrict the memory.
+func checkMemLimit(need, limit int64) error {
+	if limit > 0 && need > limit {
+		return &ErrMemLimit{Need: need, Limit: limit}
+	}
+	return nil
+}
+
 // newDecoderDict creates a new decoder dictionary. The whole dictionary
 // will be used as reader buffer.
 func newDecoderDict(dictCap int) (d *decoderDict, err error) {
@@ -33,6 +69,13 @@ func (d *decoderDict) Reset() {
 	d.head = 0
 }
 
+// clear removes all data from the dictionary including the data that
+// hasn't been read yet.
+func (d *decoderDict) clear() {
+	d.buf.Reset()
+	d.head = 0
+}
+
 // WriteByte writes a single byte into the dictionary. It is used to
 // write literals into the dictionary.
 func (d *decoderDict) WriteByte(c byte) error {
@@ -46,14 +46,14 @@ func (dc *distCodec) deepcopy(src *distCodec) {
 // newDistCodec creates a new distance codec.
 func (dc *distCodec) init() {
 	for i := range dc.posSlotCodecs {
-		dc.posSlotCodecs[i] = makeTreeCodec(posSlotBits)
+		dc.posSlotCodecs[i].init(posSlotBits)
 	}
 	for i := range dc.posModel {
 		posSlot := startPosModel + i
 		bits := (posSlot >> 1) - 1
-		dc.posModel[i] = makeTreeReverseCodec(bits)
+		dc.posModel[i].init(bits)
 	}
-	dc.alignCodec = makeTreeReverseCodec(alignBits)
+	dc.alignCodec.init(alignBits)
 }
 
 // lenState converts the value l to a supported lenState value.
@@ -69,16 +69,7 @@ func lenState(l uint32) uint32 {
 // distance has to be decreased by 1. A distance offset of 0xffffffff (eos)
 // indicates the end of the stream.
 func (dc *distCodec) Encode(e *rangeEncoder, dist uint32, l uint32) (err error) {
-	// Compute the posSlot using nlz32
-	var posSlot uint32
-	var bits uint32
-	if dist < startPosModel {
-		posSlot = dist
-	} else {
-		bits = uint32(30 - nlz32(dist))
-		posSlot = startPosModel - 2 + (bits << 1)
-		posSlot += (dist >> uint(bits)) & 1
-	}
+	posSlot, bits := posSlot(dist)
 
 	if err = dc.posSlotCodecs[lenState(l)].Encode(e, posSlot); err != nil {
 		return
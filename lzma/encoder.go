@@ -43,6 +43,12 @@ type encoder struct {
 	marker bool
 	limit  bool
 	margin int
+	// parser selects the operations
+	parser Parser
+	// length of a match that is encoded without looking further
+	niceLen int
+	// buffers and cached prices of the optimal parser
+	opt *optimalParser
 }
 
 // newEncoder creates a new encoder. If the byte writer must be
@@ -57,12 +63,13 @@ func newEncoder(bw io.ByteWriter, state *state, dict *encoderDict,
 		return nil, err
 	}
 	e = &encoder{
-		dict:   dict,
-		state:  state,
-		re:     re,
-		marker: flags&eosMarker != 0,
-		start:  dict.Pos(),
-		margin: opLenMargin,
+		dict:    dict,
+		state:   state,
+		re:      re,
+		marker:  flags&eosMarker != 0,
+		start:   dict.Pos(),
+		margin:  opLenMargin,
+		niceLen: maxMatchLen,
 	}
 	if e.marker {
 		e.margin += 5
@@ -90,24 +97,42 @@ func (e *encoder) Write(p []byte) (n int, err error) {
 
 // Reopen reopens the encoder with a new byte writer.
 func (e *encoder) Reopen(bw io.ByteWriter) error {
-	var err error
-	if e.re, err = newRangeEncoder(bw); err != nil {
-		return err
-	}
+	e.re.reset(bw)
 	e.start = e.dict.Pos()
 	e.limit = false
+	if e.opt != nil {
+		// The state may have been changed.
+		e.opt.priceAge = 0
+	}
 	return nil
 }
 
-// writeLiteral writes a literal into the LZMA stream
-func (e *encoder) writeLiteral(l lit) error {
+// setParser selects the parser of the encoder. A match of length
+// niceLen will be encoded without looking further ahead.
+func (e *encoder) setParser(p Parser, niceLen int) {
+	e.parser = p
+	if niceLen <= 0 || niceLen > maxMatchLen {
+		niceLen = maxMatchLen
+	}
+	e.niceLen = niceLen
+	if p != OptimalParser {
+		e.opt = nil
+	} else if e.opt == nil {
+		e.opt = newOptimalParser()
+	}
+}
+
+// writeLiteral writes a literal at position pos into the LZMA stream.
+// The position must not be ahead of the dictionary head.
+func (e *encoder) writeLiteral(l lit, pos int64) error {
 	var err error
-	state, state2, _ := e.state.states(e.dict.Pos())
+	state, state2, _ := e.state.states(pos)
 	if err = e.state.isMatch[state2].Encode(e.re, 0); err != nil {
 		return err
 	}
-	litState := e.state.litState(e.dict.ByteAt(1), e.dict.Pos())
-	match := e.dict.ByteAt(int(e.state.rep[0]) + 1)
+	back := int(e.dict.Pos() - pos)
+	litState := e.state.litState(e.dict.ByteAt(back+1), pos)
+	match := e.dict.ByteAt(back + int(e.state.rep[0]) + 1)
 	err = e.state.litCodec.Encode(e.re, l.b, state, match, litState)
 	if err != nil {
 		return err
@@ -125,8 +150,9 @@ func iverson(ok bool) uint32 {
 	return 0
 }
 
-// writeMatch writes a repetition operation into the operation stream
-func (e *encoder) writeMatch(m match) error {
+// writeMatch writes a repetition operation at position pos into the
+// operation stream.
+func (e *encoder) writeMatch(m match, pos int64) error {
 	var err error
 	if !(minDistance <= m.distance && m.distance <= maxDistance) {
 		panic(fmt.Errorf("match distance %d out of range", m.distance))
@@ -138,7 +164,7 @@ func (e *encoder) writeMatch(m match) error {
 			"match length %d out of range; dist %d rep[0] %d",
 			m.n, dist, e.state.rep[0]))
 	}
-	state, state2, posState := e.state.states(e.dict.Pos())
+	state, state2, posState := e.state.states(pos)
 	if err = e.state.isMatch[state2].Encode(e.re, 1); err != nil {
 		return err
 	}
@@ -202,23 +228,79 @@ func (e *encoder) writeMatch(m match) error {
 	return e.state.repLenCodec.Encode(e.re, n, posState)
 }
 
-// writeOp writes a single operation to the range encoder. The function
-// checks whether there is enough space available to close the LZMA
-// stream.
-func (e *encoder) writeOp(op operation) error {
+// writeOp writes a single operation at position pos to the range
+// encoder. The function checks whether there is enough space available
+// to close the LZMA stream.
+func (e *encoder) writeOp(op operation, pos int64) error {
 	if e.re.Available() < int64(e.margin) {
 		return ErrLimit
 	}
 	switch x := op.(type) {
 	case lit:
-		return e.writeLiteral(x)
+		return e.writeLiteral(x, pos)
 	case match:
-		return e.writeMatch(x)
+		return e.writeMatch(x, pos)
 	default:
 		panic("unexpected operation")
 	}
 }
 
+// cheaperOp tests the repetitions and the short repetition at the
+// dictionary head and returns the cheapest operation, which may be op
+// itself. Operations covering at least as many bytes are compared by
+// their price per byte. An operation one byte shorter is compared
+// including the price of a literal for the byte left over.
+func (e *encoder) cheaperOp(op operation) operation {
+	d := e.dict
+	pos := d.Pos()
+	data := d.data[:maxMatchLen]
+	k, _ := d.buf.Peek(data)
+	data = data[:k]
+	best := op
+	// op is only priced if there is an alternative
+	var price uint32
+	priced := false
+	rep := e.state.rep
+	dictLen := d.DictLen()
+	for g, r := range rep {
+		if int(r) >= dictLen || isRepeated(rep, g) {
+			continue
+		}
+		dist := int64(r) + minDistance
+		n := d.buf.matchLen(int(dist), data)
+		if n == 0 || (n == 1 && g > 0) {
+			continue
+		}
+		alts := [2]match{{dist, n}, {dist, 1}}
+		if g > 0 || n == 1 {
+			// The short repetition is only supported for
+			// rep[0].
+			alts[1] = alts[0]
+		}
+		if !priced {
+			price, priced = e.opPrice(best, pos), true
+		}
+		for _, alt := range alts {
+			p := e.opPrice(alt, pos)
+			switch l := best.Len(); {
+			case alt.n >= l:
+				if uint64(p)*uint64(l) >= uint64(price)*uint64(alt.n) {
+					continue
+				}
+			case alt.n+1 == l:
+				q := p + e.opPrice(lit{data[alt.n]}, pos)
+				if q >= price {
+					continue
+				}
+			default:
+				continue
+			}
+			best, price = alt, p
+		}
+	}
+	return best
+}
+
 // compress compressed data from the dictionary buffer. If the flag all
 // is set, all data in the dictionary buffer will be compressed. The
 // function returns ErrLimit if the underlying writer has reached its
@@ -229,10 +311,26 @@ func (e *encoder) compress(flags compressFlags) error {
 		n = maxMatchLen - 1
 	}
 	d := e.dict
+	if e.parser == OptimalParser {
+		for d.Buffered() > n {
+			if err := e.optimize(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if steps := e.parser.lazySteps(); steps > 0 {
+		for d.Buffered() > n {
+			if err := e.compressLazy(n, steps); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	m := d.m
 	for d.Buffered() > n {
-		op := m.NextOp(e.state.rep)
-		if err := e.writeOp(op); err != nil {
+		op := e.cheaperOp(m.NextOp(e.state.rep))
+		if err := e.writeOp(op, d.Pos()); err != nil {
 			return err
 		}
 		d.Discard(op.Len())
@@ -253,7 +351,7 @@ func (e *encoder) Close() error {
 		return err
 	}
 	if e.marker {
-		if err := e.writeMatch(eosMatch); err != nil {
+		if err := e.writeMatch(eosMatch, e.dict.Pos()); err != nil {
 			return err
 		}
 	}
@@ -149,3 +149,37 @@ func TestEncoderCycle2(t *testing.T) {
 		t.Fatalf("got and txt differ")
 	}
 }
+
+// BenchmarkParsers compares the speed and the compression ratio of the
+// parsers using the HashTable4 matcher.
+func BenchmarkParsers(b *testing.B) {
+	buf := new(bytes.Buffer)
+	const txtlen = 1 << 20
+	io.CopyN(buf, randtxt.NewReader(rand.NewSource(42)), txtlen)
+	txt := buf.Bytes()
+	parsers := []Parser{GreedyParser, LazyParser, Lazy2Parser,
+		OptimalParser}
+	for _, p := range parsers {
+		b.Run(p.String(), func(b *testing.B) {
+			cfg := WriterConfig{Matcher: HashTable4, Parser: p}
+			out := new(bytes.Buffer)
+			b.SetBytes(txtlen)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				out.Reset()
+				w, err := cfg.NewWriter(out)
+				if err != nil {
+					b.Fatalf("NewWriter error %s", err)
+				}
+				if _, err = w.Write(txt); err != nil {
+					b.Fatalf("w.Write error %s", err)
+				}
+				if err = w.Close(); err != nil {
+					b.Fatalf("w.Close error %s", err)
+				}
+			}
+			b.ReportMetric(float64(txtlen)/float64(out.Len()),
+				"ratio")
+		})
+	}
+}
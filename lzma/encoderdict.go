@@ -16,6 +16,47 @@ type matcher interface {
 	io.Writer
 	SetDict(d *encoderDict)
 	NextOp(rep [4]uint32) operation
+	// FindMatches appends the matches with a length of at least
+	// minMatchLen found at the dictionary head to ms. Every match
+	// appended is at least as long as the previous one.
+	FindMatches(ms []match) []match
+	// Reset removes all data from the matcher.
+	Reset()
+}
+
+// repMatch returns the longest match of data at the dictionary head
+// using one of the repetition distances. The zero match is returned if
+// no repetition provides a match of at least minMatchLen bytes. The
+// short repetition is left to the encoder, since a literal matching
+// the byte at rep[0] is cheap as well.
+func (d *encoderDict) repMatch(rep [4]uint32, data []byte) match {
+	var m match
+	dictLen := d.DictLen()
+	for g, r := range rep {
+		if int(r) >= dictLen || isRepeated(rep, g) {
+			continue
+		}
+		dist := int(r) + minDistance
+		n := d.buf.matchLen(dist, data)
+		if n > m.n && n >= minMatchLen {
+			m = match{int64(dist), n}
+		}
+	}
+	return m
+}
+
+// nextOp selects the operation returned by NextOp from the longest match
+// m found by the matcher and the repetition match r. The repetition is
+// preferred if it is at least as long, because its distance doesn't
+// need to be encoded. The literal b is returned if there is no match.
+func nextOp(m, r match, b byte) operation {
+	if r.n > 0 && r.n >= m.n {
+		return r
+	}
+	if m.n > 0 {
+		return m
+	}
+	return lit{b}
 }
 
 // encoderDict provides the dictionary of the encoder. It includes an
@@ -49,6 +90,14 @@ func newEncoderDict(dictCap, bufSize int, m matcher) (d *encoderDict, err error)
 	return d, nil
 }
 
+// Reset removes all data from the dictionary and the matcher. The
+// allocated buffers are kept.
+func (d *encoderDict) Reset() {
+	d.buf.Reset()
+	d.head = 0
+	d.m.Reset()
+}
+
 // Discard discards n bytes. Note that n must not be larger than
 // MaxMatchLen.
 func (d *encoderDict) Discard(n int) {
@@ -0,0 +1,137 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The error kinds of a FormatError. They can be tested with errors.Is.
+var (
+	// ErrChecksum indicates a mismatch of a checksum or a check.
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrTruncated indicates that the input ended unexpectedly.
+	ErrTruncated = errors.New("truncated input")
+	// ErrUnsupported indicates a feature of the format that is not
+	// supported, for instance an unknown filter.
+	ErrUnsupported = errors.New("unsupported feature")
+	// ErrCorrupt indicates that the input doesn't follow the format.
+	ErrCorrupt = errors.New("corrupt input")
+)
+
+// FormatError reports a problem with the compressed input. It provides
+// the position of the problem, if known, and the kind of the problem,
+// which is one of ErrChecksum, ErrTruncated, ErrUnsupported and
+// ErrCorrupt.
+type FormatError struct {
+	// offset of the compressed data where the problem has been
+	// detected; -1 if unknown
+	Offset int64
+	// index of the xz stream; -1 if unknown or not applicable
+	Stream int
+	// index of the block in the xz stream; -1 if unknown or not
+	// applicable
+	Block int
+	// one of ErrChecksum, ErrTruncated, ErrUnsupported or ErrCorrupt
+	Kind error
+	// error message
+	Msg string
+	// underlying error, may be nil
+	Err error
+}
+
+// Error returns the error message including the position.
+func (e *FormatError) Error() string {
+	var sb strings.Builder
+	if e.Msg != "" {
+		sb.WriteString(e.Msg)
+	} else {
+		sb.WriteString(e.Kind.Error())
+	}
+	var pos []string
+	if e.Offset >= 0 {
+		pos = append(pos, fmt.Sprintf("offset %d", e.Offset))
+	}
+	if e.Stream >= 0 {
+		pos = append(pos, fmt.Sprintf("stream %d", e.Stream))
+	}
+	if e.Block >= 0 {
+		pos = append(pos, fmt.Sprintf("block %d", e.Block))
+	}
+	if len(pos) > 0 {
+		fmt.Fprintf(&sb, " (%s)", strings.Join(pos, ", "))
+	}
+	return sb.String()
+}
+
+// Unwrap returns the kind and the underlying error.
+func (e *FormatError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// newFormatError converts err into a *FormatError at the given offset.
+// Errors that don't describe a problem of the input, for instance
+// errors of the underlying reader given by readErr or limit errors, are
+// returned unchanged. A *FormatError is copied and gets the offset if
+// it hasn't one.
+func newFormatError(err error, offset int64, readErr error) error {
+	switch {
+	case err == nil, err == io.EOF, err == readErr,
+		err == ErrMaxUncompressed, err == ErrMaxRatio:
+		return err
+	}
+	var e *FormatError
+	if errors.As(err, &e) {
+		f := *e
+		if f.Offset < 0 {
+			f.Offset = offset
+		}
+		return &f
+	}
+	var (
+		m *ErrMemLimit
+		d *ErrDictSize
+	)
+	if errors.As(err, &m) || errors.As(err, &d) {
+		return err
+	}
+	f := &FormatError{
+		Offset: offset,
+		Stream: -1,
+		Block:  -1,
+		Kind:   ErrCorrupt,
+		Msg:    err.Error(),
+		Err:    err,
+	}
+	if err == io.ErrUnexpectedEOF {
+		f.Kind = ErrTruncated
+		f.Msg = "lzma: unexpected end of input"
+	}
+	return f
+}
+
+// countingReader counts the bytes read from the underlying reader and
+// records its last error other than io.EOF.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+// Read reads from the underlying reader.
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
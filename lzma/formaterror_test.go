@@ -0,0 +1,87 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReaderFormatError(t *testing.T) {
+	const file = "examples/a.lzma"
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error %s", file, err)
+	}
+	type test struct {
+		name string
+		data []byte
+		kind error
+	}
+	tests := []test{
+		{"header", data[:HeaderLen-3], ErrTruncated},
+		{"data", data[:len(data)/2], ErrTruncated},
+	}
+	bad, err := filepath.Glob("examples/bad*.lzma")
+	if err != nil {
+		t.Fatalf("filepath.Glob error %s", err)
+	}
+	for _, name := range bad {
+		p, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q) error %s", name, err)
+		}
+		tests = append(tests, test{name, p, ErrCorrupt})
+	}
+	for _, c := range tests {
+		r, err := NewReader(bytes.NewReader(c.data))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if !errors.Is(err, c.kind) {
+			t.Fatalf("%s: got error %v; want %v", c.name, err, c.kind)
+		}
+		var e *FormatError
+		if !errors.As(err, &e) {
+			t.Fatalf("%s: error %v is not a *FormatError", c.name, err)
+		}
+		if !(0 <= e.Offset && e.Offset <= int64(len(c.data))) {
+			t.Fatalf("%s: offset %d out of range", c.name, e.Offset)
+		}
+		if e.Stream != -1 || e.Block != -1 {
+			t.Fatalf("%s: got stream %d and block %d; want -1",
+				c.name, e.Stream, e.Block)
+		}
+	}
+}
+
+func TestReader2FormatError(t *testing.T) {
+	// 0x03 is not a valid chunk header byte.
+	r, err := NewReader2(bytes.NewReader([]byte{0x01, 0x00, 0x00, 'a', 0x03}))
+	if err != nil {
+		t.Fatalf("NewReader2 error %s", err)
+	}
+	_, err = io.ReadAll(r)
+	var e *FormatError
+	if !errors.As(err, &e) || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("io.ReadAll error %v; want corrupt *FormatError", err)
+	}
+	if e.Offset != 5 {
+		t.Fatalf("got offset %d; want 5", e.Offset)
+	}
+
+	r, err = NewReader2(bytes.NewReader([]byte{0x01, 0x00, 0x02, 'a'}))
+	if err != nil {
+		t.Fatalf("NewReader2 error %s", err)
+	}
+	_, err = io.ReadAll(r)
+	if !errors.Is(err, ErrTruncated) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("io.ReadAll error %v; want %v", err, ErrTruncated)
+	}
+}
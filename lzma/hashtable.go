@@ -16,8 +16,8 @@ import (
  * provide this capability.
  */
 
-// maxMatches limits the number of matches requested from the Matches
-// function. This controls the speed of the overall encoding.
+// maxMatches is the default number of positions of the hash chain
+// checked. This controls the speed of the overall encoding.
 const maxMatches = 16
 
 // shortDists defines the number of short distances supported by the
@@ -58,9 +58,16 @@ type hashTable struct {
 	wr hash.Roller
 	// hash roller for computing arbitrary hashes
 	hr hash.Roller
+	// number of positions of the hash chain checked
+	depth int
+	// length of a match that stops the search
+	niceLen int
+	// maximum number of matches returned by FindMatches; zero
+	// means no limit
+	maxCandidates int
 	// preallocated slices
-	p         [maxMatches]int64
-	distances [maxMatches + shortDists]int
+	p         []int64
+	distances []int
 }
 
 // hashTableExponent derives the hash table exponent from the dictionary
@@ -100,11 +107,39 @@ func newHashTable(capacity int, wordLen int) (t *hashTable, err error) {
 		wr:      newRoller(wordLen),
 		hr:      newRoller(wordLen),
 	}
+	t.setLimits(maxMatches, maxMatchLen, 0)
 	return t, nil
 }
 
+// setLimits sets the number of positions of the hash chain checked, the
+// length of a match that stops the search and the maximum number of
+// matches returned by FindMatches. Values less than one are ignored.
+func (t *hashTable) setLimits(depth, niceLen, maxCandidates int) {
+	if depth > 0 {
+		t.depth = depth
+		t.p = make([]int64, depth)
+		t.distances = make([]int, 0, depth+shortDists)
+	}
+	if niceLen > 0 {
+		t.niceLen = niceLen
+	}
+	if maxCandidates > 0 {
+		t.maxCandidates = maxCandidates
+	}
+}
+
 func (t *hashTable) SetDict(d *encoderDict) { t.dict = d }
 
+// Reset removes all entries from the hash table. The allocated memory
+// is kept.
+func (t *hashTable) Reset() {
+	for i := range t.t {
+		t.t[i] = 0
+	}
+	t.front = 0
+	t.hoff = -int64(t.wordLen)
+}
+
 // buffered returns the number of bytes that are currently hashed.
 func (t *hashTable) buffered() int {
 	n := t.hoff + 1
@@ -233,34 +268,41 @@ func (t *hashTable) Matches(p []byte, positions []int64) int {
 	return t.getMatches(h, positions)
 }
 
-// NextOp identifies the next operation using the hash table.
-//
-// TODO: Use all repetitions to find matches.
-func (t *hashTable) NextOp(rep [4]uint32) operation {
+// candidates returns the data at the dictionary head and the distances
+// that may provide a match. The short distances are always included.
+func (t *hashTable) candidates() (data []byte, dists []int) {
 	// get positions
-	data := t.dict.data[:maxMatchLen]
+	data = t.dict.data[:maxMatchLen]
 	n, _ := t.dict.buf.Peek(data)
 	data = data[:n]
 	var p []int64
 	if n < t.wordLen {
 		p = t.p[:0]
 	} else {
-		p = t.p[:maxMatches]
+		p = t.p[:t.depth]
 		n = t.Matches(data[:t.wordLen], p)
 		p = p[:n]
 	}
 
 	// convert positions in potential distances
 	head := t.dict.head
-	dists := append(t.distances[:0], 1, 2, 3, 4, 5, 6, 7, 8)
+	dists = append(t.distances[:0], 1, 2, 3, 4, 5, 6, 7, 8)
 	for _, pos := range p {
 		dis := int(head - pos)
 		if dis > shortDists {
 			dists = append(dists, dis)
 		}
 	}
+	return data, dists
+}
+
+// search calls accept for every match at the dictionary head that is
+// longer than all matches accepted before. Only accepted matches are
+// kept. The search stops if a match of length niceLen has been accepted
+// or if the match covers all data.
+func (t *hashTable) search(data []byte, dists []int,
+	accept func(m match) bool) {
 
-	// check distances
 	var m match
 	dictLen := t.dict.DictLen()
 	for _, dist := range dists {
@@ -285,25 +327,46 @@ func (t *hashTable) NextOp(rep [4]uint32) operation {
 		}
 
 		n := t.dict.buf.matchLen(dist, data)
-		switch n {
-		case 0:
-			continue
-		case 1:
-			if uint32(dist-minDistance) != rep[0] {
-				continue
-			}
-		}
-		if n > m.n {
+		if n > m.n && accept(match{int64(dist), n}) {
 			m = match{int64(dist), n}
-			if n == len(data) {
-				// No better match will be found.
-				break
+			if n == len(data) || n >= t.niceLen {
+				// No better match will be found or the
+				// match is good enough.
+				return
 			}
 		}
 	}
+}
 
-	if m.n == 0 {
-		return lit{data[0]}
+// NextOp identifies the next operation using the hash table. The
+// repetition distances are tested first; the search is skipped if one
+// of them provides a match of length niceLen.
+func (t *hashTable) NextOp(rep [4]uint32) operation {
+	data, dists := t.candidates()
+	r := t.dict.repMatch(rep, data)
+	var m match
+	if r.n < t.niceLen {
+		t.search(data, dists, func(c match) bool {
+			if c.n < minMatchLen {
+				return false
+			}
+			m = c
+			return true
+		})
 	}
-	return m
+	return nextOp(m, r, data[0])
+}
+
+// FindMatches appends the matches found at the dictionary head to ms.
+func (t *hashTable) FindMatches(ms []match) []match {
+	start := len(ms)
+	data, dists := t.candidates()
+	t.search(data, dists, func(m match) bool {
+		if m.n < minMatchLen {
+			return false
+		}
+		ms = append(ms, m)
+		return true
+	})
+	return limitMatches(ms, start, t.maxCandidates)
 }
@@ -107,6 +107,10 @@ func headerChunkType(h byte) (c chunkType, err error) {
 	return
 }
 
+// maxLCLP2 is the maximum sum of the properties lc and lp supported by
+// LZMA2.
+const maxLCLP2 = 4
+
 // uncompressedHeaderLen provides the length of an uncompressed header
 const uncompressedHeaderLen = 3
 
@@ -175,8 +179,14 @@ func (h *chunkHeader) UnmarshalBinary(data []byte) error {
 		return nil
 	}
 
-	h.props, err = PropertiesForCode(data[5])
-	return err
+	if h.props, err = PropertiesForCode(data[5]); err != nil {
+		return err
+	}
+	if h.props.LC+h.props.LP > maxLCLP2 {
+		return errors.New("lzma: sum of lc and lp in LZMA2 chunk " +
+			"exceeds 4")
+	}
+	return nil
 }
 
 // MarshalBinary encodes the chunk header value. The function checks
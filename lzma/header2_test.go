@@ -152,3 +152,20 @@ func TestReadEOS(t *testing.T) {
 		t.Errorf("props got %v; want %v", h.props, wantProps)
 	}
 }
+
+func TestChunkHeaderLCLP(t *testing.T) {
+	h := chunkHeader{
+		ctype:        cLRND,
+		uncompressed: 0x0304,
+		compressed:   0x0201,
+		props:        Properties{LC: 4, LP: 1, PB: 2},
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary for %v error %s", h, err)
+	}
+	var g chunkHeader
+	if err = g.UnmarshalBinary(data); err == nil {
+		t.Fatal("UnmarshalBinary accepted lc+lp > 4")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+/* The lazy parser asks the matcher for the next operation as the greedy
+ * parser does. If a match has been found, it moves the dictionary head
+ * by up to steps positions and asks the matcher again. If a better match
+ * starts at a later position, the match is deferred and the bytes before
+ * the better match are encoded as literals. The operations are written
+ * behind the dictionary head as by the optimal parser.
+ */
+
+// lazySteps returns the number of positions the parser looks ahead for a
+// better match.
+func (p Parser) lazySteps() int {
+	switch p {
+	case LazyParser:
+		return 1
+	case Lazy2Parser:
+		return 2
+	}
+	return 0
+}
+
+// matchGain estimates the bits saved by the operation compared to the
+// encoding of its bytes as literals. A literal costs about 8 bits and
+// the distance of a match about its bit length. The distance of a
+// repetition costs only about 2 bits.
+func matchGain(op operation, rep [4]uint32) int {
+	m, ok := op.(match)
+	if !ok || m.n < minMatchLen {
+		return 0
+	}
+	dist := uint32(m.distance - minDistance)
+	if isRep(rep, dist) {
+		return 8*m.n - 2
+	}
+	return 8*m.n - (32 - nlz32(uint32(m.distance)))
+}
+
+// compressLazy encodes the next match or literal at the dictionary
+// head. A match is deferred if a better match follows within the given
+// number of steps. At least n bytes of lookahead must be buffered.
+func (e *encoder) compressLazy(n, steps int) error {
+	d := e.dict
+	m := d.m
+	pos := d.Pos()
+	cur := e.cheaperOp(m.NextOp(e.state.rep))
+	// The deferred operations must be written without interruption.
+	if e.re.Available() < int64((steps+1)*e.margin) {
+		steps = 0
+	}
+	curPos := pos
+	gain := matchGain(cur, e.state.rep)
+	for k := 1; k <= steps; k++ {
+		if gain == 0 || cur.Len() >= e.niceLen ||
+			pos+int64(k) >= curPos+int64(cur.Len()) ||
+			d.Buffered() <= n+1 {
+			break
+		}
+		d.Discard(1)
+		next := e.cheaperOp(m.NextOp(e.state.rep))
+		if g := matchGain(next, e.state.rep); g > gain {
+			cur, curPos, gain = next, d.Pos(), g
+		}
+	}
+	for p := pos; p < curPos; p++ {
+		err := e.writeOp(lit{d.ByteAt(int(d.Pos() - p))}, p)
+		if err != nil {
+			return err
+		}
+	}
+	if err := e.writeOp(cur, curPos); err != nil {
+		return err
+	}
+	d.Discard(int(curPos + int64(cur.Len()) - d.Pos()))
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestLazyParser(t *testing.T) {
+	data := parserTestData()
+	greedy := compressLZMA(t, WriterConfig{}, data)
+	for _, p := range []Parser{LazyParser, Lazy2Parser} {
+		lazy := compressLZMA(t, WriterConfig{Parser: p}, data)
+		t.Logf("%s: greedy %d lazy %d", p, len(greedy), len(lazy))
+		if len(lazy) >= len(greedy) {
+			t.Fatalf("%s output %d not smaller than greedy parser"+
+				" output %d", p, len(lazy), len(greedy))
+		}
+		compressLZMA(t, WriterConfig{Parser: p}, []byte{'a'})
+		compressLZMA(t, WriterConfig{Parser: p, Matcher: BinaryTree},
+			data)
+	}
+}
+
+func TestLazyParserChunks(t *testing.T) {
+	data := parserTestData()
+	for _, p := range []Parser{LazyParser, Lazy2Parser} {
+		var buf bytes.Buffer
+		cfg := Writer2Config{DictCap: 1 << 16, Parser: p}
+		w, err := cfg.NewWriter2(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter2 error %s", err)
+		}
+		// The flushes interrupt the lookahead.
+		for q := data; len(q) > 0; {
+			k := 1000
+			if k > len(q) {
+				k = len(q)
+			}
+			if _, err = w.Write(q[:k]); err != nil {
+				t.Fatalf("w.Write error %s", err)
+			}
+			q = q[k:]
+			if err = w.Flush(); err != nil {
+				t.Fatalf("w.Flush error %s", err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		r, err := Reader2Config{DictCap: 1 << 16}.NewReader2(&buf)
+		if err != nil {
+			t.Fatalf("NewReader2 error %s", err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("io.ReadAll error %s", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: decompressed data differs", p)
+		}
+	}
+}
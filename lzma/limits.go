@@ -0,0 +1,86 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrMaxUncompressed is returned by the readers if the uncompressed data
+// would exceed the MaxUncompressed limit of the reader configuration.
+var ErrMaxUncompressed = errors.New(
+	"lzma: uncompressed size exceeds MaxUncompressed limit")
+
+// ErrMaxRatio is returned by the readers if the ratio of uncompressed to
+// compressed data would exceed the MaxRatio limit of the reader
+// configuration.
+var ErrMaxRatio = errors.New(
+	"lzma: compression ratio exceeds MaxRatio limit")
+
+// outputLimits provides the limits for the uncompressed data produced
+// by a reader. Zero values mean no limit.
+type outputLimits struct {
+	maxUncompressed int64
+	maxRatio        float64
+}
+
+// verifyOutputLimits checks the limit parameters.
+func verifyOutputLimits(maxUncompressed int64, maxRatio float64) error {
+	if maxUncompressed < 0 {
+		return errors.New("lzma: MaxUncompressed is negative")
+	}
+	if !(maxRatio >= 0) {
+		return errors.New("lzma: MaxRatio is negative or NaN")
+	}
+	return nil
+}
+
+// check returns an error if out bytes of uncompressed data produced
+// from in bytes of compressed data exceed the limits.
+func (l outputLimits) check(out, in int64) error {
+	if l.maxUncompressed > 0 && out > l.maxUncompressed {
+		return ErrMaxUncompressed
+	}
+	if l.maxRatio > 0 && float64(out) > l.maxRatio*float64(in) {
+		return ErrMaxRatio
+	}
+	return nil
+}
+
+// allowed returns the number of bytes of uncompressed data that may be
+// produced from in bytes of compressed data.
+func (l outputLimits) allowed(in int64) int64 {
+	a := int64(maxInt64)
+	if l.maxUncompressed > 0 {
+		a = l.maxUncompressed
+	}
+	if l.maxRatio > 0 {
+		if f := l.maxRatio * float64(in); f < float64(a) {
+			a = int64(f)
+		}
+	}
+	return a
+}
+
+// countingByteReader counts the bytes read from the underlying byte
+// reader and records its last error other than io.EOF.
+type countingByteReader struct {
+	br  io.ByteReader
+	n   int64
+	err error
+}
+
+// ReadByte reads a byte from the underlying reader and counts it.
+func (c *countingByteReader) ReadByte() (b byte, err error) {
+	if b, err = c.br.ReadByte(); err != nil {
+		if err != io.EOF {
+			c.err = err
+		}
+		return 0, err
+	}
+	c.n++
+	return b, nil
+}
@@ -16,10 +16,19 @@ func (c *literalCodec) deepcopy(src *literalCodec) {
 	if c == src {
 		return
 	}
-	c.probs = make([]prob, len(src.probs))
+	c.probs = resizeProbs(c.probs, len(src.probs))
 	copy(c.probs, src.probs)
 }
 
+// resizeProbs returns a slice of length n reusing p if its capacity
+// is sufficient.
+func resizeProbs(p []prob, n int) []prob {
+	if cap(p) >= n {
+		return p[:n]
+	}
+	return make([]prob, n)
+}
+
 // init initializes the literal codec.
 func (c *literalCodec) init(lc, lp int) {
 	switch {
@@ -28,7 +37,7 @@ func (c *literalCodec) init(lc, lp int) {
 	case !(minLP <= lp && lp <= maxLP):
 		panic("lp out of range")
 	}
-	c.probs = make([]prob, 0x300<<uint(lc+lp))
+	c.probs = resizeProbs(c.probs, 0x300<<uint(lc+lp))
 	for i := range c.probs {
 		c.probs[i] = probInit
 	}
@@ -14,12 +14,27 @@ type MatchAlgorithm byte
 const (
 	HashTable4 MatchAlgorithm = iota
 	BinaryTree
+	// HC3 uses a hash chain for 3 bytes and a 2-byte hash.
+	HC3
+	// HC4 uses a hash chain for 4 bytes and 2- and 3-byte hashes.
+	HC4
+	// BT2 uses binary trees for hashes of 2 bytes.
+	BT2
+	// BT3 uses binary trees for 3 bytes and a 2-byte hash.
+	BT3
+	// BT4 uses binary trees for 4 bytes and 2- and 3-byte hashes.
+	BT4
 )
 
 // maStrings are used by the String method.
 var maStrings = map[MatchAlgorithm]string{
 	HashTable4: "HashTable4",
 	BinaryTree: "BinaryTree",
+	HC3:        "HC3",
+	HC4:        "HC4",
+	BT2:        "BT2",
+	BT3:        "BT3",
+	BT4:        "BT4",
 }
 
 // String returns a string representation of the Matcher.
@@ -41,12 +56,75 @@ func (a MatchAlgorithm) verify() error {
 	return nil
 }
 
-func (a MatchAlgorithm) new(dictCap int) (m matcher, err error) {
+// new creates the matcher for the algorithm. The depth limits the number
+// of match candidates checked, a match of length niceLen is accepted
+// without further search and maxCandidates limits the number of
+// matches returned. Zero values select the defaults of the matcher.
+func (a MatchAlgorithm) new(dictCap, depth, niceLen, maxCandidates int,
+) (m matcher, err error) {
 	switch a {
 	case HashTable4:
-		return newHashTable(dictCap, 4)
+		t, err := newHashTable(dictCap, 4)
+		if err != nil {
+			return nil, err
+		}
+		t.setLimits(depth, niceLen, maxCandidates)
+		return t, nil
 	case BinaryTree:
-		return newBinTree(dictCap)
+		t, err := newBinTree(dictCap)
+		if err != nil {
+			return nil, err
+		}
+		t.setLimits(depth, niceLen, maxCandidates)
+		return t, nil
+	case HC3, HC4, BT2, BT3, BT4:
+		f, err := newMatchFinder(dictCap, a.hashBytes(), a >= BT2)
+		if err != nil {
+			return nil, err
+		}
+		f.setLimits(depth, niceLen, maxCandidates)
+		return f, nil
 	}
 	return nil, errUnsupportedMatchAlgorithm
 }
+
+// hashBytes returns the number of bytes hashed by the hash chain and
+// binary tree match finders.
+func (a MatchAlgorithm) hashBytes() int {
+	switch a {
+	case BT2:
+		return 2
+	case HC3, BT3:
+		return 3
+	}
+	return 4
+}
+
+// maxDepth is the largest supported search depth.
+const maxDepth = 1 << 16
+
+// verifyLimits checks the search parameters of the matchers. Zero values
+// select the defaults.
+func verifyLimits(niceLen, depth, maxCandidates int) error {
+	if !(niceLen == 0 || (minMatchLen <= niceLen && niceLen <= maxMatchLen)) {
+		return errors.New("lzma: NiceLen out of range")
+	}
+	if !(0 <= depth && depth <= maxDepth) {
+		return errors.New("lzma: Depth out of range")
+	}
+	if !(0 <= maxCandidates && maxCandidates <= maxMatchLen) {
+		return errors.New("lzma: MaxCandidates out of range")
+	}
+	return nil
+}
+
+// limitMatches keeps only the longest n matches appended to ms after
+// index start. Since the matches are sorted by length, these are the
+// last ones. A value of zero for n doesn't limit the matches.
+func limitMatches(ms []match, start, n int) []match {
+	if n <= 0 || len(ms)-start <= n {
+		return ms
+	}
+	k := copy(ms[start:], ms[len(ms)-n:])
+	return ms[:start+k]
+}
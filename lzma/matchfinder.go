@@ -0,0 +1,562 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"errors"
+	"hash/crc32"
+)
+
+/* The match finders of xz-utils insert every position of the data into
+ * a hash chain or a binary tree. The hash chain links a position to the
+ * previous position with the same hash value of the first bytes. The
+ * binary tree of a hash bucket sorts the positions by the bytes that
+ * follow them. A new position becomes the root of the tree and splits
+ * the old tree in the positions with smaller and larger strings. The
+ * search for the matches at a position and its insertion are done in a
+ * single pass.
+ *
+ * The 4-byte and 3-byte finders keep additional hash tables for the
+ * first 2 and 3 bytes, which provide the last position with the same
+ * bytes and find short matches at small distances.
+ *
+ * Positions are inserted in order. Positions skipped by the encoder are
+ * inserted when the dictionary head is moved over them. A position can
+ * only be inserted if the bytes to hash are in the buffer.
+ */
+
+const (
+	// hash2Bits is the number of bits of the 2-byte hash.
+	hash2Bits = 10
+	// hash3Bits is the number of bits of the 3-byte hash.
+	hash3Bits = 16
+)
+
+// matchFinder implements the hash chain and binary tree match finders.
+// Positions are stored incremented by one as uint32 values, so zero
+// marks an empty entry.
+type matchFinder struct {
+	dict *encoderDict
+	// number of bytes hashed for the main hash table
+	hashBytes int
+	// binary tree or hash chain
+	tree bool
+	// additional hash tables for 2 and 3 bytes
+	hash2 []uint32
+	hash3 []uint32
+	// main hash table and its mask
+	head []uint32
+	mask uint32
+	// hash chain links or pairs of binary tree links
+	son []uint32
+	// number of positions kept in son
+	cyclic int
+	// next position to insert
+	pos int64
+	// number of positions checked
+	depth int
+	// length of a match that stops the search
+	niceLen int
+	// maximum number of matches considered; zero means no limit
+	maxCandidates int
+	// matches found at position msPos
+	ms    []match
+	msPos int64
+}
+
+// newMatchFinder creates a match finder hashing the given number of
+// bytes. The argument tree selects the binary tree instead of the hash
+// chain.
+func newMatchFinder(dictCap int, hashBytes int, tree bool,
+) (f *matchFinder, err error) {
+	if !(1 <= dictCap && int64(dictCap) <= MaxDictCap) {
+		return nil, errors.New(
+			"lzma: dictionary capacity out of range")
+	}
+	if !(2 <= hashBytes && hashBytes <= 4) {
+		return nil, errors.New("lzma: hashBytes out of range")
+	}
+	f = &matchFinder{
+		hashBytes: hashBytes,
+		tree:      tree,
+		cyclic:    dictCap + 1,
+		ms:        make([]match, 0, 32),
+		msPos:     -1,
+	}
+	var hs uint32
+	switch hashBytes {
+	case 2:
+		hs = 1<<16 - 1
+	case 3:
+		hs = 1<<hash3Bits - 1
+		f.hash2 = make([]uint32, 1<<hash2Bits)
+	case 4:
+		// The hash table size is derived from the dictionary
+		// capacity as xz-utils does.
+		hs = uint32(dictCap - 1)
+		hs |= hs >> 1
+		hs |= hs >> 2
+		hs |= hs >> 4
+		hs |= hs >> 8
+		hs >>= 1
+		hs |= 1<<16 - 1
+		if hs > 1<<24 {
+			hs >>= 1
+		}
+		f.hash2 = make([]uint32, 1<<hash2Bits)
+		f.hash3 = make([]uint32, 1<<hash3Bits)
+	}
+	f.head = make([]uint32, int(hs)+1)
+	f.mask = hs
+	n := f.cyclic
+	if tree {
+		n *= 2
+	}
+	f.son = make([]uint32, n)
+	f.setLimits(0, 0, 0)
+	return f, nil
+}
+
+// setLimits sets the search parameters. Zero values select the
+// defaults of xz-utils, which derive the depth from niceLen.
+func (f *matchFinder) setLimits(depth, niceLen, maxCandidates int) {
+	if niceLen > 0 {
+		f.niceLen = niceLen
+	} else if f.niceLen == 0 {
+		f.niceLen = maxMatchLen
+	}
+	if depth > 0 {
+		f.depth = depth
+	} else if f.tree {
+		f.depth = 16 + f.niceLen/2
+	} else {
+		f.depth = 4 + f.niceLen/4
+	}
+	if maxCandidates > 0 {
+		f.maxCandidates = maxCandidates
+	}
+}
+
+// SetDict sets the dictionary of the match finder.
+func (f *matchFinder) SetDict(d *encoderDict) { f.dict = d }
+
+// Reset removes all positions from the match finder. Only the entries
+// of son used by the inserted positions are cleared, which saves work
+// for the large binary trees of the presets.
+func (f *matchFinder) Reset() {
+	n := f.cyclic
+	if f.pos < int64(n) {
+		n = int(f.pos)
+	}
+	if f.tree {
+		n *= 2
+	}
+	for _, s := range [][]uint32{f.hash2, f.hash3, f.head, f.son[:n]} {
+		for i := range s {
+			s[i] = 0
+		}
+	}
+	f.pos = 0
+	f.ms = f.ms[:0]
+	f.msPos = -1
+}
+
+// Write inserts the positions the dictionary head has been moved over.
+// The bytes themselves are read from the dictionary buffer.
+func (f *matchFinder) Write(p []byte) (n int, err error) {
+	f.insert(f.dict.head)
+	return len(p), nil
+}
+
+// avail returns the number of bytes in the buffer starting at position
+// pos.
+func (f *matchFinder) avail(pos int64) int {
+	d := f.dict
+	return int(d.head + int64(d.Buffered()) - pos)
+}
+
+// index returns the index of the byte at position pos in the buffer.
+func (f *matchFinder) index(pos int64) int {
+	b := &f.dict.buf
+	i := b.rear + int(pos-f.dict.head)
+	if i < 0 {
+		i += len(b.data)
+	} else if i >= len(b.data) {
+		i -= len(b.data)
+	}
+	return i
+}
+
+// byteAt returns the byte at position pos.
+func (f *matchFinder) byteAt(pos int64) byte {
+	return f.dict.buf.data[f.index(pos)]
+}
+
+// matchLen returns the length of the match at position cur with the
+// given distance. The first n bytes are known to be equal and the
+// length is limited to limit.
+func (f *matchFinder) matchLen(cur int64, dist int, n, limit int) int {
+	data := f.dict.buf.data
+	i := f.index(cur + int64(n))
+	j := i - dist
+	if j < 0 {
+		j += len(data)
+	}
+	for n < limit && data[i] == data[j] {
+		n++
+		if i++; i == len(data) {
+			i = 0
+		}
+		if j++; j == len(data) {
+			j = 0
+		}
+	}
+	return n
+}
+
+// hashes computes the 2-byte, 3-byte and main hash values for the bytes
+// at position pos.
+func (f *matchFinder) hashes(pos int64) (h2, h3, hv uint32) {
+	c0, c1 := f.byteAt(pos), f.byteAt(pos+1)
+	if f.hashBytes == 2 {
+		return 0, 0, uint32(c0) | uint32(c1)<<8
+	}
+	t := crc32.IEEETable[c0] ^ uint32(c1)
+	h2 = t & (1<<hash2Bits - 1)
+	t ^= uint32(f.byteAt(pos+2)) << 8
+	h3 = t & (1<<hash3Bits - 1)
+	if f.hashBytes == 3 {
+		return h2, 0, h3
+	}
+	hv = (t ^ crc32.IEEETable[f.byteAt(pos+3)]<<5) & f.mask
+	return h2, h3, hv
+}
+
+// slot returns the index of position pos in son.
+func (f *matchFinder) slot(pos int64) int {
+	return int(pos % int64(f.cyclic))
+}
+
+// delta returns the distance of the stored position v from position
+// cur. Zero is returned for an empty entry.
+func delta(cur int64, v uint32) int {
+	if v == 0 {
+		return 0
+	}
+	return int(uint32(cur+1) - v)
+}
+
+// lookahead returns the number of bytes that must be buffered at a
+// position before it can be inserted. The binary trees order the
+// positions by the first niceLen bytes following them. A position
+// inserted with fewer bytes might be placed wrongly, so it is kept
+// pending until enough bytes have been written.
+func (f *matchFinder) lookahead() int {
+	if f.tree && f.niceLen > f.hashBytes {
+		return f.niceLen
+	}
+	return f.hashBytes
+}
+
+// insert inserts the positions before end, for which enough bytes are
+// buffered.
+func (f *matchFinder) insert(end int64) {
+	for f.pos < end && f.avail(f.pos) >= f.lookahead() {
+		f.find(f.pos, nil, false)
+		f.pos++
+	}
+}
+
+// searchLimits returns the maximum length and distance of the matches
+// at position cur.
+func (f *matchFinder) searchLimits(cur int64) (limit, maxDist int) {
+	d := f.dict
+	limit = f.avail(cur)
+	if limit > f.niceLen {
+		limit = f.niceLen
+	}
+	maxDist = int(cur - (d.head - int64(d.DictLen())))
+	return limit, maxDist
+}
+
+// auxMatches appends the matches at position cur found by the 2-byte
+// and 3-byte hash tables to ms. It returns the length of the longest
+// match found or 1.
+func (f *matchFinder) auxMatches(cur int64, h2, h3 uint32, limit,
+	maxDist int, ms []match) (best int, out []match) {
+
+	best = 1
+	var aux [2]uint32
+	if f.hash2 != nil {
+		aux[0] = f.hash2[h2]
+	}
+	if f.hash3 != nil {
+		aux[1] = f.hash3[h3]
+	}
+	for _, a := range aux {
+		dist := delta(cur, a)
+		if !(0 < dist && dist <= maxDist) {
+			continue
+		}
+		if n := f.matchLen(cur, dist, 0, limit); n > best {
+			best = n
+			ms = append(ms, match{int64(dist), n})
+		}
+	}
+	return best, ms
+}
+
+// find inserts position cur and appends the matches found to ms if
+// collect is set. The matches must be at positions inside the
+// dictionary.
+func (f *matchFinder) find(cur int64, ms []match, collect bool) []match {
+	limit, maxDist := f.searchLimits(cur)
+	h2, h3, hv := f.hashes(cur)
+	v := uint32(cur + 1)
+	best := 1
+	if collect {
+		best, ms = f.auxMatches(cur, h2, h3, limit, maxDist, ms)
+		if best >= limit {
+			collect = false
+		}
+	}
+	if f.hash2 != nil {
+		f.hash2[h2] = v
+	}
+	if f.hash3 != nil {
+		f.hash3[h3] = v
+	}
+	first := f.head[hv]
+	f.head[hv] = v
+	if f.tree {
+		return f.treeFind(cur, first, best, limit, maxDist, ms, collect)
+	}
+	f.son[f.slot(cur)] = first
+	if !collect {
+		return ms
+	}
+	return f.chainFind(cur, first, best, limit, maxDist, ms)
+}
+
+// search appends the matches at position cur to ms without inserting
+// the position into the binary trees. It is used for positions that
+// cannot be inserted yet. The pending positions before cur are
+// compared directly.
+func (f *matchFinder) search(cur int64, ms []match) []match {
+	limit, maxDist := f.searchLimits(cur)
+	h2, h3, hv := f.hashes(cur)
+	best, ms := f.auxMatches(cur, h2, h3, limit, maxDist, ms)
+	if best >= limit {
+		return ms
+	}
+	v := f.head[hv]
+	len0, len1 := 0, 0
+	for depth := f.depth; depth > 0; depth-- {
+		dist := delta(cur, v)
+		if !(0 < dist && dist <= maxDist) {
+			break
+		}
+		cand := cur - int64(dist)
+		pair := 2 * f.slot(cand)
+		n := len0
+		if len1 < n {
+			n = len1
+		}
+		if f.byteAt(cand+int64(n)) == f.byteAt(cur+int64(n)) {
+			n = f.matchLen(cur, dist, n+1, limit)
+			if n > best {
+				best = n
+				ms = append(ms, match{int64(dist), n})
+			}
+			if n == limit {
+				break
+			}
+		}
+		if f.byteAt(cand+int64(n)) < f.byteAt(cur+int64(n)) {
+			v = f.son[pair+1]
+			len1 = n
+		} else {
+			v = f.son[pair]
+			len0 = n
+		}
+	}
+	// The pending positions are not in the trees, but there are
+	// less than niceLen of them.
+	for p := f.pos; p < cur && best < limit; p++ {
+		dist := int(cur - p)
+		if dist > maxDist {
+			continue
+		}
+		if n := f.matchLen(cur, dist, 0, limit); n > best {
+			best = n
+			ms = append(ms, match{int64(dist), n})
+		}
+	}
+	return ms
+}
+
+// chainFind follows the hash chain starting with the stored position v
+// and appends every match longer than best to ms.
+func (f *matchFinder) chainFind(cur int64, v uint32, best, limit, maxDist int,
+	ms []match) []match {
+
+	for depth := f.depth; depth > 0; depth-- {
+		dist := delta(cur, v)
+		if !(0 < dist && dist <= maxDist) {
+			break
+		}
+		cand := cur - int64(dist)
+		v = f.son[f.slot(cand)]
+		if f.byteAt(cand+int64(best)) != f.byteAt(cur+int64(best)) {
+			continue
+		}
+		if n := f.matchLen(cur, dist, 0, limit); n > best {
+			best = n
+			ms = append(ms, match{int64(dist), n})
+			if n == limit {
+				break
+			}
+		}
+	}
+	return ms
+}
+
+// treeFind inserts position cur as new root of the binary tree with the
+// root v. The matches longer than best are appended to ms if collect is
+// set.
+func (f *matchFinder) treeFind(cur int64, v uint32, best, limit, maxDist int,
+	ms []match, collect bool) []match {
+
+	s := 2 * f.slot(cur)
+	// ptr0 receives the subtree of larger strings and ptr1 the one
+	// of smaller strings; len0 and len1 are the lengths known to be
+	// equal in these subtrees.
+	ptr0, ptr1 := s+1, s
+	len0, len1 := 0, 0
+	for depth := f.depth; ; depth-- {
+		dist := delta(cur, v)
+		if depth == 0 || !(0 < dist && dist <= maxDist) {
+			f.son[ptr0] = 0
+			f.son[ptr1] = 0
+			return ms
+		}
+		cand := cur - int64(dist)
+		pair := 2 * f.slot(cand)
+		n := len0
+		if len1 < n {
+			n = len1
+		}
+		if f.byteAt(cand+int64(n)) == f.byteAt(cur+int64(n)) {
+			n = f.matchLen(cur, dist, n+1, limit)
+			if n > best {
+				best = n
+				if collect {
+					ms = append(ms, match{int64(dist), n})
+				}
+			}
+			if n == limit {
+				// The candidate is replaced by cur.
+				f.son[ptr1] = f.son[pair]
+				f.son[ptr0] = f.son[pair+1]
+				return ms
+			}
+		}
+		if f.byteAt(cand+int64(n)) < f.byteAt(cur+int64(n)) {
+			f.son[ptr1] = v
+			ptr1 = pair + 1
+			v = f.son[ptr1]
+			len1 = n
+		} else {
+			f.son[ptr0] = v
+			ptr0 = pair
+			v = f.son[ptr0]
+			len0 = n
+		}
+	}
+}
+
+// matches returns the matches found at the dictionary head. The
+// matches are cached, so the head position is inserted only once.
+func (f *matchFinder) matches() []match {
+	head := f.dict.head
+	if f.msPos == head {
+		return f.ms
+	}
+	f.insert(head)
+	f.ms = f.ms[:0]
+	f.msPos = head
+	switch {
+	case f.avail(head) < f.hashBytes:
+		return f.ms
+	case f.pos == head && f.avail(head) >= f.lookahead():
+		f.ms = f.find(head, f.ms, true)
+		f.pos++
+	case f.tree:
+		f.ms = f.search(head, f.ms)
+	default:
+		return f.ms
+	}
+	// extend a match that stopped the search
+	if k := len(f.ms) - 1; k >= 0 {
+		m := &f.ms[k]
+		limit := f.avail(head)
+		if limit > maxMatchLen {
+			limit = maxMatchLen
+		}
+		if m.n == f.niceLen && m.n < limit {
+			m.n = f.matchLen(head, int(m.distance), m.n, limit)
+		}
+	}
+	return f.ms
+}
+
+// candidates returns the longest maxCandidates matches found at the
+// dictionary head.
+func (f *matchFinder) candidates() []match {
+	ms := f.matches()
+	if k := len(ms) - f.maxCandidates; f.maxCandidates > 0 && k > 0 {
+		ms = ms[k:]
+	}
+	return ms
+}
+
+// NextOp returns the longest match found at the dictionary head. The
+// repetition distances are tested first; the search is skipped if one
+// of them provides a match of length niceLen.
+func (f *matchFinder) NextOp(rep [4]uint32) operation {
+	d := f.dict
+	data := d.data[:maxMatchLen]
+	n, _ := d.buf.Peek(data)
+	data = data[:n]
+	r := d.repMatch(rep, data)
+	var m match
+	if r.n < f.niceLen {
+		ms := f.candidates()
+		for k := len(ms) - 1; k >= 0; k-- {
+			if !shortFarMatch(ms[k]) {
+				m = ms[k]
+				break
+			}
+		}
+	}
+	return nextOp(m, r, data[0])
+}
+
+// shortFarMatch checks whether the match is too short for its distance.
+// Encoding it usually costs more than encoding its bytes as literals.
+func shortFarMatch(m match) bool {
+	switch m.n {
+	case 2:
+		return m.distance > 32
+	case 3:
+		return m.distance > 256
+	}
+	return false
+}
+
+// FindMatches appends the matches found at the dictionary head to ms.
+func (f *matchFinder) FindMatches(ms []match) []match {
+	return append(ms, f.candidates()...)
+}
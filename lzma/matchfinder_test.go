@@ -0,0 +1,199 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"testing"
+)
+
+var matchFinders = []MatchAlgorithm{HC3, HC4, BT2, BT3, BT4}
+
+// longestMatch computes the length of the longest match at position pos
+// by brute force.
+func longestMatch(data []byte, pos, dictCap int) int {
+	limit := len(data) - pos
+	if limit > maxMatchLen {
+		limit = maxMatchLen
+	}
+	longest := 0
+	for dist := 1; dist <= dictCap && dist <= pos; dist++ {
+		n := 0
+		for n < limit && data[pos+n] == data[pos-dist+n] {
+			n++
+		}
+		if n > longest {
+			longest = n
+		}
+	}
+	return longest
+}
+
+// checkMatchFinder moves the head over data and checks the matches
+// found at the head. If greedy is set, the head is moved over the
+// longest match, so positions are inserted without search.
+func checkMatchFinder(t *testing.T, a MatchAlgorithm, data []byte,
+	greedy bool) {
+
+	const dictCap = 1 << 12
+	m, err := a.new(dictCap, maxDepth, 0, 0)
+	if err != nil {
+		t.Fatalf("%s: new error %s", a, err)
+	}
+	d, err := newEncoderDict(dictCap, 1000, m)
+	if err != nil {
+		t.Fatalf("newEncoderDict error %s", err)
+	}
+	hashBytes := a.hashBytes()
+	var ms []match
+	written := 0
+	for {
+		// small writes leave positions without enough bytes to
+		// hash
+		k := len(data) - written
+		if k > 7 {
+			k = 7
+		}
+		if k > d.Available() {
+			k = d.Available()
+		}
+		if _, err = d.Write(data[written : written+k]); err != nil {
+			t.Fatalf("d.Write error %s", err)
+		}
+		written += k
+		if d.Buffered() == 0 {
+			break
+		}
+		if d.Buffered() < maxMatchLen && written < len(data) {
+			continue
+		}
+		pos := int(d.Pos())
+		ms = m.FindMatches(ms[:0])
+		n := 0
+		for _, mt := range ms {
+			dist := int(mt.distance)
+			if !(0 < dist && dist <= d.DictLen()) {
+				t.Fatalf("%s: pos %d: distance %d out of range",
+					a, pos, dist)
+			}
+			if mt.n <= n {
+				t.Fatalf("%s: pos %d: length %d not increasing",
+					a, pos, mt.n)
+			}
+			n = mt.n
+			l := 0
+			for l < n && pos+l < written &&
+				data[pos+l] == data[pos-dist+l] {
+				l++
+			}
+			if l != n {
+				t.Fatalf("%s: pos %d: match %v has length %d",
+					a, pos, mt, l)
+			}
+		}
+		w := longestMatch(data[:written], pos, dictCap)
+		if n > w || (w >= hashBytes && n != w) {
+			t.Fatalf("%s: pos %d: longest match %d; want %d",
+				a, pos, n, w)
+		}
+		if greedy && n > 1 {
+			d.Discard(n)
+		} else {
+			d.Discard(1)
+		}
+	}
+}
+
+func TestMatchFinders(t *testing.T) {
+	data := parserTestData()[:12000]
+	for _, a := range matchFinders {
+		checkMatchFinder(t, a, data, false)
+		checkMatchFinder(t, a, data, true)
+	}
+}
+
+func TestMatchFindersEncoding(t *testing.T) {
+	data := parserTestData()
+	ht := compressLZMA(t, WriterConfig{DictCap: 1 << 16}, data)
+	for _, a := range matchFinders {
+		for _, p := range []Parser{GreedyParser, OptimalParser} {
+			cfg := WriterConfig{Matcher: a, Parser: p,
+				DictCap: 1 << 16}
+			c := compressLZMA(t, cfg, data)
+			t.Logf("%s %s: %d bytes; HashTable4 greedy %d bytes",
+				a, p, len(c), len(ht))
+		}
+	}
+	compressLZMA(t, WriterConfig{Matcher: BT4}, nil)
+	compressLZMA(t, WriterConfig{Matcher: HC4}, []byte{'a'})
+}
+
+func TestMatcherLimits(t *testing.T) {
+	data := parserTestData()[:20000]
+	algorithms := append([]MatchAlgorithm{HashTable4, BinaryTree},
+		matchFinders...)
+	for _, a := range algorithms {
+		m, err := a.new(1<<16, 4, 16, 2)
+		if err != nil {
+			t.Fatalf("%s: new error %s", a, err)
+		}
+		d, err := newEncoderDict(1<<16, len(data), m)
+		if err != nil {
+			t.Fatalf("newEncoderDict error %s", err)
+		}
+		if _, err = d.Write(data); err != nil {
+			t.Fatalf("d.Write error %s", err)
+		}
+		var ms []match
+		for d.Buffered() > maxMatchLen {
+			ms = m.FindMatches(ms[:0])
+			if len(ms) > 2 {
+				t.Fatalf("%s: %d matches returned; want at most 2",
+					a, len(ms))
+			}
+			for i := 1; i < len(ms); i++ {
+				if ms[i].n < ms[i-1].n {
+					t.Fatalf("%s: lengths decreasing", a)
+				}
+			}
+			d.Discard(1)
+		}
+		for _, p := range []Parser{GreedyParser, OptimalParser} {
+			compressLZMA(t, WriterConfig{Matcher: a, Parser: p,
+				NiceLen: 16, Depth: 4, MaxCandidates: 2}, data)
+		}
+	}
+}
+
+func TestWriterConfigLimits(t *testing.T) {
+	invalid := []WriterConfig{
+		{NiceLen: 1},
+		{NiceLen: maxMatchLen + 1},
+		{Depth: -1},
+		{Depth: maxDepth + 1},
+		{MaxCandidates: -1},
+		{MaxCandidates: maxMatchLen + 1},
+	}
+	for _, c := range invalid {
+		if err := c.Verify(); err == nil {
+			t.Fatalf("Verify accepted NiceLen %d Depth %d"+
+				" MaxCandidates %d", c.NiceLen, c.Depth,
+				c.MaxCandidates)
+		}
+	}
+	c := Writer2Config{Preset: Preset9, NiceLen: 32, Depth: 7}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.NiceLen != 32 || c.Depth != 7 {
+		t.Fatalf("preset overrides NiceLen or Depth")
+	}
+	c = Writer2Config{Preset: Preset0}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.NiceLen == 0 || c.Depth == 0 {
+		t.Fatalf("preset doesn't set NiceLen and Depth")
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+/* The optimal parser moves the dictionary head over a window of
+ * positions. At every position it prices the literal, the short
+ * repetition, the repetitions and the matches found by the matcher and
+ * records for every position of the window the cheapest sequence of
+ * operations reaching it. The window ends at a position that no
+ * operation crosses, after a match of length niceLen or if the
+ * lookahead or the output space is exhausted. Then the cheapest
+ * sequence is traced back and encoded. The operations are encoded
+ * behind the dictionary head, so the data and the matcher are not
+ * touched twice. This corresponds to the normal mode of xz-utils.
+ */
+
+// optWindow is the maximum number of positions of the window of the
+// optimal parser.
+const optWindow = 1 << 12
+
+// optPriceInterval is the number of bytes encoded until the cached
+// prices of the optimal parser are computed again.
+const optPriceInterval = 1 << 10
+
+// optNode records the cheapest sequence of operations found that
+// reaches a position of the window.
+type optNode struct {
+	price uint32
+	// start of the last operation
+	prev int
+	// last operation; a distance of zero marks a literal
+	distance int64
+	n        int
+	// state and repetition distances after the operation
+	state uint32
+	rep   [4]uint32
+}
+
+// optimalParser provides the buffers and the cached prices of the
+// optimal parser.
+type optimalParser struct {
+	nodes []optNode
+	// end of the nodes reached by operations
+	end int
+	ms  []match
+	ops []optNode
+	// data at the dictionary head
+	data [maxMatchLen]byte
+
+	// cached prices
+	lenPrices     [1 << maxPosBits][maxMatchLen - minMatchLen + 1]uint32
+	repLenPrices  [1 << maxPosBits][maxMatchLen - minMatchLen + 1]uint32
+	posSlotPrices [lenStates][1 << posSlotBits]uint32
+	alignPrices   [1 << alignBits]uint32
+	// number of bytes to encode until the prices are computed again
+	priceAge int
+}
+
+// newOptimalParser creates a new optimal parser.
+func newOptimalParser() *optimalParser {
+	return &optimalParser{
+		nodes: make([]optNode, optWindow+1),
+		ms:    make([]match, 0, 32),
+	}
+}
+
+// updatePrices computes the cached prices from the probabilities of the
+// state.
+func (o *optimalParser) updatePrices(s *state) {
+	for posState := uint32(0); posState <= s.posBitMask; posState++ {
+		lp := &o.lenPrices[posState]
+		rp := &o.repLenPrices[posState]
+		for l := range lp {
+			lp[l] = s.lenCodec.price(uint32(l), posState)
+			rp[l] = s.repLenCodec.price(uint32(l), posState)
+		}
+	}
+	for i := range o.posSlotPrices {
+		tc := &s.distCodec.posSlotCodecs[i]
+		for slot := range o.posSlotPrices[i] {
+			o.posSlotPrices[i][slot] = tc.price(uint32(slot))
+		}
+	}
+	for i := range o.alignPrices {
+		o.alignPrices[i] = s.distCodec.alignCodec.price(uint32(i))
+	}
+	o.priceAge = optPriceInterval
+}
+
+// distPrice returns the price of the distance offset dist for the
+// length offset l using the cached prices.
+func (o *optimalParser) distPrice(dc *distCodec, dist uint32, l uint32,
+) uint32 {
+	slot, bits := posSlot(dist)
+	price := o.posSlotPrices[lenState(l)][slot]
+	switch {
+	case slot < startPosModel:
+		return price
+	case slot < endPosModel:
+		return price + dc.posModel[slot-startPosModel].price(dist)
+	}
+	return price + directPrice(bits-alignBits) +
+		o.alignPrices[dist&(1<<alignBits-1)]
+}
+
+// relax records the operation starting at prev and ending at position i
+// if it provides a cheaper sequence reaching i.
+func (o *optimalParser) relax(i int, price uint32, prev int, distance int64,
+	n int, state uint32, rep [4]uint32) {
+
+	for o.end < i {
+		o.end++
+		o.nodes[o.end].price = infinitePrice
+	}
+	node := &o.nodes[i]
+	if price >= node.price {
+		return
+	}
+	*node = optNode{
+		price:    price,
+		prev:     prev,
+		distance: distance,
+		n:        n,
+		state:    state,
+		rep:      rep,
+	}
+}
+
+// expand prices all operations starting at position i of the window,
+// which is the dictionary head. The operations must not end after
+// maxPos. The function returns the length of the longest repetition or
+// match found.
+func (e *encoder) expand(i, maxPos int) (longest int) {
+	o := e.opt
+	d := e.dict
+	s := e.state
+	cur := o.nodes[i]
+
+	k, _ := d.buf.Peek(o.data[:])
+	data := o.data[:k]
+	limit := len(data)
+	if limit > maxPos-i {
+		limit = maxPos - i
+	}
+	pos := d.Pos()
+	posState := uint32(pos) & s.posBitMask
+	state := cur.state
+	state2 := (state << maxPosBits) | posState
+	dictLen := d.DictLen()
+
+	// literal
+	b := data[0]
+	matchByte := d.ByteAt(int(cur.rep[0]) + 1)
+	price := cur.price + s.isMatch[state2].price(0) +
+		s.litCodec.price(b, state, matchByte,
+			s.litState(d.ByteAt(1), pos))
+	o.relax(i+1, price, i, 0, 1, literalState(state), cur.rep)
+
+	matchPrice := cur.price + s.isMatch[state2].price(1)
+	repPrice := matchPrice + s.isRep[state].price(1)
+
+	// short repetition
+	if int(cur.rep[0]) < dictLen && matchByte == b {
+		price = repPrice + s.isRepG0[state].price(0) +
+			s.isRepG0Long[state2].price(0)
+		o.relax(i+1, price, i, int64(cur.rep[0])+minDistance, 1,
+			shortRepState(state), cur.rep)
+	}
+
+	// repetitions
+	for g := 0; g < 4; g++ {
+		r := cur.rep[g]
+		if int(r) >= dictLen || isRepeated(cur.rep, g) {
+			continue
+		}
+		dist := int(r) + minDistance
+		n := d.buf.matchLen(dist, data[:limit])
+		if n < minMatchLen {
+			continue
+		}
+		if n > longest {
+			longest = n
+		}
+		price = repPrice
+		rep := cur.rep
+		switch g {
+		case 0:
+			price += s.isRepG0[state].price(0) +
+				s.isRepG0Long[state2].price(1)
+		case 1:
+			price += s.isRepG0[state].price(1) +
+				s.isRepG1[state].price(0)
+			rep[0], rep[1] = r, rep[0]
+		default:
+			price += s.isRepG0[state].price(1) +
+				s.isRepG1[state].price(1) +
+				s.isRepG2[state].price(uint32(g-2))
+			if g == 3 {
+				rep[3] = rep[2]
+			}
+			rep[0], rep[1], rep[2] = r, rep[0], rep[1]
+		}
+		next := repState(state)
+		lp := &o.repLenPrices[posState]
+		for l := minMatchLen; l <= n; l++ {
+			o.relax(i+l, price+lp[l-minMatchLen], i, int64(dist), l,
+				next, rep)
+		}
+	}
+
+	// matches
+	o.ms = d.m.FindMatches(o.ms[:0])
+	price = matchPrice + s.isRep[state].price(0)
+	next := matchState(state)
+	lp := &o.lenPrices[posState]
+	l := minMatchLen
+	for _, m := range o.ms {
+		n := m.n
+		if n > limit {
+			n = limit
+		}
+		dist := uint32(m.distance - minDistance)
+		if n < l || isRep(cur.rep, dist) {
+			continue
+		}
+		if n > longest {
+			longest = n
+		}
+		rep := [4]uint32{dist, cur.rep[0], cur.rep[1], cur.rep[2]}
+		var distPrices [lenStates]uint32
+		for ls := range distPrices {
+			distPrices[ls] = o.distPrice(&s.distCodec, dist,
+				uint32(ls))
+		}
+		for ; l <= n; l++ {
+			lo := uint32(l - minMatchLen)
+			o.relax(i+l, price+lp[lo]+distPrices[lenState(lo)], i,
+				m.distance, l, next, rep)
+		}
+	}
+	return longest
+}
+
+// isRep checks whether the distance offset dist is one of the
+// repetition distances.
+func isRep(rep [4]uint32, dist uint32) bool {
+	return rep[0] == dist || rep[1] == dist || rep[2] == dist ||
+		rep[3] == dist
+}
+
+// isRepeated checks whether the repetition distance g is equal to a
+// repetition distance before it. The encoder would use the first one.
+func isRepeated(rep [4]uint32, g int) bool {
+	for h := 0; h < g; h++ {
+		if rep[h] == rep[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// optimize parses a window starting at the dictionary head and encodes
+// the cheapest sequence of operations found. At least n bytes of
+// lookahead must be buffered for each position of the window. ErrLimit
+// is returned if the writer has not enough space left for a single
+// operation.
+func (e *encoder) optimize(n int) error {
+	o := e.opt
+	d := e.dict
+	// The operations of the window must fit into the space
+	// available, so the window cannot be interrupted.
+	maxPos := int(e.re.Available()/int64(e.margin)) - 1
+	if maxPos < 1 {
+		return ErrLimit
+	}
+	if maxPos > optWindow {
+		maxPos = optWindow
+	}
+	if o.priceAge <= 0 {
+		o.updatePrices(e.state)
+	}
+
+	start := d.Pos()
+	o.nodes[0] = optNode{state: e.state.state, rep: e.state.rep}
+	o.end = 0
+	stop := maxPos
+	i := 0
+	for ; i < stop; i++ {
+		if i > 0 && (i == o.end || d.Buffered() <= n) {
+			break
+		}
+		if stop == maxPos {
+			longest := e.expand(i, maxPos)
+			if longest >= e.niceLen {
+				// Encode the long match without looking
+				// into it.
+				stop = i + longest
+			}
+		}
+		d.Discard(1)
+	}
+
+	// trace back the cheapest sequence
+	o.ops = o.ops[:0]
+	for j := i; j > 0; j = o.nodes[j].prev {
+		o.ops = append(o.ops, o.nodes[j])
+	}
+	for k := len(o.ops) - 1; k >= 0; k-- {
+		node := &o.ops[k]
+		pos := start + int64(node.prev)
+		var op operation
+		if node.distance == 0 {
+			op = lit{d.ByteAt(int(d.Pos() - pos))}
+		} else {
+			op = match{node.distance, node.n}
+		}
+		if err := e.writeOp(op, pos); err != nil {
+			return err
+		}
+	}
+	o.priceAge -= i
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+func TestProbPrice(t *testing.T) {
+	p := probInit
+	if n := p.price(0); n != 1<<priceShift {
+		t.Fatalf("price of bit 0 for probInit is %d; want %d", n,
+			1<<priceShift)
+	}
+	if n := p.price(1); n != 1<<priceShift {
+		t.Fatalf("price of bit 1 for probInit is %d; want %d", n,
+			1<<priceShift)
+	}
+	p = 1 << (probbits - 2)
+	if p.price(0) <= p.price(1) {
+		t.Fatalf("price of the unlikely bit is not larger")
+	}
+}
+
+// parserTestData returns structured test data with repetitions at a few
+// different distances.
+func parserTestData() []byte {
+	var buf bytes.Buffer
+	txt := randtxt.NewReader(rand.NewSource(5))
+	for i := 0; i < 200; i++ {
+		io.CopyN(&buf, txt, 200)
+		buf.WriteString(testString[:50+i%100])
+	}
+	return buf.Bytes()
+}
+
+// compressLZMA compresses data with the configuration and checks that
+// the data can be decompressed.
+func compressLZMA(t *testing.T, cfg WriterConfig, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("decompressed data differs")
+	}
+	return buf.Bytes()
+}
+
+func TestOptimalParser(t *testing.T) {
+	data := parserTestData()
+	for _, m := range []MatchAlgorithm{HashTable4, BinaryTree} {
+		greedy := compressLZMA(t, WriterConfig{Matcher: m}, data)
+		optimal := compressLZMA(t, WriterConfig{Matcher: m,
+			Parser: OptimalParser}, data)
+		t.Logf("%s: greedy %d optimal %d", m, len(greedy),
+			len(optimal))
+		if len(optimal) >= len(greedy) {
+			t.Fatalf("%s: optimal parser output %d not smaller"+
+				" than greedy parser output %d", m,
+				len(optimal), len(greedy))
+		}
+	}
+	compressLZMA(t, WriterConfig{Parser: OptimalParser}, nil)
+	compressLZMA(t, WriterConfig{Parser: OptimalParser}, []byte{'a'})
+
+	c := WriterConfig{Parser: 0xff}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Verify accepted unsupported parser")
+	}
+}
+
+func TestOptimalParserChunks(t *testing.T) {
+	// Random data fills the compressed chunks before the
+	// uncompressed limit is reached.
+	var data bytes.Buffer
+	rnd := rand.New(rand.NewSource(9))
+	io.CopyN(&data, rnd, 150000)
+	data.WriteString(strings.Repeat(testString, 200))
+
+	var buf bytes.Buffer
+	cfg := Writer2Config{DictCap: 1 << 16, Parser: OptimalParser}
+	w, err := cfg.NewWriter2(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter2 error %s", err)
+	}
+	if _, err = w.Write(data.Bytes()); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := Reader2Config{DictCap: 1 << 16}.NewReader2(&buf)
+	if err != nil {
+		t.Fatalf("NewReader2 error %s", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(got, data.Bytes()) {
+		t.Fatalf("decompressed data differs")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import "errors"
+
+// Parser identifies the method used by the encoder to select the
+// operations that encode the data.
+type Parser byte
+
+// Supported parsers.
+const (
+	// GreedyParser encodes the longest match found by the matcher
+	// at every position.
+	GreedyParser Parser = iota
+	// OptimalParser looks ahead over a window of positions, prices
+	// literals, matches and repetitions with the current
+	// probabilities of the encoder and encodes the cheapest
+	// sequence of operations. It compresses better than the greedy
+	// parser but is slower.
+	OptimalParser
+	// LazyParser defers a match if the next position provides a
+	// better match and encodes the byte as literal instead.
+	LazyParser
+	// Lazy2Parser checks the next two positions for a better match.
+	Lazy2Parser
+)
+
+// parserStrings are used by the String method.
+var parserStrings = map[Parser]string{
+	GreedyParser:  "GreedyParser",
+	OptimalParser: "OptimalParser",
+	LazyParser:    "LazyParser",
+	Lazy2Parser:   "Lazy2Parser",
+}
+
+// String returns a string representation of the parser.
+func (p Parser) String() string {
+	if s, ok := parserStrings[p]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// verify checks whether the parser value is supported.
+func (p Parser) verify() error {
+	if _, ok := parserStrings[p]; !ok {
+		return errors.New("lzma: unsupported parser value")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Preset selects a set of compression parameters modeled on the presets
+// 0 to 9 of xz-utils. Lower presets compress faster, higher presets
+// compress better and require more memory. The zero value NoPreset
+// selects no preset.
+type Preset byte
+
+// Supported presets.
+const (
+	NoPreset Preset = iota
+	Preset0
+	Preset1
+	Preset2
+	Preset3
+	Preset4
+	Preset5
+	Preset6
+	Preset7
+	Preset8
+	Preset9
+)
+
+// DefaultLevel is the compression level used by the xz tool if no
+// level is given. It corresponds to Preset6.
+const DefaultLevel = 6
+
+// LevelPreset returns the preset for the compression level, which must
+// be in the range 0 to 9.
+func LevelPreset(level int) (p Preset, err error) {
+	if !(0 <= level && level <= 9) {
+		return NoPreset, errors.New("lzma: level out of range")
+	}
+	return Preset0 + Preset(level), nil
+}
+
+// String returns a representation of the preset.
+func (p Preset) String() string {
+	switch {
+	case p == NoPreset:
+		return "NoPreset"
+	case p <= Preset9:
+		return fmt.Sprintf("Preset%d", p-Preset0)
+	}
+	return "unknown"
+}
+
+// verify checks whether the preset is supported.
+func (p Preset) verify() error {
+	if p > Preset9 {
+		return errors.New("lzma: unsupported preset")
+	}
+	return nil
+}
+
+// presetParams contains the parameters selected by a preset. The
+// properties LC=3, LP=0 and PB=2 of all presets are the default
+// properties.
+type presetParams struct {
+	dictCap int
+	matcher MatchAlgorithm
+	parser  Parser
+	// number of match candidates checked by the matcher
+	depth int
+	// length of a match that is accepted without further search
+	niceLen int
+}
+
+// presetDictCapExps provides the exponents of the dictionary capacities
+// for the presets 0 to 9.
+var presetDictCapExps = [10]uint{18, 20, 21, 22, 22, 23, 23, 24, 25, 26}
+
+// presetFastDepths provides the search depths for the presets 0 to 3,
+// which use the fast mode of xz-utils.
+var presetFastDepths = [4]int{4, 8, 24, 48}
+
+// btDepth returns the search depth that xz-utils uses by default for
+// the binary tree match finders.
+func btDepth(niceLen int) int { return 16 + niceLen/2 }
+
+// params returns the parameters for the preset. The extreme flag
+// selects the slower variant of the preset that searches longer. If no
+// preset is selected, the extreme flag applies to Preset6. The return
+// value ok is false if neither a preset nor the extreme variant is
+// selected.
+//
+// The parameters follow xz-utils. The presets 0 to 3 use the fast mode
+// with hash chains and the greedy parser. The presets 4 to 9 and all
+// extreme variants use the normal mode with the BT4 match finder and
+// the optimal parser.
+func (p Preset) params(extreme bool) (pp presetParams, ok bool) {
+	if p == NoPreset {
+		if !extreme {
+			return presetParams{}, false
+		}
+		p = Preset0 + DefaultLevel
+	}
+	if p.verify() != nil {
+		return presetParams{}, false
+	}
+	level := int(p - Preset0)
+	pp = presetParams{dictCap: 1 << presetDictCapExps[level]}
+	if level <= 3 {
+		pp.matcher = HC4
+		if level == 0 {
+			pp.matcher = HC3
+		}
+		pp.parser = GreedyParser
+		pp.depth = presetFastDepths[level]
+		pp.niceLen = maxMatchLen
+		if level <= 1 {
+			pp.niceLen = 128
+		}
+	} else {
+		pp.matcher = BT4
+		pp.parser = OptimalParser
+		switch level {
+		case 4:
+			pp.niceLen = 16
+		case 5:
+			pp.niceLen = 32
+		default:
+			pp.niceLen = 64
+		}
+		pp.depth = btDepth(pp.niceLen)
+	}
+	if extreme {
+		pp.matcher = BT4
+		pp.parser = OptimalParser
+		if level == 3 || level == 5 {
+			pp.niceLen = 192
+			pp.depth = btDepth(pp.niceLen)
+		} else {
+			pp.niceLen = maxMatchLen
+			pp.depth = 512
+		}
+	}
+	return pp, true
+}
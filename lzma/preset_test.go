@@ -0,0 +1,160 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+func TestPresetParams(t *testing.T) {
+	if _, ok := NoPreset.params(false); ok {
+		t.Fatalf("NoPreset returned parameters")
+	}
+	pp, ok := NoPreset.params(true)
+	if !ok {
+		t.Fatalf("extreme variant without preset returned no parameters")
+	}
+	if pp.dictCap != 8<<20 || pp.depth != 512 {
+		t.Fatalf("extreme variant without preset is %+v", pp)
+	}
+	if pp.matcher != BT4 || pp.parser != OptimalParser {
+		t.Fatalf("extreme variant without preset is %+v", pp)
+	}
+	prev := 0
+	for level := 0; level <= 9; level++ {
+		p, err := LevelPreset(level)
+		if err != nil {
+			t.Fatalf("LevelPreset(%d) error %s", level, err)
+		}
+		pp, ok := p.params(false)
+		if !ok {
+			t.Fatalf("%s returned no parameters", p)
+		}
+		if pp.dictCap < prev {
+			t.Fatalf("%s has smaller dictionary than the preset"+
+				" before", p)
+		}
+		prev = pp.dictCap
+		fast := pp.matcher == HC3 || pp.matcher == HC4
+		if fast != (level <= 3) {
+			t.Fatalf("%s uses matcher %s", p, pp.matcher)
+		}
+		if fast && pp.parser != GreedyParser ||
+			!fast && (pp.matcher != BT4 ||
+				pp.parser != OptimalParser) {
+			t.Fatalf("%s uses %s with %s", p, pp.matcher,
+				pp.parser)
+		}
+		if err = verifyLimits(pp.niceLen, pp.depth, 0); err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+	}
+	for _, level := range []int{-1, 10} {
+		if _, err := LevelPreset(level); err == nil {
+			t.Fatalf("LevelPreset(%d) returned no error", level)
+		}
+	}
+	c := WriterConfig{Preset: Preset9 + 1}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Verify accepted unsupported preset")
+	}
+}
+
+func TestPresetConfig(t *testing.T) {
+	c := Writer2Config{Preset: Preset9}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.DictCap != 64<<20 {
+		t.Fatalf("DictCap is %d; want %d", c.DictCap, 64<<20)
+	}
+	c = Writer2Config{Preset: Preset9, DictCap: 1 << 16,
+		Matcher: BinaryTree}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.DictCap != 1<<16 || c.Matcher != BinaryTree {
+		t.Fatalf("preset overrides DictCap or Matcher")
+	}
+	c = Writer2Config{Preset: Preset9, KeepMatcher: true}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.Matcher != HashTable4 || c.Parser != GreedyParser {
+		t.Fatalf("preset overrides Matcher or Parser")
+	}
+	c = Writer2Config{Preset: Preset6}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.Matcher != BT4 || c.Parser != OptimalParser {
+		t.Fatalf("Preset6 uses %s with %s", c.Matcher, c.Parser)
+	}
+	c = Writer2Config{}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.Matcher != HashTable4 || c.Parser != GreedyParser {
+		t.Fatalf("default config uses %s with %s", c.Matcher,
+			c.Parser)
+	}
+}
+
+func TestNewWriterLevel(t *testing.T) {
+	var data bytes.Buffer
+	txt := randtxt.NewReader(rand.NewSource(3))
+	if _, err := io.CopyN(&data, txt, 20000); err != nil {
+		t.Fatalf("io.CopyN error %s", err)
+	}
+	for _, level := range []int{0, 3, 6} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatalf("NewWriterLevel(%d) error %s", level, err)
+		}
+		if _, err = w.Write(data.Bytes()); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("io.ReadAll error %s", err)
+		}
+		if !bytes.Equal(out, data.Bytes()) {
+			t.Fatalf("level %d: data differs", level)
+		}
+	}
+	if _, err := NewWriter2Level(io.Discard, 10); err == nil {
+		t.Fatalf("NewWriter2Level(10) returned no error")
+	}
+}
+
+func TestPresetFlush(t *testing.T) {
+	data := flushTestData()
+	for level := 0; level <= 9; level++ {
+		p, err := LevelPreset(level)
+		if err != nil {
+			t.Fatalf("LevelPreset(%d) error %s", level, err)
+		}
+		for _, extreme := range []bool{false, true} {
+			// The dictionary capacity is reduced to test
+			// data larger than the dictionary.
+			cfg := Writer2Config{Preset: p, Extreme: extreme,
+				DictCap: 1 << 15}
+			flushCompress(t, cfg, data, 4096, int64(level))
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import "math"
+
+// Prices estimate the number of bits required to encode a value with
+// the current probabilities. They are measured in units of 1/16 bit.
+const priceShift = 4
+
+// infinitePrice marks operations that have not been priced.
+const infinitePrice = math.MaxUint32
+
+// probPriceShift defines the number of low bits of a probability value
+// ignored for the price lookup.
+const probPriceShift = 2
+
+// probPrices provides the price for the encoding of a bit with the
+// probability p>>probPriceShift.
+var probPrices [1 << (probbits - probPriceShift)]uint32
+
+func init() {
+	for i := range probPrices {
+		p := (float64(i) + 0.5) / float64(len(probPrices))
+		probPrices[i] = uint32(math.Round(-math.Log2(p) *
+			(1 << priceShift)))
+	}
+}
+
+// price returns the price for encoding the bit b.
+func (p prob) price(b uint32) uint32 {
+	if b == 0 {
+		return probPrices[p>>probPriceShift]
+	}
+	return probPrices[((1<<probbits)-p)>>probPriceShift]
+}
+
+// directPrice returns the price for the direct encoding of the given
+// number of bits.
+func directPrice(bits uint32) uint32 {
+	return bits << priceShift
+}
+
+// price returns the price of the value v for the tree codec.
+func (tc *treeCodec) price(v uint32) uint32 {
+	var price uint32
+	m := uint32(1)
+	for i := int(tc.bits) - 1; i >= 0; i-- {
+		b := (v >> uint(i)) & 1
+		price += tc.probs[m].price(b)
+		m = (m << 1) | b
+	}
+	return price
+}
+
+// price returns the price of the value v for the reverse tree codec.
+func (tc *treeReverseCodec) price(v uint32) uint32 {
+	var price uint32
+	m := uint32(1)
+	for i := uint(0); i < uint(tc.bits); i++ {
+		b := (v >> i) & 1
+		price += tc.probs[m].price(b)
+		m = (m << 1) | b
+	}
+	return price
+}
+
+// price returns the price of the literal s in the given state. It
+// mirrors the Encode method.
+func (c *literalCodec) price(s byte, state uint32, match byte,
+	litState uint32) uint32 {
+
+	k := litState * 0x300
+	probs := c.probs[k : k+0x300]
+	var price uint32
+	symbol := uint32(1)
+	r := uint32(s)
+	if state >= 7 {
+		m := uint32(match)
+		for {
+			matchBit := (m >> 7) & 1
+			m <<= 1
+			bit := (r >> 7) & 1
+			r <<= 1
+			i := ((1 + matchBit) << 8) | symbol
+			price += probs[i].price(bit)
+			symbol = (symbol << 1) | bit
+			if matchBit != bit || symbol >= 0x100 {
+				break
+			}
+		}
+	}
+	for symbol < 0x100 {
+		bit := (r >> 7) & 1
+		r <<= 1
+		price += probs[symbol].price(bit)
+		symbol = (symbol << 1) | bit
+	}
+	return price
+}
+
+// price returns the price of the length offset l for the position
+// state.
+func (lc *lengthCodec) price(l uint32, posState uint32) uint32 {
+	if l < 8 {
+		return lc.choice[0].price(0) + lc.low[posState].price(l)
+	}
+	price := lc.choice[0].price(1)
+	if l < 16 {
+		return price + lc.choice[1].price(0) +
+			lc.mid[posState].price(l-8)
+	}
+	return price + lc.choice[1].price(1) + lc.high.price(l-16)
+}
+
+// opPrice returns the price of the operation at position pos for the
+// current state of the encoder. The position must not be ahead of the
+// dictionary head. A match using a repetition distance is priced as
+// repetition, as it is encoded by writeMatch.
+func (e *encoder) opPrice(op operation, pos int64) uint32 {
+	s := e.state
+	state, state2, posState := s.states(pos)
+	if l, ok := op.(lit); ok {
+		d := e.dict
+		back := int(d.Pos() - pos)
+		matchByte := d.ByteAt(back + int(s.rep[0]) + 1)
+		return s.isMatch[state2].price(0) +
+			s.litCodec.price(l.b, state, matchByte,
+				s.litState(d.ByteAt(back+1), pos))
+	}
+	m := op.(match)
+	price := s.isMatch[state2].price(1)
+	dist := uint32(m.distance - minDistance)
+	g := 0
+	for ; g < 4; g++ {
+		if s.rep[g] == dist {
+			break
+		}
+	}
+	if g == 4 {
+		l := uint32(m.n - minMatchLen)
+		return price + s.isRep[state].price(0) +
+			s.lenCodec.price(l, posState) + s.distCodec.price(dist, l)
+	}
+	price += s.isRep[state].price(1)
+	switch g {
+	case 0:
+		price += s.isRepG0[state].price(0)
+		if m.n == 1 {
+			return price + s.isRepG0Long[state2].price(0)
+		}
+		price += s.isRepG0Long[state2].price(1)
+	case 1:
+		price += s.isRepG0[state].price(1) + s.isRepG1[state].price(0)
+	default:
+		price += s.isRepG0[state].price(1) + s.isRepG1[state].price(1) +
+			s.isRepG2[state].price(uint32(g-2))
+	}
+	return price + s.repLenCodec.price(uint32(m.n-minMatchLen), posState)
+}
+
+// posSlot computes the position slot for the distance offset dist.
+func posSlot(dist uint32) (slot, bits uint32) {
+	if dist < startPosModel {
+		return dist, 0
+	}
+	bits = uint32(30 - nlz32(dist))
+	slot = startPosModel - 2 + (bits << 1)
+	slot += (dist >> uint(bits)) & 1
+	return slot, bits
+}
+
+// price returns the price of the distance offset dist for the length
+// offset l. It mirrors the Encode method.
+func (dc *distCodec) price(dist uint32, l uint32) uint32 {
+	slot, bits := posSlot(dist)
+	price := dc.posSlotCodecs[lenState(l)].price(slot)
+	switch {
+	case slot < startPosModel:
+		return price
+	case slot < endPosModel:
+		return price + dc.posModel[slot-startPosModel].price(dist)
+	}
+	return price + directPrice(bits-alignBits) + dc.alignCodec.price(dist)
+}
@@ -18,6 +18,8 @@ type rangeEncoder struct {
 	low      uint64
 	cacheLen int64
 	cache    byte
+	// limited byte writer used if bw is not a *LimitedByteWriter
+	ownLBW LimitedByteWriter
 }
 
 // maxInt64 provides the  maximal value of the int64 type
@@ -25,14 +27,20 @@ const maxInt64 = 1<<63 - 1
 
 // newRangeEncoder creates a new range encoder.
 func newRangeEncoder(bw io.ByteWriter) (re *rangeEncoder, err error) {
+	re = new(rangeEncoder)
+	re.reset(bw)
+	return re, nil
+}
+
+// reset reinitializes the range encoder for a new byte writer.
+func (e *rangeEncoder) reset(bw io.ByteWriter) {
+	*e = rangeEncoder{nrange: 0xffffffff, cacheLen: 1}
 	lbw, ok := bw.(*LimitedByteWriter)
 	if !ok {
-		lbw = &LimitedByteWriter{BW: bw, N: maxInt64}
+		e.ownLBW = LimitedByteWriter{BW: bw, N: maxInt64}
+		lbw = &e.ownLBW
 	}
-	return &rangeEncoder{
-		lbw:      lbw,
-		nrange:   0xffffffff,
-		cacheLen: 1}, nil
+	e.lbw = lbw
 }
 
 // Available returns the number of bytes that still can be written. The
@@ -134,27 +142,37 @@ type rangeDecoder struct {
 // newRangeDecoder initializes a range decoder. It reads five bytes from the
 // reader and therefore may return an error.
 func newRangeDecoder(br io.ByteReader) (d *rangeDecoder, err error) {
-	d = &rangeDecoder{br: br, nrange: 0xffffffff}
+	d = new(rangeDecoder)
+	if err = d.init(br); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// init initializes the range decoder for the byte reader. It reads
+// five bytes from the reader.
+func (d *rangeDecoder) init(br io.ByteReader) error {
+	*d = rangeDecoder{br: br, nrange: 0xffffffff}
 
 	b, err := d.br.ReadByte()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if b != 0 {
-		return nil, errors.New("newRangeDecoder: first byte not zero")
+		return errors.New("newRangeDecoder: first byte not zero")
 	}
 
 	for i := 0; i < 4; i++ {
 		if err = d.updateCode(); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	if d.code >= d.nrange {
-		return nil, errors.New("newRangeDecoder: d.code >= d.nrange")
+		return errors.New("newRangeDecoder: d.code >= d.nrange")
 	}
 
-	return d, nil
+	return nil
 }
 
 // possiblyAtEnd checks whether the decoder may be at the end of the stream.
@@ -23,6 +23,20 @@ type ReaderConfig struct {
 	// dictionary size. This helps to mitigate problems with mangled
 	// headers.
 	DictCap int
+	// MemLimit limits the memory used by the decoder in bytes. The
+	// reader estimates the memory required before allocating the
+	// dictionary and returns an *ErrMemLimit error if the limit is
+	// exceeded. Zero means no limit.
+	MemLimit int64
+	// MaxUncompressed limits the size of the uncompressed data. If
+	// the header declares a larger size, NewReader returns
+	// ErrMaxUncompressed; otherwise Read returns the error after
+	// providing the data up to the limit. Zero means no limit.
+	MaxUncompressed int64
+	// MaxRatio limits the ratio of the uncompressed data returned to
+	// the compressed data read. Read returns ErrMaxRatio if the
+	// limit is exceeded. Zero means no limit.
+	MaxRatio float64
 }
 
 // fill converts the zero values of the configuration to the default values.
@@ -42,7 +56,10 @@ func (c *ReaderConfig) Verify() error {
 	if !(MinDictCap <= c.DictCap && int64(c.DictCap) <= MaxDictCap) {
 		return errors.New("lzma: dictionary capacity is out of range")
 	}
-	return nil
+	if c.MemLimit < 0 {
+		return errors.New("lzma: memory limit is negative")
+	}
+	return verifyOutputLimits(c.MaxUncompressed, c.MaxRatio)
 }
 
 // Reader provides a reader for LZMA files or streams.
@@ -68,11 +85,18 @@ func (c *ReaderConfig) Verify() error {
 //     memory allocations for the dictionary.
 //   - The code supports stream sizes only up to a pebibyte (1024^5).
 type Reader struct {
+	config ReaderConfig
 	lzma   io.Reader
+	hdata  [HeaderLen]byte
 	header Header
 	// headerOrig stores the original header read from the stream.
 	headerOrig Header
 	d          *decoder
+	// counts the compressed data read after the header
+	cbr    countingByteReader
+	limits outputLimits
+	out    int64
+	err    error
 }
 
 // NewReader creates a new reader for an LZMA stream using the classic
@@ -117,21 +141,50 @@ func (c ReaderConfig) NewReader(lzma io.Reader) (r *Reader, err error) {
 	if err = c.Verify(); err != nil {
 		return nil, err
 	}
-	data := make([]byte, HeaderLen)
+	r = &Reader{config: c}
+	if err = r.init(lzma); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reset discards the state of the reader and prepares it for reading
+// the LZMA stream provided by lzma using the same configuration. The
+// dictionary is reused if it is large enough for the new stream.
+// Reset reads and verifies the header of the stream.
+func (r *Reader) Reset(lzma io.Reader) error {
+	if err := r.init(lzma); err != nil {
+		r.err = err
+		return err
+	}
+	return nil
+}
+
+// init reads the header of the LZMA stream and prepares the decoder.
+// An existing decoder is reused.
+func (r *Reader) init(lzma io.Reader) (err error) {
+	c := &r.config
+	r.lzma = lzma
+	r.out = 0
+	r.err = nil
+	data := r.hdata[:]
 	if _, err := io.ReadFull(lzma, data); err != nil {
-		if err == io.EOF {
-			return nil, errors.New("lzma: unexpected EOF")
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return newFormatError(io.ErrUnexpectedEOF, 0, nil)
 		}
-		return nil, err
+		return err
 	}
-	r = &Reader{lzma: lzma}
 	if err = r.header.unmarshalBinary(data); err != nil {
-		return nil, err
+		return newFormatError(err, 0, nil)
 	}
 	r.headerOrig = r.header
+	r.limits = outputLimits{c.MaxUncompressed, c.MaxRatio}
+	if c.MaxUncompressed > 0 && r.header.Size > c.MaxUncompressed {
+		return ErrMaxUncompressed
+	}
 	dictSize := int64(r.header.DictSize)
 	if int64(c.DictCap) < dictSize {
-		return nil, newErrDictSize(
+		return newErrDictSize(
 			"lzma: header dictionary size %[2]d exceeds configured dictionary capacity %[1]d",
 			c.DictCap, uint32(dictSize),
 		)
@@ -152,9 +205,14 @@ func (c ReaderConfig) NewReader(lzma io.Reader) (r *Reader, err error) {
 	}
 	// Protect against modified or malicious headers.
 	if size > maxStreamSize {
-		return nil, fmt.Errorf(
-			"lzma: stream size %d exceeds a pebibyte (1024^5)",
-			size)
+		return &FormatError{
+			Offset: 0,
+			Stream: -1,
+			Block:  -1,
+			Kind:   ErrUnsupported,
+			Msg: fmt.Sprintf("lzma: stream size %d exceeds "+
+				"a pebibyte (1024^5)", size),
+		}
 	}
 	if dictSize < MinDictCap {
 		dictSize = MinDictCap
@@ -162,16 +220,30 @@ func (c ReaderConfig) NewReader(lzma io.Reader) (r *Reader, err error) {
 
 	r.header.DictSize = uint32(dictSize)
 
-	state := newState(r.header.Properties)
-	dict, err := newDecoderDict(int(dictSize))
-	if err != nil {
-		return nil, err
+	need := decoderMemUsage(int(dictSize), r.header.Properties.LC,
+		r.header.Properties.LP)
+	if err = checkMemLimit(need, c.MemLimit); err != nil {
+		return err
+	}
+
+	r.cbr = countingByteReader{br: ByteReader(lzma)}
+	if r.d != nil && int64(r.d.Dict.buf.Cap()) >= dictSize {
+		r.d.Dict.clear()
+		r.d.State.Properties = r.header.Properties
+		r.d.State.Reset()
+		err = r.d.Reopen(&r.cbr, r.header.Size)
+	} else {
+		state := newState(r.header.Properties)
+		var dict *decoderDict
+		if dict, err = newDecoderDict(int(dictSize)); err != nil {
+			return err
+		}
+		r.d, err = newDecoder(&r.cbr, state, dict, r.header.Size)
 	}
-	r.d, err = newDecoder(ByteReader(lzma), state, dict, r.header.Size)
 	if err != nil {
-		return nil, err
+		return newFormatError(err, HeaderLen+r.cbr.n, r.cbr.err)
 	}
-	return r, nil
+	return nil
 }
 
 // Header returns the header as read from the LZMA stream. It is intended to
@@ -189,5 +261,25 @@ func (r *Reader) EOSMarker() bool {
 
 // Read returns uncompressed data.
 func (r *Reader) Read(p []byte) (n int, err error) {
-	return r.d.Read(p)
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.d.Read(p)
+	in := HeaderLen + r.cbr.n
+	err = newFormatError(err, in, r.cbr.err)
+	if lerr := r.limits.check(r.out+int64(n), in); lerr != nil {
+		a := r.limits.allowed(in) - r.out
+		if a < int64(n) {
+			n = int(a)
+		}
+		if n < 0 {
+			n = 0
+		}
+		err = lerr
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	r.out += int64(n)
+	return n, err
 }
@@ -15,6 +15,20 @@ import (
 // format.
 type Reader2Config struct {
 	DictCap int
+	// MemLimit limits the memory used by the decoder in bytes. The
+	// reader estimates the memory required before allocating the
+	// dictionary and returns an *ErrMemLimit error if the limit is
+	// exceeded. Zero means no limit.
+	MemLimit int64
+	// MaxUncompressed limits the size of the uncompressed data.
+	// Read returns ErrMaxUncompressed before decoding a chunk that
+	// would exceed the limit. Zero means no limit.
+	MaxUncompressed int64
+	// MaxRatio limits the ratio of the uncompressed data to the
+	// compressed data including the chunk headers. Read returns
+	// ErrMaxRatio before decoding a chunk that would exceed the
+	// limit. Zero means no limit.
+	MaxRatio float64
 }
 
 // fill converts the zero values of the configuration to the default values.
@@ -31,7 +45,10 @@ func (c *Reader2Config) Verify() error {
 	if !(MinDictCap <= c.DictCap && int64(c.DictCap) <= MaxDictCap) {
 		return errors.New("lzma: dictionary capacity is out of range")
 	}
-	return nil
+	if c.MemLimit < 0 {
+		return errors.New("lzma: memory limit is negative")
+	}
+	return verifyOutputLimits(c.MaxUncompressed, c.MaxRatio)
 }
 
 // Reader2 supports the reading of LZMA2 chunk sequences. Note that the
@@ -40,6 +57,7 @@ func (c *Reader2Config) Verify() error {
 // an end-of-stream chunk.
 type Reader2 struct {
 	r   io.Reader
+	cr  countingReader
 	err error
 
 	dict        *decoderDict
@@ -48,6 +66,15 @@ type Reader2 struct {
 	chunkReader io.Reader
 
 	cstate chunkState
+	// limited reader for the compressed data of a chunk
+	lr  io.LimitedReader
+	lbr breader
+
+	limits outputLimits
+	// sizes of the uncompressed and compressed data declared by
+	// the chunk headers read so far
+	out int64
+	in  int64
 }
 
 // NewReader2 creates a reader for an LZMA2 chunk sequence.
@@ -60,17 +87,47 @@ func (c Reader2Config) NewReader2(lzma2 io.Reader) (r *Reader2, err error) {
 	if err = c.Verify(); err != nil {
 		return nil, err
 	}
-	r = &Reader2{r: lzma2, cstate: start}
+	// The properties are only known after reading the first chunk,
+	// so the maximum value of lc+lp is assumed.
+	need := decoderMemUsage(c.DictCap, maxLCLP2, 0)
+	if err = checkMemLimit(need, c.MemLimit); err != nil {
+		return nil, err
+	}
+	r = &Reader2{
+		cr:     countingReader{r: lzma2},
+		cstate: start,
+		limits: outputLimits{c.MaxUncompressed, c.MaxRatio},
+	}
+	r.r = &r.cr
+	r.lbr = breader{Reader: &r.lr, p: make([]byte, 1)}
 	r.dict, err = newDecoderDict(c.DictCap)
 	if err != nil {
 		return nil, err
 	}
 	if err = r.startChunk(); err != nil {
-		r.err = err
+		r.err = r.formatError(err)
 	}
 	return r, nil
 }
 
+// Reset discards the state of the reader and prepares it for reading
+// the LZMA2 chunk sequence provided by lzma2 using the same
+// configuration. The dictionary and the decoder are reused. As for
+// NewReader2 errors of the first chunk header are reported by Read, so
+// the error returned is always nil.
+func (r *Reader2) Reset(lzma2 io.Reader) error {
+	r.cr = countingReader{r: lzma2}
+	r.err = nil
+	r.dict.clear()
+	r.chunkReader = nil
+	r.cstate = start
+	r.out, r.in = 0, 0
+	if err := r.startChunk(); err != nil {
+		r.err = r.formatError(err)
+	}
+	return nil
+}
+
 // uncompressed tests whether the chunk type specifies an uncompressed
 // chunk.
 func uncompressed(ctype chunkType) bool {
@@ -94,10 +151,20 @@ func (r *Reader2) startChunk() error {
 	if r.cstate == stop {
 		return io.EOF
 	}
+	size := int64(header.uncompressed) + 1
+	r.out += size
+	r.in += int64(headerLen(header.ctype))
+	if uncompressed(header.ctype) {
+		r.in += size
+	} else {
+		r.in += int64(header.compressed) + 1
+	}
+	if err = r.limits.check(r.out, r.in); err != nil {
+		return err
+	}
 	if header.ctype == cUD || header.ctype == cLRND {
 		r.dict.Reset()
 	}
-	size := int64(header.uncompressed) + 1
 	if uncompressed(header.ctype) {
 		if r.ur != nil {
 			r.ur.Reopen(r.r, size)
@@ -107,7 +174,8 @@ func (r *Reader2) startChunk() error {
 		r.chunkReader = r.ur
 		return nil
 	}
-	br := ByteReader(io.LimitReader(r.r, int64(header.compressed)+1))
+	r.lr = io.LimitedReader{R: r.r, N: int64(header.compressed) + 1}
+	br := &r.lbr
 	if r.decoder == nil {
 		state := newState(header.props)
 		r.decoder, err = newDecoder(br, state, r.dict, size)
@@ -121,7 +189,8 @@ func (r *Reader2) startChunk() error {
 	case cLR:
 		r.decoder.State.Reset()
 	case cLRN, cLRND:
-		r.decoder.State = newState(header.props)
+		r.decoder.State.Properties = header.props
+		r.decoder.State.Reset()
 	}
 	err = r.decoder.Reopen(br, size)
 	if err != nil {
@@ -147,17 +216,24 @@ func (r *Reader2) Read(p []byte) (n int, err error) {
 					continue
 				}
 			}
-			r.err = err
-			return n, err
+			r.err = r.formatError(err)
+			return n, r.err
 		}
 		if k == 0 {
-			r.err = errors.New("lzma: Reader2 doesn't get data")
+			r.err = r.formatError(
+				errors.New("lzma: Reader2 doesn't get data"))
 			return n, r.err
 		}
 	}
 	return n, nil
 }
 
+// formatError converts errors caused by the input into a *FormatError
+// providing the offset in the LZMA2 chunk sequence.
+func (r *Reader2) formatError(err error) error {
+	return newFormatError(err, r.cr.n, r.cr.err)
+}
+
 // EOS returns whether the LZMA2 stream has been terminated by an
 // end-of-stream chunk.
 func (r *Reader2) EOS() bool {
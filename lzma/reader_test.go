@@ -7,6 +7,7 @@ package lzma
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
@@ -393,3 +394,134 @@ func TestZeroPrefixIssue(t *testing.T) {
 		})
 	}
 }
+
+func TestReaderMemLimit(t *testing.T) {
+	const file = "examples/a.txt"
+	uncompressed, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error %s", file, err)
+	}
+	buf := new(bytes.Buffer)
+	w, err := WriterConfig{DictCap: 1 << 20}.NewWriter(buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(uncompressed); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	compressed := buf.Bytes()
+
+	_, err = ReaderConfig{MemLimit: 1 << 19}.NewReader(
+		bytes.NewReader(compressed))
+	var e *ErrMemLimit
+	if !errors.As(err, &e) {
+		t.Fatalf("NewReader returned error %v; want *ErrMemLimit", err)
+	}
+	if e.Need <= 1<<20 || e.Limit != 1<<19 {
+		t.Fatalf("ErrMemLimit %+v; want Need > %d and Limit %d",
+			*e, 1<<20, 1<<19)
+	}
+	r, err := ReaderConfig{MemLimit: 2 << 20}.NewReader(
+		bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	u, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(u, uncompressed) {
+		t.Fatalf("decompressed data differs")
+	}
+
+	_, err = Reader2Config{DictCap: 1 << 20, MemLimit: 1 << 19}.NewReader2(
+		bytes.NewReader(nil))
+	if !errors.As(err, &e) {
+		t.Fatalf("NewReader2 returned error %v; want *ErrMemLimit", err)
+	}
+	if err = (&ReaderConfig{MemLimit: -1}).Verify(); err == nil {
+		t.Fatal("Verify accepted negative memory limit")
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	const file = "examples/a.txt"
+	uncompressed, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error %s", file, err)
+	}
+	max := int64(len(uncompressed)) / 2
+	for _, sizeInHeader := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		var cfg WriterConfig
+		if sizeInHeader {
+			cfg.Size = int64(len(uncompressed))
+		}
+		w, err := cfg.NewWriter(buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write(uncompressed); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		rcfg := ReaderConfig{MaxUncompressed: max}
+		r, err := rcfg.NewReader(bytes.NewReader(buf.Bytes()))
+		if sizeInHeader {
+			if err != ErrMaxUncompressed {
+				t.Fatalf("NewReader returned error %v; want %v",
+					err, ErrMaxUncompressed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		u, err := io.ReadAll(r)
+		if err != ErrMaxUncompressed {
+			t.Fatalf("io.ReadAll returned error %v; want %v",
+				err, ErrMaxUncompressed)
+		}
+		if !bytes.Equal(u, uncompressed[:max]) {
+			t.Fatalf("got %d bytes; want %d", len(u), max)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := NewWriter2(buf)
+	if err != nil {
+		t.Fatalf("NewWriter2 error %s", err)
+	}
+	if _, err = w.Write(make([]byte, 1<<20)); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := Reader2Config{MaxRatio: 100}.NewReader2(
+		bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader2 error %s", err)
+	}
+	if _, err = io.ReadAll(r); err != ErrMaxRatio {
+		t.Fatalf("io.ReadAll returned error %v; want %v", err,
+			ErrMaxRatio)
+	}
+	r, err = Reader2Config{MaxUncompressed: 1 << 20}.NewReader2(
+		bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader2 error %s", err)
+	}
+	u, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if len(u) != 1<<20 {
+		t.Fatalf("got %d bytes; want %d", len(u), 1<<20)
+	}
+}
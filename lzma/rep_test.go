@@ -0,0 +1,143 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// recordTestData returns structured data consisting of fixed-size
+// records with slowly changing fields. Many matches use the record size
+// or a multiple of it as distance.
+func recordTestData() []byte {
+	var buf bytes.Buffer
+	rnd := rand.New(rand.NewSource(2))
+	var rec [16]byte
+	for i := 0; i < 10000; i++ {
+		binary.LittleEndian.PutUint32(rec[0:], uint32(i))
+		binary.LittleEndian.PutUint32(rec[4:],
+			uint32(1700000000+3*i+rnd.Intn(3)))
+		binary.LittleEndian.PutUint16(rec[8:], uint16(rnd.Intn(4)))
+		binary.LittleEndian.PutUint16(rec[10:], uint16(500+rnd.Intn(8)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(rnd.Intn(3)))
+		buf.Write(rec[:])
+	}
+	return buf.Bytes()
+}
+
+var allMatchAlgorithms = []MatchAlgorithm{HashTable4, BinaryTree, HC3, HC4,
+	BT2, BT3, BT4}
+
+func TestNextOpRepetitions(t *testing.T) {
+	data := recordTestData()
+	for _, a := range allMatchAlgorithms {
+		m, err := a.new(1<<16, 0, 0, 0)
+		if err != nil {
+			t.Fatalf("%s: new error %s", a, err)
+		}
+		d, err := newEncoderDict(1<<16, len(data), m)
+		if err != nil {
+			t.Fatalf("newEncoderDict error %s", err)
+		}
+		if _, err = d.Write(data); err != nil {
+			t.Fatalf("d.Write error %s", err)
+		}
+		s := newState(Properties{LC: 3, LP: 0, PB: 2})
+		var buf [maxMatchLen]byte
+		reps := 0
+		for d.Buffered() > 0 {
+			k, _ := d.buf.Peek(buf[:])
+			r := d.repMatch(s.rep, buf[:k])
+			op := m.NextOp(s.rep)
+			if op.Len() < r.n {
+				t.Fatalf("%s: pos %d: operation %v shorter than"+
+					" repetition %v", a, d.Pos(), op, r)
+			}
+			x, ok := op.(match)
+			if ok && int(x.distance) > d.DictLen() {
+				t.Fatalf("%s: pos %d: distance %d out of range",
+					a, d.Pos(), x.distance)
+			}
+			if ok && x.n >= minMatchLen {
+				dist := uint32(x.distance - minDistance)
+				if isRep(s.rep, dist) {
+					reps++
+				}
+				if s.rep[0] != dist {
+					s.rep = [4]uint32{dist, s.rep[0],
+						s.rep[1], s.rep[2]}
+				}
+			}
+			d.Discard(op.Len())
+		}
+		if reps == 0 {
+			t.Fatalf("%s: no repetitions returned", a)
+		}
+	}
+}
+
+// compressLongest compresses data by encoding the longest match found
+// by the matcher at every position without testing the repetitions.
+func compressLongest(t *testing.T, a MatchAlgorithm, data []byte) []byte {
+	const dictCap = 1 << 20
+	m, err := a.new(dictCap, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("%s: new error %s", a, err)
+	}
+	d, err := newEncoderDict(dictCap, len(data)+1, m)
+	if err != nil {
+		t.Fatalf("newEncoderDict error %s", err)
+	}
+	if _, err = d.Write(data); err != nil {
+		t.Fatalf("d.Write error %s", err)
+	}
+	var buf bytes.Buffer
+	e, err := newEncoder(&buf, newState(Properties{LC: 3, LP: 0, PB: 2}),
+		d, eosMarker)
+	if err != nil {
+		t.Fatalf("newEncoder error %s", err)
+	}
+	var ms []match
+	for d.Buffered() > 0 {
+		ms = m.FindMatches(ms[:0])
+		var op operation
+		if k := len(ms); k > 0 {
+			op = ms[k-1]
+		} else {
+			var b [1]byte
+			d.buf.Peek(b[:])
+			op = lit{b[0]}
+		}
+		if err = e.writeOp(op, d.Pos()); err != nil {
+			t.Fatalf("writeOp error %s", err)
+		}
+		d.Discard(op.Len())
+	}
+	if err = e.Close(); err != nil {
+		t.Fatalf("e.Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRepetitionGain(t *testing.T) {
+	data := recordTestData()
+	for _, a := range []MatchAlgorithm{HashTable4, HC4, BT4} {
+		longest := compressLongest(t, a, data)
+		for _, p := range []Parser{GreedyParser, LazyParser} {
+			c := compressLZMA(t, WriterConfig{Matcher: a, Parser: p,
+				DictCap: 1 << 20}, data)
+			t.Logf("%s %s: %d bytes; longest matches %d bytes",
+				a, p, len(c), len(longest))
+			// require a gain of at least 1 %
+			if 100*len(c) > 99*len(longest) {
+				t.Fatalf("%s %s: output %d not smaller than"+
+					" %d", a, p, len(c), len(longest))
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lzma
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+// resetMessages returns small messages for the Reset tests.
+func resetMessages() [][]byte {
+	txt := randtxt.NewReader(rand.NewSource(5))
+	var msgs [][]byte
+	for _, n := range []int64{1000, 0, 10, 5000, 300} {
+		var buf bytes.Buffer
+		io.CopyN(&buf, txt, n)
+		msgs = append(msgs, buf.Bytes())
+	}
+	return msgs
+}
+
+func TestWriterReset(t *testing.T) {
+	msgs := resetMessages()
+	cfg := WriterConfig{DictCap: 1 << 16}
+	var w *Writer
+	for i, msg := range msgs {
+		var buf, want bytes.Buffer
+		var err error
+		if w == nil {
+			w, err = cfg.NewWriter(&buf)
+		} else {
+			err = w.Reset(&buf)
+		}
+		if err != nil {
+			t.Fatalf("message %d: NewWriter or Reset error %s", i, err)
+		}
+		if _, err = w.Write(msg); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		fw, err := cfg.NewWriter(&want)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = fw.Write(msg); err != nil {
+			t.Fatalf("fw.Write error %s", err)
+		}
+		if err = fw.Close(); err != nil {
+			t.Fatalf("fw.Close error %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Fatalf("message %d: output differs from new writer", i)
+		}
+	}
+}
+
+func TestReaderReset(t *testing.T) {
+	msgs := resetMessages()
+	var streams [][]byte
+	for i, msg := range msgs {
+		// vary the dictionary size and the properties
+		cfg := WriterConfig{
+			DictCap:    1 << (12 + 2*i),
+			Properties: &Properties{LC: i % 4, LP: i % 2, PB: 2},
+			Size:       int64(len(msg)),
+		}
+		if len(msg) == 0 {
+			cfg.Size = 0
+		}
+		var buf bytes.Buffer
+		w, err := cfg.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = w.Write(msg); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		streams = append(streams, buf.Bytes())
+	}
+	var r *Reader
+	for i, s := range streams {
+		var err error
+		if r == nil {
+			r, err = NewReader(bytes.NewReader(s))
+		} else {
+			err = r.Reset(bytes.NewReader(s))
+		}
+		if err != nil {
+			t.Fatalf("stream %d: NewReader or Reset error %s", i, err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("stream %d: io.ReadAll error %s", i, err)
+		}
+		if !bytes.Equal(data, msgs[i]) {
+			t.Fatalf("stream %d: data differs", i)
+		}
+	}
+	if err := r.Reset(bytes.NewReader(streams[0][:5])); err == nil {
+		t.Fatalf("Reset with truncated header returned no error")
+	}
+	if _, err := r.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("Read after failed Reset returned no error")
+	}
+}
+
+func TestWriter2Reset(t *testing.T) {
+	msgs := resetMessages()
+	cfg := Writer2Config{DictCap: 1 << 16}
+	var w *Writer2
+	var r *Reader2
+	for i, msg := range msgs {
+		var buf, want bytes.Buffer
+		var err error
+		if w == nil {
+			w, err = cfg.NewWriter2(&buf)
+		} else {
+			err = w.Reset(&buf)
+		}
+		if err != nil {
+			t.Fatalf("message %d: NewWriter2 or Reset error %s", i, err)
+		}
+		if _, err = w.Write(msg); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		fw, err := cfg.NewWriter2(&want)
+		if err != nil {
+			t.Fatalf("NewWriter2 error %s", err)
+		}
+		if _, err = fw.Write(msg); err != nil {
+			t.Fatalf("fw.Write error %s", err)
+		}
+		if err = fw.Close(); err != nil {
+			t.Fatalf("fw.Close error %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Fatalf("message %d: output differs from new writer", i)
+		}
+
+		if r == nil {
+			r, err = Reader2Config{DictCap: 1 << 16}.NewReader2(&buf)
+		} else {
+			err = r.Reset(&buf)
+		}
+		if err != nil {
+			t.Fatalf("NewReader2 or Reset error %s", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("message %d: io.ReadAll error %s", i, err)
+		}
+		if !bytes.Equal(data, msg) {
+			t.Fatalf("message %d: data differs", i)
+		}
+	}
+}
+
+// benchmarkReset compresses and decompresses small messages reusing
+// the writer and the reader.
+func benchmarkReset(b *testing.B, size int) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(7)), int64(size))
+	msg := buf.Bytes()
+	var z bytes.Buffer
+	w, err := WriterConfig{DictCap: 1 << 16}.NewWriter(&z)
+	if err != nil {
+		b.Fatalf("NewWriter error %s", err)
+	}
+	var zr bytes.Reader
+	var r *Reader
+	p := make([]byte, size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		z.Reset()
+		if err = w.Reset(&z); err != nil {
+			b.Fatalf("w.Reset error %s", err)
+		}
+		if _, err = w.Write(msg); err != nil {
+			b.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			b.Fatalf("w.Close error %s", err)
+		}
+		zr.Reset(z.Bytes())
+		if r == nil {
+			r, err = NewReader(&zr)
+		} else {
+			err = r.Reset(&zr)
+		}
+		if err != nil {
+			b.Fatalf("NewReader or Reset error %s", err)
+		}
+		if _, err = io.ReadFull(r, p); err != nil {
+			b.Fatalf("io.ReadFull error %s", err)
+		}
+	}
+}
+
+func BenchmarkReset(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			benchmarkReset(b, size)
+		})
+	}
+}
@@ -36,11 +36,10 @@ func initProbSlice(p []prob) {
 // Reset sets all state information to the original values.
 func (s *state) Reset() {
 	p := s.Properties
-	*s = state{
-		Properties: p,
-		// dict:       s.dict,
-		posBitMask: (uint32(1) << uint(p.PB)) - 1,
-	}
+	// The probability slices of the codecs are reused.
+	s.rep = [4]uint32{}
+	s.state = 0
+	s.posBitMask = (uint32(1) << uint(p.PB)) - 1
 	initProbSlice(s.isMatch[:])
 	initProbSlice(s.isRep[:])
 	initProbSlice(s.isRepG0[:])
@@ -88,46 +87,53 @@ func cloneState(src *state) *state {
 	return s
 }
 
-// updateStateLiteral updates the state for a literal.
-func (s *state) updateStateLiteral() {
+// literalState returns the state following a literal.
+func literalState(s uint32) uint32 {
 	switch {
-	case s.state < 4:
-		s.state = 0
-		return
-	case s.state < 10:
-		s.state -= 3
-		return
+	case s < 4:
+		return 0
+	case s < 10:
+		return s - 3
 	}
-	s.state -= 6
+	return s - 6
 }
 
-// updateStateMatch updates the state for a match.
-func (s *state) updateStateMatch() {
-	if s.state < 7 {
-		s.state = 7
-	} else {
-		s.state = 10
+// matchState returns the state following a simple match.
+func matchState(s uint32) uint32 {
+	if s < 7 {
+		return 7
 	}
+	return 10
 }
 
-// updateStateRep updates the state for a repetition.
-func (s *state) updateStateRep() {
-	if s.state < 7 {
-		s.state = 8
-	} else {
-		s.state = 11
+// repState returns the state following a repetition.
+func repState(s uint32) uint32 {
+	if s < 7 {
+		return 8
 	}
+	return 11
 }
 
-// updateStateShortRep updates the state for a short repetition.
-func (s *state) updateStateShortRep() {
-	if s.state < 7 {
-		s.state = 9
-	} else {
-		s.state = 11
+// shortRepState returns the state following a short repetition.
+func shortRepState(s uint32) uint32 {
+	if s < 7 {
+		return 9
 	}
+	return 11
 }
 
+// updateStateLiteral updates the state for a literal.
+func (s *state) updateStateLiteral() { s.state = literalState(s.state) }
+
+// updateStateMatch updates the state for a match.
+func (s *state) updateStateMatch() { s.state = matchState(s.state) }
+
+// updateStateRep updates the state for a repetition.
+func (s *state) updateStateRep() { s.state = repState(s.state) }
+
+// updateStateShortRep updates the state for a short repetition.
+func (s *state) updateStateShortRep() { s.state = shortRepState(s.state) }
+
 // states computes the states of the operation codec.
 func (s *state) states(dictHead int64) (state1, state2, posState uint32) {
 	state1 = s.state
@@ -10,12 +10,6 @@ type treeCodec struct {
 	probTree
 }
 
-// makeTreeCodec makes a tree codec. The bits value must be inside the range
-// [1,32].
-func makeTreeCodec(bits int) treeCodec {
-	return treeCodec{makeProbTree(bits)}
-}
-
 // deepcopy initializes tc as a deep copy of the source.
 func (tc *treeCodec) deepcopy(src *treeCodec) {
 	tc.probTree.deepcopy(&src.probTree)
@@ -60,12 +54,6 @@ func (tc *treeReverseCodec) deepcopy(src *treeReverseCodec) {
 	tc.probTree.deepcopy(&src.probTree)
 }
 
-// makeTreeReverseCodec creates treeReverseCodec value. The bits argument must
-// be in the range [1,32].
-func makeTreeReverseCodec(bits int) treeReverseCodec {
-	return treeReverseCodec{makeProbTree(bits)}
-}
-
 // Encode uses range encoder to encode a fixed-bit-size value. The range
 // encoder may cause errors.
 func (tc *treeReverseCodec) Encode(v uint32, e *rangeEncoder) (err error) {
@@ -107,24 +95,20 @@ func (t *probTree) deepcopy(src *probTree) {
 	if t == src {
 		return
 	}
-	t.probs = make([]prob, len(src.probs))
+	t.probs = resizeProbs(t.probs, len(src.probs))
 	copy(t.probs, src.probs)
 	t.bits = src.bits
 }
 
-// makeProbTree initializes a probTree structure.
-func makeProbTree(bits int) probTree {
+// init initializes the probTree reusing the probability slice if
+// possible.
+func (t *probTree) init(bits int) {
 	if !(1 <= bits && bits <= 32) {
 		panic("bits outside of range [1,32]")
 	}
-	t := probTree{
-		bits:  byte(bits),
-		probs: make([]prob, 1<<uint(bits)),
-	}
-	for i := range t.probs {
-		t.probs[i] = probInit
-	}
-	return t
+	t.bits = byte(bits)
+	t.probs = resizeProbs(t.probs, 1<<uint(bits))
+	initProbSlice(t.probs)
 }
 
 // Bits provides the number of bits for the values to de- or encode.
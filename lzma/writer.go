@@ -30,6 +30,37 @@ type WriterConfig struct {
 	BufSize int
 	// Match algorithm
 	Matcher MatchAlgorithm
+	// Preset selects the dictionary capacity, the match algorithm,
+	// the parser and the search parameters of the matcher as the
+	// presets of xz-utils do. DictCap, Matcher, Parser, NiceLen and
+	// Depth override the preset if they are not zero. The
+	// properties of all presets are LC=3, LP=0 and PB=2. (default:
+	// NoPreset)
+	Preset Preset
+	// KeepMatcher prevents a preset from replacing Matcher and
+	// Parser. It is required to use the zero values HashTable4 and
+	// GreedyParser together with a preset.
+	KeepMatcher bool
+	// Extreme selects the slower extreme variant of the preset. If
+	// Preset is not set, the extreme variant of Preset6 is used.
+	Extreme bool
+	// Parser selects the method choosing the operations of the
+	// encoder. The lazy parsers and the OptimalParser compress
+	// better than the default GreedyParser but are slower.
+	Parser Parser
+	// NiceLen is the length of a match that is accepted without
+	// further search in the range 2 to 273. The parsers encode such
+	// a match without looking further ahead. Zero selects the value
+	// of the preset or the default of the matcher.
+	NiceLen int
+	// Depth limits the number of match candidates checked by the
+	// matcher at a position. The maximum is 65536. Zero selects the
+	// value of the preset or the default of the matcher.
+	Depth int
+	// MaxCandidates limits the matches reported by the matcher at a
+	// position to the longest ones. It bounds the work of the
+	// optimal parser. The maximum is 273. Zero means no limit.
+	MaxCandidates int
 	// SizeInHeader indicates that the header will contain an
 	// explicit size.
 	SizeInHeader bool
@@ -44,6 +75,23 @@ type WriterConfig struct {
 
 // fill converts zero-value fields to their explicit default values.
 func (c *WriterConfig) fill() {
+	if pp, ok := c.Preset.params(c.Extreme); ok {
+		if c.DictCap == 0 {
+			c.DictCap = pp.dictCap
+		}
+		if c.Matcher == HashTable4 && !c.KeepMatcher {
+			c.Matcher = pp.matcher
+		}
+		if c.Parser == GreedyParser && !c.KeepMatcher {
+			c.Parser = pp.parser
+		}
+		if c.Depth == 0 {
+			c.Depth = pp.depth
+		}
+		if c.NiceLen == 0 {
+			c.NiceLen = pp.niceLen
+		}
+	}
 	if c.Properties == nil {
 		c.Properties = &Properties{LC: 3, LP: 0, PB: 2}
 	}
@@ -91,6 +139,15 @@ func (c *WriterConfig) Verify() error {
 	if err = c.Matcher.verify(); err != nil {
 		return err
 	}
+	if err = c.Preset.verify(); err != nil {
+		return err
+	}
+	if err = c.Parser.verify(); err != nil {
+		return err
+	}
+	if err = verifyLimits(c.NiceLen, c.Depth, c.MaxCandidates); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -131,7 +188,8 @@ func (c WriterConfig) NewWriter(lzma io.Writer) (w *Writer, err error) {
 		w.bw = w.buf
 	}
 	state := newState(w.h.Properties)
-	m, err := c.Matcher.new(int(w.h.DictSize))
+	m, err := c.Matcher.new(int(w.h.DictSize), c.Depth, c.NiceLen,
+		c.MaxCandidates)
 	if err != nil {
 		return nil, err
 	}
@@ -146,6 +204,7 @@ func (c WriterConfig) NewWriter(lzma io.Writer) (w *Writer, err error) {
 	if w.e, err = newEncoder(w.bw, state, dict, flags); err != nil {
 		return nil, err
 	}
+	w.e.setParser(c.Parser, c.NiceLen)
 
 	if err = w.writeHeader(); err != nil {
 		return nil, err
@@ -153,12 +212,48 @@ func (c WriterConfig) NewWriter(lzma io.Writer) (w *Writer, err error) {
 	return w, nil
 }
 
+// Reset discards the state of the writer and starts a new LZMA stream
+// written to lzma using the same configuration. The dictionary, the
+// matcher and the buffers are reused. Reset writes the header to the
+// underlying stream.
+func (w *Writer) Reset(lzma io.Writer) error {
+	var ok bool
+	w.bw, ok = lzma.(io.ByteWriter)
+	if !ok {
+		if w.buf == nil {
+			w.buf = bufio.NewWriter(lzma)
+		} else {
+			w.buf.Reset(lzma)
+		}
+		w.bw = w.buf
+	} else {
+		w.buf = nil
+	}
+	w.e.state.Reset()
+	w.e.dict.Reset()
+	if err := w.e.Reopen(w.bw); err != nil {
+		return err
+	}
+	return w.writeHeader()
+}
+
 // NewWriter creates a new LZMA writer using the classic format. The
 // function writes the header to the underlying stream.
 func NewWriter(lzma io.Writer) (w *Writer, err error) {
 	return WriterConfig{}.NewWriter(lzma)
 }
 
+// NewWriterLevel creates a new LZMA writer using the preset for the
+// compression level in the range 0 to 9. The function writes the header
+// to the underlying stream.
+func NewWriterLevel(lzma io.Writer, level int) (w *Writer, err error) {
+	p, err := LevelPreset(level)
+	if err != nil {
+		return nil, err
+	}
+	return WriterConfig{Preset: p}.NewWriter(lzma)
+}
+
 // writeHeader writes the LZMA header into the stream.
 func (w *Writer) writeHeader() error {
 	data, err := w.h.marshalBinary()
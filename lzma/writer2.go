@@ -23,10 +23,58 @@ type Writer2Config struct {
 	BufSize int
 	// Match algorithm
 	Matcher MatchAlgorithm
+	// Preset selects the dictionary capacity, the match algorithm,
+	// the parser and the search parameters of the matcher as the
+	// presets of xz-utils do. DictCap, Matcher, Parser, NiceLen and
+	// Depth override the preset if they are not zero. The
+	// properties of all presets are LC=3, LP=0 and PB=2. (default:
+	// NoPreset)
+	Preset Preset
+	// KeepMatcher prevents a preset from replacing Matcher and
+	// Parser. It is required to use the zero values HashTable4 and
+	// GreedyParser together with a preset.
+	KeepMatcher bool
+	// Extreme selects the slower extreme variant of the preset. If
+	// Preset is not set, the extreme variant of Preset6 is used.
+	Extreme bool
+	// Parser selects the method choosing the operations of the
+	// encoder. The lazy parsers and the OptimalParser compress
+	// better than the default GreedyParser but are slower.
+	Parser Parser
+	// NiceLen is the length of a match that is accepted without
+	// further search in the range 2 to 273. The parsers encode such
+	// a match without looking further ahead. Zero selects the value
+	// of the preset or the default of the matcher.
+	NiceLen int
+	// Depth limits the number of match candidates checked by the
+	// matcher at a position. The maximum is 65536. Zero selects the
+	// value of the preset or the default of the matcher.
+	Depth int
+	// MaxCandidates limits the matches reported by the matcher at a
+	// position to the longest ones. It bounds the work of the
+	// optimal parser. The maximum is 273. Zero means no limit.
+	MaxCandidates int
 }
 
 // fill replaces zero values with default values.
 func (c *Writer2Config) fill() {
+	if pp, ok := c.Preset.params(c.Extreme); ok {
+		if c.DictCap == 0 {
+			c.DictCap = pp.dictCap
+		}
+		if c.Matcher == HashTable4 && !c.KeepMatcher {
+			c.Matcher = pp.matcher
+		}
+		if c.Parser == GreedyParser && !c.KeepMatcher {
+			c.Parser = pp.parser
+		}
+		if c.Depth == 0 {
+			c.Depth = pp.depth
+		}
+		if c.NiceLen == 0 {
+			c.NiceLen = pp.niceLen
+		}
+	}
 	if c.Properties == nil {
 		c.Properties = &Properties{LC: 3, LP: 0, PB: 2}
 	}
@@ -64,6 +112,15 @@ func (c *Writer2Config) Verify() error {
 	if err = c.Matcher.verify(); err != nil {
 		return err
 	}
+	if err = c.Preset.verify(); err != nil {
+		return err
+	}
+	if err = c.Parser.verify(); err != nil {
+		return err
+	}
+	if err = verifyLimits(c.NiceLen, c.Depth, c.MaxCandidates); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -95,6 +152,16 @@ func NewWriter2(lzma2 io.Writer) (w *Writer2, err error) {
 	return Writer2Config{}.NewWriter2(lzma2)
 }
 
+// NewWriter2Level creates an LZMA2 chunk sequence writer using the
+// preset for the compression level in the range 0 to 9.
+func NewWriter2Level(lzma2 io.Writer, level int) (w *Writer2, err error) {
+	p, err := LevelPreset(level)
+	if err != nil {
+		return nil, err
+	}
+	return Writer2Config{Preset: p}.NewWriter2(lzma2)
+}
+
 // NewWriter2 creates a new LZMA2 writer using the given configuration.
 func (c Writer2Config) NewWriter2(lzma2 io.Writer) (w *Writer2, err error) {
 	if err = c.Verify(); err != nil {
@@ -108,7 +175,8 @@ func (c Writer2Config) NewWriter2(lzma2 io.Writer) (w *Writer2, err error) {
 	}
 	w.buf.Grow(maxCompressed)
 	w.lbw = LimitedByteWriter{BW: &w.buf, N: maxCompressed}
-	m, err := c.Matcher.new(c.DictCap)
+	m, err := c.Matcher.new(c.DictCap, c.Depth, c.NiceLen,
+		c.MaxCandidates)
 	if err != nil {
 		return nil, err
 	}
@@ -120,9 +188,25 @@ func (c Writer2Config) NewWriter2(lzma2 io.Writer) (w *Writer2, err error) {
 	if err != nil {
 		return nil, err
 	}
+	w.encoder.setParser(c.Parser, c.NiceLen)
 	return w, nil
 }
 
+// Reset discards the state of the writer and prepares it for writing a
+// new LZMA2 chunk sequence to lzma2 using the same configuration. The
+// dictionary, the matcher and the buffers are reused.
+func (w *Writer2) Reset(lzma2 io.Writer) error {
+	w.w = lzma2
+	w.cstate = start
+	w.ctype = start.defaultChunkType()
+	w.buf.Reset()
+	w.lbw.N = maxCompressed
+	w.start.Reset()
+	w.encoder.state.deepcopy(w.start)
+	w.encoder.dict.Reset()
+	return w.encoder.Reopen(&w.lbw)
+}
+
 // written returns the number of bytes written to the current chunk
 func (w *Writer2) written() int {
 	if w.encoder == nil {
@@ -182,7 +266,7 @@ func (w *Writer2) writeUncompressedChunk() error {
 	default:
 		w.ctype = cU
 	}
-	w.encoder.state = w.start
+	w.encoder.state.deepcopy(w.start)
 
 	header := chunkHeader{
 		ctype:        w.ctype,
@@ -269,7 +353,7 @@ func (w *Writer2) flushChunk() error {
 		return err
 	}
 	w.ctype = w.cstate.defaultChunkType()
-	w.start = cloneState(w.encoder.state)
+	w.start.deepcopy(w.encoder.state)
 	return nil
 }
 
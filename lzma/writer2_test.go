@@ -107,3 +107,70 @@ func TestCycle2(t *testing.T) {
 		t.Fatal("decompressed data differs from original")
 	}
 }
+
+// flushTestData returns data larger than the dictionary capacity used
+// by TestWriter2FlushMatchers that contains many long matches.
+func flushTestData() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		buf.Write(parserTestData())
+	}
+	return buf.Bytes()
+}
+
+// flushCompress compresses data with the configuration calling Flush
+// after writes of random sizes up to maxWrite and checks that the
+// decompressed stream is equal to data.
+func flushCompress(t *testing.T, cfg Writer2Config, data []byte,
+	maxWrite int, seed int64) {
+
+	var buf bytes.Buffer
+	w, err := cfg.NewWriter2(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter2 error %s", err)
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	for p := data; len(p) > 0; {
+		k := 1 + rnd.Intn(maxWrite)
+		if k > len(p) {
+			k = len(p)
+		}
+		if _, err = w.Write(p[:k]); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatalf("w.Flush error %s", err)
+		}
+		p = p[k:]
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := Reader2Config{DictCap: cfg.DictCap}.NewReader2(&buf)
+	if err != nil {
+		t.Fatalf("NewReader2 error %s", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s %s: io.ReadAll error %s", cfg.Matcher,
+			cfg.Parser, err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("%s %s: decompressed data differs", cfg.Matcher,
+			cfg.Parser)
+	}
+}
+
+func TestWriter2FlushMatchers(t *testing.T) {
+	data := flushTestData()
+	for _, a := range allMatchAlgorithms {
+		for _, p := range []Parser{GreedyParser, LazyParser,
+			Lazy2Parser, OptimalParser} {
+			cfg := Writer2Config{DictCap: 1 << 15, Matcher: a,
+				Parser: p}
+			flushCompress(t, cfg, data, 1000, 1)
+			// no flush before the dictionary is filled
+			flushCompress(t, cfg, data, 1<<16, 2)
+		}
+	}
+}
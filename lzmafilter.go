@@ -18,29 +18,33 @@ const (
 	lzmaFilterLen = 3
 )
 
-// lzmaFilter declares the LZMA2 filter information stored in an xz
-// block header.
-type lzmaFilter struct {
-	dictCap int64
+// LZMA2Filter declares the LZMA2 filter information stored in an xz
+// block header. The LZMA2 filter must be the last filter in a filter
+// chain. The other parameters for the LZMA2 writer are taken from the
+// WriterConfig.
+type LZMA2Filter struct {
+	// dictionary capacity; zero requests the DictCap value of the
+	// WriterConfig in a filter chain
+	DictCap int64
 }
 
 // String returns a representation of the LZMA filter.
-func (f lzmaFilter) String() string {
-	return fmt.Sprintf("LZMA dict cap %#x", f.dictCap)
+func (f LZMA2Filter) String() string {
+	return fmt.Sprintf("LZMA dict cap %#x", f.DictCap)
 }
 
-// id returns the ID for the LZMA2 filter.
-func (f lzmaFilter) id() uint64 { return lzmaFilterID }
+// ID returns the ID for the LZMA2 filter.
+func (f LZMA2Filter) ID() uint64 { return lzmaFilterID }
 
-// MarshalBinary converts the lzmaFilter in its encoded representation.
-func (f lzmaFilter) MarshalBinary() (data []byte, err error) {
-	c := lzma.EncodeDictCap(f.dictCap)
+// MarshalBinary converts the LZMA2Filter in its encoded representation.
+func (f LZMA2Filter) MarshalBinary() (data []byte, err error) {
+	c := lzma.EncodeDictCap(f.DictCap)
 	return []byte{lzmaFilterID, 1, c}, nil
 }
 
 // UnmarshalBinary unmarshals the given data representation of the LZMA2
 // filter.
-func (f *lzmaFilter) UnmarshalBinary(data []byte) error {
+func (f *LZMA2Filter) UnmarshalBinary(data []byte) error {
 	if len(data) != lzmaFilterLen {
 		return errors.New("xz: data for LZMA2 filter has wrong length")
 	}
@@ -55,19 +59,20 @@ func (f *lzmaFilter) UnmarshalBinary(data []byte) error {
 		return errors.New("xz: wrong LZMA2 dictionary size property")
 	}
 
-	f.dictCap = dc
+	f.DictCap = dc
 	return nil
 }
 
-// reader creates a new reader for the LZMA2 filter.
-func (f lzmaFilter) reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
+// Reader creates a new reader for the LZMA2 filter.
+func (f LZMA2Filter) Reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
 	err error) {
 
 	config := new(lzma.Reader2Config)
 	if c != nil {
 		config.DictCap = c.DictCap
+		config.MemLimit = c.MemLimit
 	}
-	dc := int(f.dictCap)
+	dc := int(f.DictCap)
 	if dc < 1 {
 		return nil, errors.New("xz: LZMA2 filter parameter " +
 			"dictionary capacity overflow")
@@ -83,27 +88,34 @@ func (f lzmaFilter) reader(r io.Reader, c *ReaderConfig) (fr io.Reader,
 	return fr, nil
 }
 
-// writeCloser creates a io.WriteCloser for the LZMA2 filter.
-func (f lzmaFilter) writeCloser(w io.WriteCloser, c *WriterConfig,
+// WriteCloser creates a io.WriteCloser for the LZMA2 filter.
+func (f LZMA2Filter) WriteCloser(w io.WriteCloser, c *WriterConfig,
 ) (fw io.WriteCloser, err error) {
 	config := new(lzma.Writer2Config)
 	if c != nil {
 		*config = lzma.Writer2Config{
-			Properties: c.Properties,
-			DictCap:    c.DictCap,
-			BufSize:    c.BufSize,
-			Matcher:    c.Matcher,
+			Properties:    c.Properties,
+			DictCap:       c.DictCap,
+			BufSize:       c.BufSize,
+			Matcher:       c.Matcher,
+			Preset:        c.Preset,
+			KeepMatcher:   c.KeepMatcher,
+			Extreme:       c.Extreme,
+			Parser:        c.Parser,
+			NiceLen:       c.NiceLen,
+			Depth:         c.Depth,
+			MaxCandidates: c.MaxCandidates,
 		}
 	}
 
-	dc := int(f.dictCap)
+	dc := int(f.DictCap)
 	if dc < 1 {
 		return nil, errors.New("xz: LZMA2 filter parameter " +
 			"dictionary capacity overflow")
 	}
-	if dc > config.DictCap {
-		config.DictCap = dc
-	}
+	// The reader uses the dictionary capacity of the filter, so the
+	// writer must not use a larger one.
+	config.DictCap = dc
 
 	fw, err = config.NewWriter2(w)
 	if err != nil {
@@ -112,6 +124,6 @@ func (f lzmaFilter) writeCloser(w io.WriteCloser, c *WriterConfig,
 	return fw, nil
 }
 
-// last returns true, because an LZMA2 filter must be the last filter in
+// Last returns true, because an LZMA2 filter must be the last filter in
 // the filter list.
-func (f lzmaFilter) last() bool { return true }
+func (f LZMA2Filter) Last() bool { return true }
@@ -0,0 +1,302 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"hash"
+	"io"
+
+	"github.com/ulikunitz/xz/internal/xlog"
+)
+
+// parDecoded is the result of the decoding of a single block by a
+// worker goroutine.
+type parDecoded struct {
+	data []byte
+	rec  record
+	err  error
+}
+
+// parJob describes a block read by the parallel stream reader. Blocks
+// with known compressed size are decoded by a worker goroutine and the
+// result is delivered by the channel. Blocks with unknown size must be
+// decoded sequentially; ch is nil for them.
+type parJob struct {
+	ch   chan parDecoded
+	h    *blockHeader
+	hlen int
+	// offset of the compressed data in the file
+	offset int64
+	// uncompressed size if known or -1
+	size int64
+	// memory held by the compressed and decoded data of the block
+	mem int64
+}
+
+// pendingOffset returns the offset of the uncompressed data of the
+// block following the pending blocks or -1 if it isn't known.
+func (r *streamReader) pendingOffset() int64 {
+	if r.prog == nil {
+		return -1
+	}
+	off := r.prog.done
+	for _, job := range r.pending {
+		if job.size < 0 {
+			return -1
+		}
+		off += job.size
+	}
+	return off
+}
+
+// decodeBlock decodes the complete block provided in data, which
+// contains the compressed data, the block padding and the check. The
+// block header has already been read. The offset of the data in the
+// file is used for the position of errors. The uncompressed size of
+// the block is negative if it isn't known. The declared sizes are not
+// trusted, so the buffer grows while the block is decoded.
+func (c *ReaderConfig) decodeBlock(data []byte, offset int64,
+	h *blockHeader, hlen int, size int64, hash hash.Hash) parDecoded {
+
+	z := bytes.NewReader(data)
+	br, err := c.newBlockReader(z, offset, h, hlen, hash, nil)
+	if err != nil {
+		return parDecoded{err: err}
+	}
+	var buf bytes.Buffer
+	buf.Grow(c.bufferSize(size, int64(len(data))))
+	var lr io.Reader = br
+	if size >= 0 {
+		lr = io.LimitReader(br, size+1)
+	}
+	if _, err = io.Copy(&buf, lr); err != nil {
+		return parDecoded{err: err}
+	}
+	if size >= 0 && int64(buf.Len()) > size {
+		err = locate(formatError(ErrCorrupt,
+			"xz: block larger than recorded in index"),
+			offset+br.compressedSize(), -1, -1)
+		return parDecoded{err: err}
+	}
+	if z.Len() != 0 {
+		err = locate(formatError(ErrCorrupt,
+			"xz: block shorter than its compressed size"),
+			offset+int64(len(data)-z.Len()), -1, -1)
+		return parDecoded{err: err}
+	}
+	return parDecoded{data: buf.Bytes(), rec: br.record()}
+}
+
+// readAhead reports whether a block with the given uncompressed size
+// and n bytes of compressed data can be decoded by a worker. Decoded
+// blocks are kept in memory until they are read, so if MemLimit is set,
+// the compressed and uncompressed data of the blocks held must not
+// exceed it. Blocks of unknown uncompressed size cannot be accounted
+// for and are then decoded sequentially.
+func (r *streamReader) readAhead(size, n int64) bool {
+	if r.MemLimit == 0 {
+		return true
+	}
+	if size < 0 {
+		return false
+	}
+	held := int64(len(r.cur))
+	for _, job := range r.pending {
+		held += job.mem
+	}
+	return size <= r.MemLimit-held-n
+}
+
+// blockDataSize returns the size of the compressed data, the padding
+// and the check of the next block, or -1 if it isn't known. The
+// compressed size is taken from the block header or from the index
+// found by scanning a seekable input.
+func (r *streamReader) blockDataSize(h *blockHeader, hlen int) int64 {
+	checkSize := int64(r.newHash().Size())
+	c := h.compressedSize
+	if c < 0 {
+		i := len(r.index) + len(r.pending)
+		if i >= len(r.records) {
+			return -1
+		}
+		c = r.records[i].unpaddedSize - int64(hlen) - checkSize
+		if c <= 0 {
+			return -1
+		}
+	}
+	return c + int64(padLen(c)) + checkSize
+}
+
+// fill reads block headers and block data until Workers blocks are in
+// flight, the index has been reached or a block of unknown size has
+// been found. A read error is stored in readErr and reported after all
+// blocks in flight have been returned.
+func (r *streamReader) fill() {
+	for r.readErr == nil && !r.indexReached && r.br == nil &&
+		len(r.pending) < r.Workers {
+
+		if k := len(r.pending); k > 0 && r.pending[k-1].ch == nil {
+			return
+		}
+		block := len(r.index) + len(r.pending)
+		off := r.offset()
+		r.readOff = off
+		h, hlen, err := readBlockHeader(r.xz)
+		if err != nil {
+			if err == errIndexIndicator {
+				r.indexReached = true
+				return
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			r.readErr = locate(err, off, -1, block)
+			return
+		}
+		xlog.Debugf("block %v", *h)
+		if err = r.checkBlock(h, hlen, r.pendingOffset()); err != nil {
+			r.readErr = err
+			return
+		}
+		job := parJob{
+			h:      h,
+			hlen:   hlen,
+			size:   r.blockUncompressedSize(h),
+			offset: r.offset(),
+		}
+		if n := r.blockDataSize(h, hlen); n >= 0 &&
+			r.readAhead(job.size, n) {
+
+			job.mem = n + job.size
+			var buf bytes.Buffer
+			if _, err = io.CopyN(&buf, r.xz, n); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				r.readErr = locate(err, r.offset(), -1, block)
+				return
+			}
+			job.ch = make(chan parDecoded, 1)
+			hash := r.newHash()
+			go func() {
+				job.ch <- r.ReaderConfig.decodeBlock(
+					buf.Bytes(), job.offset, h, hlen,
+					job.size, hash)
+			}()
+		}
+		r.pending = append(r.pending, job)
+	}
+}
+
+// parRead reads the data of the xz stream decoding blocks in parallel.
+// The checks of the blocks are verified by the blockReader as for
+// sequential decoding.
+func (r *streamReader) parRead(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(r.cur) > 0 {
+			k := copy(p[n:], r.cur)
+			r.cur = r.cur[k:]
+			n += k
+			continue
+		}
+		if r.br != nil {
+			k, err := r.br.Read(p[n:])
+			n += k
+			if err != nil {
+				if err != io.EOF {
+					err = locate(err, -1, -1, len(r.index))
+					if err = r.salvage(r.blockOff, err); err != nil {
+						return n, err
+					}
+					continue
+				}
+				r.addRecord(r.br.record())
+				r.br = nil
+			}
+			continue
+		}
+		r.fill()
+		if len(r.pending) == 0 {
+			if r.readErr != nil {
+				err, r.readErr = r.readErr, nil
+				if err = r.salvage(r.readOff, err); err != nil {
+					return n, err
+				}
+				continue
+			}
+			if err = r.readTail(); err != nil {
+				err = locate(err, r.readOff, -1, -1)
+				if err = r.salvage(r.readOff, err); err != nil {
+					return n, err
+				}
+				r.indexReached = false
+				continue
+			}
+			return n, io.EOF
+		}
+		job := r.pending[0]
+		r.pending[0] = parJob{}
+		r.pending = r.pending[1:]
+		r.blockOff = job.offset - int64(job.hlen)
+		if job.ch == nil {
+			r.br, err = r.ReaderConfig.newBlockReader(r.xz,
+				job.offset, job.h, job.hlen, r.newHash(), nil)
+			if err != nil {
+				err = locate(err, r.blockOff, -1, len(r.index))
+				if err = r.salvage(r.blockOff, err); err != nil {
+					return n, err
+				}
+			}
+			continue
+		}
+		d := <-job.ch
+		if d.err != nil {
+			err = locate(d.err, -1, -1, len(r.index))
+			if !r.report(r.blockOff, err) {
+				return n, err
+			}
+			// The input is already positioned after the block.
+			r.skipRecord()
+			continue
+		}
+		r.addRecord(d.rec)
+		r.cur = d.data
+		// start reading the next blocks early
+		r.fill()
+	}
+	return n, nil
+}
+
+// scanSeekable locates the streams of a seekable input from the
+// current position to the end. It returns nil if the input isn't
+// seekable or the streams cannot be located.
+func scanSeekable(xz io.Reader) []streamDesc {
+	ra, ok := xz.(io.ReaderAt)
+	if !ok {
+		return nil
+	}
+	s, ok := xz.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	off, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	size, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil
+	}
+	if _, err = s.Seek(off, io.SeekStart); err != nil {
+		return nil
+	}
+	streams, err := scanStreams(io.NewSectionReader(ra, off, size-off),
+		size-off)
+	if err != nil {
+		return nil
+	}
+	return streams
+}
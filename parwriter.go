@@ -0,0 +1,282 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"hash"
+	"io"
+)
+
+// parBlock is the result of the compression of a single block by a
+// worker goroutine.
+type parBlock struct {
+	// block header, compressed data, padding and check
+	data []byte
+	rec  record
+	err  error
+}
+
+// parWriter compresses blocks in parallel. The blocks are written to
+// the underlying writer in the order of the input, so the output is the
+// same as the output of the sequential blockWriter. At most workers
+// blocks are compressed at the same time.
+type parWriter struct {
+	c       *WriterConfig
+	xz      io.Writer
+	newHash func() hash.Hash
+	workers int
+
+	// data of the block not submitted yet
+	buf []byte
+	// block written directly to xz after a sync flush
+	bw *blockWriter
+	// results of the submitted blocks in order
+	pending []chan parBlock
+	index   []record
+	err     error
+}
+
+// newParWriter creates a writer compressing blocks in parallel.
+func newParWriter(c *WriterConfig, xz io.Writer, newHash func() hash.Hash,
+) *parWriter {
+	return &parWriter{
+		c:       c,
+		xz:      xz,
+		newHash: newHash,
+		workers: c.Workers,
+	}
+}
+
+// compressBlock compresses the data into a complete block.
+func (c *WriterConfig) compressBlock(data []byte, hash hash.Hash) parBlock {
+	var buf bytes.Buffer
+	bw, err := c.newBlockWriter(&buf, hash)
+	if err != nil {
+		return parBlock{err: err}
+	}
+	if !c.BlockHeaderSizes {
+		if err = bw.writeHeader(&buf); err != nil {
+			return parBlock{err: err}
+		}
+	}
+	if _, err = bw.Write(data); err != nil {
+		return parBlock{err: err}
+	}
+	if err = bw.Close(); err != nil {
+		return parBlock{err: err}
+	}
+	if c.BlockHeaderSizes {
+		// The header contains the sizes of the closed block.
+		var hbuf bytes.Buffer
+		hbuf.Grow(maxBlockHeaderLen + buf.Len())
+		if err = bw.writeHeader(&hbuf); err != nil {
+			return parBlock{err: err}
+		}
+		hbuf.Write(buf.Bytes())
+		return parBlock{data: hbuf.Bytes(), rec: bw.record()}
+	}
+	return parBlock{data: buf.Bytes(), rec: bw.record()}
+}
+
+// Write collects the data for the blocks and submits full blocks for
+// compression. A block is only submitted if more data follows, so the
+// block boundaries are the same as for the sequential writer.
+func (pw *parWriter) Write(p []byte) (n int, err error) {
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	for n < len(p) {
+		if pw.bw != nil {
+			k, err := pw.bw.Write(p[n:])
+			n += k
+			if err == errNoSpace {
+				err = pw.closeBlock()
+			}
+			if err != nil {
+				pw.err = err
+				return n, err
+			}
+			continue
+		}
+		size := pw.blockSize()
+		if int64(len(pw.buf)) == size {
+			if err = pw.submit(); err != nil {
+				return n, err
+			}
+			size = pw.blockSize()
+		}
+		if pw.buf == nil {
+			// Verify ensures that the block size is limited.
+			c := size
+			if c > int64(maxInt) {
+				c = int64(maxInt)
+			}
+			pw.buf = make([]byte, 0, c)
+		}
+		k := len(p) - n
+		if t := size - int64(len(pw.buf)); int64(k) > t {
+			k = int(t)
+		}
+		pw.buf = append(pw.buf, p[n:n+k]...)
+		n += k
+	}
+	return n, nil
+}
+
+// blockSize returns the maximum size of the block collected in buf.
+func (pw *parWriter) blockSize() int64 {
+	return pw.c.blockSize(len(pw.index) + len(pw.pending))
+}
+
+// EndBlock ends the current block. The collected data is submitted for
+// compression as a block.
+func (pw *parWriter) EndBlock() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	var err error
+	switch {
+	case pw.bw != nil:
+		err = pw.closeBlock()
+	case len(pw.buf) > 0:
+		err = pw.submit()
+	}
+	if err != nil {
+		pw.err = err
+	}
+	return err
+}
+
+// submit starts the compression of the collected data. If the maximum
+// number of blocks is in flight, the oldest block is written first.
+func (pw *parWriter) submit() error {
+	if len(pw.pending) >= pw.workers {
+		if err := pw.writeOldest(); err != nil {
+			return err
+		}
+	}
+	data, hash := pw.buf, pw.newHash()
+	pw.buf = nil
+	ch := make(chan parBlock, 1)
+	go func() { ch <- pw.c.compressBlock(data, hash) }()
+	pw.pending = append(pw.pending, ch)
+	return nil
+}
+
+// writeOldest waits for the oldest block in flight and writes it to the
+// underlying writer.
+func (pw *parWriter) writeOldest() error {
+	b := <-pw.pending[0]
+	pw.pending[0] = nil
+	pw.pending = pw.pending[1:]
+	if b.err != nil {
+		pw.err = b.err
+		return b.err
+	}
+	if _, err := pw.xz.Write(b.data); err != nil {
+		pw.err = err
+		return err
+	}
+	pw.index = append(pw.index, b.rec)
+	return nil
+}
+
+// closeBlock closes the block written directly and records it in the
+// index.
+func (pw *parWriter) closeBlock() error {
+	if err := pw.bw.Close(); err != nil {
+		return err
+	}
+	pw.index = append(pw.index, pw.bw.record())
+	pw.bw = nil
+	return nil
+}
+
+// drain writes all blocks in flight.
+func (pw *parWriter) drain() error {
+	for len(pw.pending) > 0 {
+		if err := pw.writeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes all blocks in flight and the collected data. In
+// BlockFlush mode the collected data is compressed as a block. In
+// SyncFlush mode the block is written directly to the underlying
+// writer and continued by the following writes, so the output is the
+// same as the output of the sequential writer.
+func (pw *parWriter) Flush() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	err := pw.flush()
+	if err != nil {
+		pw.err = err
+	}
+	return err
+}
+
+// flush implements Flush without setting the error of the writer.
+func (pw *parWriter) flush() error {
+	if pw.bw == nil && len(pw.buf) > 0 {
+		if pw.c.FlushMode == BlockFlush || pw.c.BlockHeaderSizes {
+			if err := pw.submit(); err != nil {
+				return err
+			}
+		} else {
+			if err := pw.drain(); err != nil {
+				return err
+			}
+			var err error
+			pw.bw, err = pw.c.startBlock(pw.xz, pw.newHash())
+			if err != nil {
+				return err
+			}
+			pw.bw.blockSize = pw.blockSize()
+			if _, err = pw.bw.Write(pw.buf); err != nil {
+				return err
+			}
+			pw.buf = nil
+		}
+	}
+	if err := pw.drain(); err != nil {
+		return err
+	}
+	if pw.bw == nil {
+		return nil
+	}
+	if pw.c.FlushMode == SyncFlush {
+		if err := pw.bw.flush(); err != errNoFlush {
+			return err
+		}
+	}
+	return pw.closeBlock()
+}
+
+// Close submits the last block and writes all blocks in flight. It
+// returns the index records of all blocks.
+func (pw *parWriter) Close() (index []record, err error) {
+	if pw.err != nil {
+		return nil, pw.err
+	}
+	if pw.bw != nil {
+		if err = pw.closeBlock(); err != nil {
+			return nil, err
+		}
+	} else if len(pw.buf) > 0 ||
+		(len(pw.index) == 0 && len(pw.pending) == 0) {
+		// An empty stream gets an empty block.
+		if err = pw.submit(); err != nil {
+			return nil, err
+		}
+	}
+	if err = pw.drain(); err != nil {
+		return nil, err
+	}
+	return pw.index, nil
+}
@@ -3,8 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // Package xz supports the compression and decompression of xz files. It
-// supports version 1.0.4 of the specification without the non-LZMA2
-// filters. See http://tukaani.org/xz/xz-file-format-1.0.4.txt
+// supports version 1.0.4 of the specification with the LZMA2, the
+// delta and the BCJ filters for x86, PowerPC, IA-64, ARM, ARM-Thumb,
+// SPARC, ARM64 and RISC-V code. See http://tukaani.org/xz/xz-file-format-1.0.4.txt
 package xz
 
 import (
@@ -24,18 +25,87 @@ import (
 type ReaderConfig struct {
 	DictCap      int
 	SingleStream bool
+	// Workers defines the number of blocks that are decoded in
+	// parallel. Values of zero and one request sequential decoding.
+	// Parallel decoding requires that the compressed sizes of the
+	// blocks are known, either from the block headers or from the
+	// index of an input implementing io.ReaderAt and io.Seeker.
+	// Blocks of unknown size are decoded sequentially. Up to Workers
+	// decoded blocks are kept in memory.
+	Workers int
+	// MemLimit limits the memory used by the decoder of a block in
+	// bytes. The memory required is estimated from the block
+	// header before the dictionary is allocated. If the limit is
+	// exceeded an *ErrMemLimit error is returned. With Workers
+	// larger than one, up to Workers decoders are active at the
+	// same time. The compressed and decoded data of the blocks kept
+	// in memory by the workers must not exceed the limit either;
+	// blocks that don't fit or have an unknown uncompressed size
+	// are then decoded sequentially. Zero means no limit.
+	MemLimit int64
+	// MaxUncompressed limits the size of the uncompressed data. The
+	// sizes declared in the block headers and, for seekable inputs,
+	// in the indexes are checked before decoding. Read returns
+	// ErrMaxUncompressed if the limit would be exceeded. Zero means
+	// no limit.
+	MaxUncompressed int64
+	// MaxRatio limits the ratio of the uncompressed data to the
+	// compressed data read. The limit is checked against the
+	// declared sizes as for MaxUncompressed and while reading. Read
+	// returns ErrMaxRatio if the limit would be exceeded. Zero means
+	// no limit.
+	MaxRatio float64
+	// Recover activates the salvage mode of the Reader if it is not
+	// nil. If a block is damaged, Recover is called with the offset
+	// of the block in the input and the error, which is a
+	// *FormatError. The Reader then skips the block and continues
+	// with the next block header, which is located using the index
+	// of a seekable input or by scanning the input. Uncompressed
+	// data of the damaged block returned before the damage has been
+	// detected is not withdrawn. ReaderAt ignores the field.
+	Recover func(offset int64, err error)
+	// UnsupportedCheck selects the handling of streams using a
+	// check method that is not supported by the package, for
+	// instance a check ID reserved by the specification. The
+	// check values of such streams can be skipped but not
+	// verified. By default the streams are rejected.
+	UnsupportedCheck CheckPolicy
+	// WarnCheck is called for every stream using an unsupported
+	// check with the offset of the stream and the check ID, if
+	// UnsupportedCheck is WarnUnsupportedCheck.
+	WarnCheck func(offset int64, check byte)
 }
 
+// ErrMemLimit reports that decoding requires more memory than allowed
+// by the MemLimit field of the reader configuration. The Need field
+// reports the memory required.
+type ErrMemLimit = lzma.ErrMemLimit
+
 // Verify checks the reader parameters for Validity. Zero values will be
 // replaced by default values.
 func (c *ReaderConfig) Verify() error {
 	if c == nil {
 		return errors.New("xz: reader parameters are nil")
 	}
-	lc := lzma.Reader2Config{DictCap: c.DictCap}
+	lc := lzma.Reader2Config{DictCap: c.DictCap, MemLimit: c.MemLimit}
 	if err := lc.Verify(); err != nil {
 		return err
 	}
+	if c.Workers < 0 {
+		return errors.New("xz: number of workers negative")
+	}
+	if c.MaxUncompressed < 0 {
+		return errors.New("xz: MaxUncompressed is negative")
+	}
+	if !(c.MaxRatio >= 0) {
+		return errors.New("xz: MaxRatio is negative or NaN")
+	}
+	if c.UnsupportedCheck > SkipUnsupportedCheck {
+		return errors.New("xz: invalid UnsupportedCheck policy")
+	}
+	if c.UnsupportedCheck == WarnUnsupportedCheck && c.WarnCheck == nil {
+		return errors.New("xz: WarnCheck is nil")
+	}
 	return nil
 }
 
@@ -45,6 +115,16 @@ type Reader struct {
 
 	xz io.Reader
 	sr *streamReader
+	// streams located in a seekable input for parallel decoding
+	streams []streamDesc
+	nstream int
+
+	prog readProgress
+	out  int64
+	// error returned by all further calls of Read
+	err error
+	// filter readers reused for the next block
+	cache filterCache
 }
 
 // streamReader decodes a single xz stream
@@ -56,6 +136,29 @@ type streamReader struct {
 	newHash func() hash.Hash
 	h       header
 	index   []record
+
+	// parallel decoding
+	records      []record
+	pending      []parJob
+	cur          []byte
+	indexReached bool
+	readErr      error
+	// offset of the block header or index causing readErr
+	readOff int64
+
+	prog *readProgress
+	// offset of the stream and index of the stream in the input
+	start  int64
+	stream int
+	// offset of the header of the current block
+	blockOff int64
+	// damaged is set if the index records cannot be verified
+	// because of a damaged block
+	damaged bool
+
+	// filter readers and hash reused by the sequential decoding
+	cache *filterCache
+	hash  hash.Hash
 }
 
 // NewReader creates a new xz reader using the default parameters.
@@ -72,23 +175,109 @@ func (c ReaderConfig) NewReader(xz io.Reader) (r *Reader, err error) {
 	if err = c.Verify(); err != nil {
 		return nil, err
 	}
-	r = &Reader{
-		ReaderConfig: c,
-		xz:           xz,
-	}
-	if r.sr, err = c.newStreamReader(xz); err != nil {
-		if err == io.EOF {
-			err = io.ErrUnexpectedEOF
-		}
+	r = &Reader{ReaderConfig: c}
+	if err = r.init(xz); err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
+// Reset discards the state of the reader and reads the xz streams from
+// xz using the same configuration. As NewReader it reads and checks the
+// header of the first stream. The decoders of the previous blocks are
+// reused, if the new blocks use the same filters, which avoids the
+// allocation of new dictionaries. If an error is returned, it will be
+// returned by Read as well.
+func (r *Reader) Reset(xz io.Reader) error {
+	*r = Reader{ReaderConfig: r.ReaderConfig, cache: r.cache}
+	if err := r.init(xz); err != nil {
+		r.err = err
+		return err
+	}
+	return nil
+}
+
+// init prepares the reader for reading the xz streams from xz.
+func (r *Reader) init(xz io.Reader) error {
+	c := &r.ReaderConfig
+	if c.Workers > 1 || c.limits().active() || c.Recover != nil {
+		r.streams = scanSeekable(xz)
+		if err := c.limits().checkStreams(r.streams); err != nil {
+			return err
+		}
+	}
+	r.prog.ur = unreadReader{r: xz}
+	r.prog.cxz = countingReader{r: &r.prog.ur}
+	r.xz = &r.prog.cxz
+	if err := r.newStreamReader(); err != nil {
+		switch err {
+		case io.EOF:
+			err = locate(io.ErrUnexpectedEOF, 0, 0, -1)
+		case errPadding:
+			err = locate(formatError(ErrCorrupt,
+				"xz: stream starts with padding"), 0, 0, -1)
+		}
+		return err
+	}
+	return nil
+}
+
+// newStreamReader creates the reader for the next stream and provides
+// the index for it, if the streams of the input have been located.
+func (r *Reader) newStreamReader() error {
+	off := r.prog.cxz.n
+	sr, err := r.ReaderConfig.newStreamReader(r.xz)
+	if err != nil {
+		if err == io.EOF || err == errPadding {
+			return err
+		}
+		return locate(err, off, r.nstream, -1)
+	}
+	if err = r.ReaderConfig.checkStream(off, sr.h.flags); err != nil {
+		return locate(err, off, r.nstream, -1)
+	}
+	if r.nstream < len(r.streams) {
+		sr.records = r.streams[r.nstream].index
+	}
+	sr.prog = &r.prog
+	sr.cache = &r.cache
+	sr.start = off
+	sr.stream = r.nstream
+	r.nstream++
+	r.sr = sr
+	return nil
+}
+
 var errUnexpectedData = errors.New("xz: unexpected data after stream")
 
-// Read reads uncompressed data from the stream.
+// Read reads uncompressed data from the stream. If a limit of the
+// configuration is exceeded, the data up to the limit is returned
+// together with ErrMaxUncompressed or ErrMaxRatio.
 func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.read(p)
+	l := r.limits()
+	if lerr := l.check(r.out+int64(n), r.prog.cxz.n); lerr != nil {
+		if a := l.allowed(r.prog.cxz.n) - r.out; a < int64(n) {
+			n = int(a)
+			if n < 0 {
+				n = 0
+			}
+		}
+		err = lerr
+	}
+	if err == ErrMaxUncompressed || err == ErrMaxRatio {
+		r.err = err
+	}
+	r.out += int64(n)
+	return n, err
+}
+
+// read reads uncompressed data from the streams without checking the
+// limits for the total output.
+func (r *Reader) read(p []byte) (n int, err error) {
 	for n < len(p) {
 		if r.sr == nil {
 			if r.SingleStream {
@@ -100,7 +289,7 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 				return n, io.EOF
 			}
 			for {
-				r.sr, err = r.ReaderConfig.newStreamReader(r.xz)
+				err = r.newStreamReader()
 				if err != errPadding {
 					break
 				}
@@ -116,7 +305,7 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 				r.sr = nil
 				continue
 			}
-			return n, err
+			return n, locate(err, r.prog.cxz.n, r.nstream-1, -1)
 		}
 	}
 	return n, nil
@@ -152,7 +341,7 @@ func (c ReaderConfig) newStreamReader(xz io.Reader) (r *streamReader, err error)
 		return nil, err
 	}
 	xlog.Debugf("xz header %s", r.h)
-	if r.newHash, err = newHashFunc(r.h.flags); err != nil {
+	if r.newHash, err = c.newCheckFunc(r.h.flags); err != nil {
 		return nil, err
 	}
 	return r, nil
@@ -160,7 +349,11 @@ func (c ReaderConfig) newStreamReader(xz io.Reader) (r *streamReader, err error)
 
 // readTail reads the index body and the xz footer.
 func (r *streamReader) readTail() error {
-	index, n, err := readIndexBody(r.xz, len(r.index))
+	recLen := len(r.index)
+	if r.damaged {
+		recLen = -1
+	}
+	index, n, err := readIndexBody(r.xz, recLen)
 	if err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
@@ -168,10 +361,13 @@ func (r *streamReader) readTail() error {
 		return err
 	}
 
-	for i, rec := range r.index {
-		if rec != index[i] {
-			return fmt.Errorf("xz: record %d is %v; want %v",
-				i, rec, index[i])
+	if !r.damaged {
+		for i, rec := range r.index {
+			if rec != index[i] {
+				return formatError(ErrCorrupt, fmt.Sprintf(
+					"xz: record %d is %v; want %v",
+					i, rec, index[i]))
+			}
 		}
 	}
 
@@ -188,32 +384,23 @@ func (r *streamReader) readTail() error {
 	}
 	xlog.Debugf("xz footer %s", f)
 	if f.flags != r.h.flags {
-		return errors.New("xz: footer flags incorrect")
+		return formatError(ErrCorrupt, "xz: footer flags incorrect")
 	}
 	if f.indexSize != int64(n)+1 {
-		return errors.New("xz: index size in footer wrong")
+		return formatError(ErrCorrupt,
+			"xz: index size in footer wrong")
 	}
 	return nil
 }
 
 // Read reads actual data from the xz stream.
 func (r *streamReader) Read(p []byte) (n int, err error) {
+	if r.Workers > 1 {
+		return r.parRead(p)
+	}
 	for n < len(p) {
 		if r.br == nil {
-			bh, hlen, err := readBlockHeader(r.xz)
-			if err != nil {
-				if err == errIndexIndicator {
-					if err = r.readTail(); err != nil {
-						return n, err
-					}
-					return n, io.EOF
-				}
-				return n, err
-			}
-			xlog.Debugf("block %v", *bh)
-			r.br, err = r.ReaderConfig.newBlockReader(r.xz, bh,
-				hlen, r.newHash())
-			if err != nil {
+			if err = r.startBlock(); err != nil {
 				return n, err
 			}
 		}
@@ -221,9 +408,12 @@ func (r *streamReader) Read(p []byte) (n int, err error) {
 		n += k
 		if err != nil {
 			if err == io.EOF {
-				r.index = append(r.index, r.br.record())
+				r.addRecord(r.br.record())
 				r.br = nil
-			} else {
+				continue
+			}
+			err = locate(err, -1, -1, len(r.index))
+			if err = r.salvage(r.blockOff, err); err != nil {
 				return n, err
 			}
 		}
@@ -231,6 +421,69 @@ func (r *streamReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// startBlock reads the next block header and creates the block reader.
+// It returns io.EOF if the index has been reached and the tail of the
+// stream has been verified. Damaged blocks are skipped in salvage mode.
+func (r *streamReader) startBlock() error {
+	for r.br == nil {
+		r.blockOff = r.offset()
+		bh, hlen, err := readBlockHeader(r.xz)
+		if err != nil {
+			if err == errIndexIndicator {
+				if err = r.readTail(); err != nil {
+					err = locate(err, r.blockOff, -1, -1)
+					if err = r.salvage(r.blockOff, err); err != nil {
+						return err
+					}
+					continue
+				}
+				return io.EOF
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			err = locate(err, r.blockOff, -1, len(r.index))
+			if err = r.salvage(r.blockOff, err); err != nil {
+				return err
+			}
+			continue
+		}
+		xlog.Debugf("block %v", *bh)
+		if err = r.checkBlock(bh, hlen, r.pendingOffset()); err != nil {
+			return err
+		}
+		r.br, err = r.ReaderConfig.newBlockReader(r.xz,
+			r.offset(), bh, hlen, r.blockHash(), r.cache)
+		if err != nil {
+			err = locate(err, r.blockOff, -1, len(r.index))
+			if err = r.salvage(r.blockOff, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// blockHash returns the hash for the next block decoded sequentially.
+// The hash is reused.
+func (r *streamReader) blockHash() hash.Hash {
+	if r.hash == nil {
+		r.hash = r.newHash()
+	} else {
+		r.hash.Reset()
+	}
+	return r.hash
+}
+
+// offset returns the number of bytes read from the input of the Reader
+// or -1 if it isn't known.
+func (r *streamReader) offset() int64 {
+	if r.prog == nil {
+		return -1
+	}
+	return r.prog.cxz.n
+}
+
 // countingReader is a reader that counts the bytes read.
 type countingReader struct {
 	r io.Reader
@@ -246,7 +499,9 @@ func (lr *countingReader) Read(p []byte) (n int, err error) {
 
 // blockReader supports the reading of a block.
 type blockReader struct {
-	lxz       countingReader
+	lxz countingReader
+	// offset of the compressed data in the file; -1 if unknown
+	offset    int64
 	header    *blockHeader
 	headerLen int
 	n         int64
@@ -254,22 +509,30 @@ type blockReader struct {
 	r         io.Reader
 }
 
-// newBlockReader creates a new block reader.
-func (c *ReaderConfig) newBlockReader(xz io.Reader, h *blockHeader,
-	hlen int, hash hash.Hash) (br *blockReader, err error) {
+// newBlockReader creates a new block reader. The offset of the
+// compressed data in the file is used for the position of errors.
+func (c *ReaderConfig) newBlockReader(xz io.Reader, offset int64,
+	h *blockHeader, hlen int, hash hash.Hash, fc *filterCache,
+) (br *blockReader, err error) {
 
 	br = &blockReader{
 		lxz:       countingReader{r: xz},
+		offset:    offset,
 		header:    h,
 		headerLen: hlen,
 		hash:      hash,
 	}
 
-	fr, err := c.newFilterReader(&br.lxz, h.filters)
+	var fr io.Reader
+	if fc != nil {
+		fr, err = fc.reader(c, &br.lxz, h.filters)
+	} else {
+		fr, err = c.newFilterReader(&br.lxz, h.filters)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if br.hash.Size() != 0 {
+	if computesCheck(br.hash) {
 		br.r = io.TeeReader(fr, br.hash)
 	} else {
 		br.r = fr
@@ -303,22 +566,47 @@ func (br *blockReader) record() record {
 
 // Read reads data from the block.
 func (br *blockReader) Read(p []byte) (n int, err error) {
+	n, err = br.read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	var e *FormatError
+	if errors.As(err, &e) && e.Offset >= 0 && br.offset >= 0 {
+		// The offsets of the filter readers are relative to the
+		// start of the compressed data.
+		f := *e
+		f.Offset += br.offset
+		err = &f
+	}
+	off := int64(-1)
+	if br.offset >= 0 {
+		off = br.offset + br.lxz.n
+	}
+	return n, locate(err, off, -1, -1)
+}
+
+// read reads data from the block and checks the sizes, the padding and
+// the check at the end of the block.
+func (br *blockReader) read(p []byte) (n int, err error) {
 	n, err = br.r.Read(p)
 	br.n += int64(n)
 
 	u := br.header.uncompressedSize
 	if u >= 0 && br.uncompressedSize() > u {
-		return n, errors.New("xz: wrong uncompressed size for block")
+		return n, formatError(ErrCorrupt,
+			"xz: wrong uncompressed size for block")
 	}
 	c := br.header.compressedSize
 	if c >= 0 && br.compressedSize() > c {
-		return n, errors.New("xz: wrong compressed size for block")
+		return n, formatError(ErrCorrupt,
+			"xz: wrong compressed size for block")
 	}
 	if err != io.EOF {
 		return n, err
 	}
 	if br.uncompressedSize() < u || br.compressedSize() < c {
-		return n, io.ErrUnexpectedEOF
+		return n, formatError(ErrCorrupt,
+			"xz: block smaller than the sizes in the header")
 	}
 
 	s := br.hash.Size()
@@ -331,29 +619,52 @@ func (br *blockReader) Read(p []byte) (n int, err error) {
 		return n, err
 	}
 	if !allZeros(q[:k]) {
-		return n, errors.New("xz: non-zero block padding")
+		return n, formatError(ErrCorrupt, "xz: non-zero block padding")
+	}
+	if !computesCheck(br.hash) {
+		return n, io.EOF
 	}
 	checkSum := q[k:]
 	computedSum := br.hash.Sum(checkSum[s:])
 	if !bytes.Equal(checkSum, computedSum) {
-		return n, errors.New("xz: checksum error for block")
+		err := formatError(ErrChecksum, "xz: checksum error for block")
+		err.Offset = br.lxz.n + int64(k)
+		return n, err
 	}
 	return n, io.EOF
 }
 
-func (c *ReaderConfig) newFilterReader(r io.Reader, f []filter) (fr io.Reader,
+// newFilterReader creates the reader for the filters f reading from r.
+func (c *ReaderConfig) newFilterReader(r io.Reader, f []Filter) (fr io.Reader,
 	err error) {
 
-	if err = verifyFilters(f); err != nil {
+	chain, err := c.newFilterReaders(r, f, nil)
+	if err != nil {
 		return nil, err
 	}
+	return chain[0], nil
+}
+
+// newFilterReaders creates the readers for the filters f and appends
+// them to chain in the order of the filters. The first reader appended
+// is the outermost reader and the last reader reads from r.
+func (c *ReaderConfig) newFilterReaders(r io.Reader, f []Filter,
+	chain []io.Reader) ([]io.Reader, error) {
 
-	fr = r
+	if err := verifyFilters(f); err != nil {
+		return nil, asFormatError(err, ErrCorrupt)
+	}
+	k := len(chain)
+	for range f {
+		chain = append(chain, nil)
+	}
+	var err error
 	for i := len(f) - 1; i >= 0; i-- {
-		fr, err = f[i].reader(fr, c)
+		r, err = f[i].Reader(r, c)
 		if err != nil {
 			return nil, err
 		}
+		chain[k+i] = r
 	}
-	return fr, nil
+	return chain, nil
 }
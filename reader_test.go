@@ -6,10 +6,14 @@ package xz
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
 )
 
 func TestReaderSimple(t *testing.T) {
@@ -96,6 +100,314 @@ func TestCheckNone(t *testing.T) {
 	}
 }
 
+// blocksTestData generates the data compressed in testdata/blocks.xz.
+// The file has been created with xz -T2 --block-size=8000, so that the
+// block headers contain the compressed sizes.
+func blocksTestData() []byte {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(37)), 40000)
+	return buf.Bytes()
+}
+
+// onlyReader hides all methods of the reader beside Read.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestReaderWorkers(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	multiXZ, multiData := multiStreamFile(t)
+	tests := []struct {
+		name string
+		xz   func() io.Reader
+		data []byte
+	}{
+		{"header sizes", func() io.Reader {
+			return onlyReader{bytes.NewReader(blocksXZ)}
+		}, blocksTestData()},
+		{"seekable", func() io.Reader {
+			return bytes.NewReader(multiXZ)
+		}, multiData},
+		{"sequential", func() io.Reader {
+			return onlyReader{bytes.NewReader(multiXZ)}
+		}, multiData},
+	}
+	for _, c := range tests {
+		for _, workers := range []int{2, 3, 8} {
+			cfg := ReaderConfig{Workers: workers}
+			r, err := cfg.NewReader(c.xz())
+			if err != nil {
+				t.Fatalf("%s: NewReader error %s", c.name, err)
+			}
+			var out bytes.Buffer
+			if err = chunkCopy(&out, r, []int{1, 5000, 70000}); err != nil {
+				t.Fatalf("%s: read error %s", c.name, err)
+			}
+			if !bytes.Equal(out.Bytes(), c.data) {
+				t.Fatalf("%s: workers %d: decompressed data "+
+					"differs", c.name, workers)
+			}
+		}
+	}
+}
+
+// chunkCopy copies the data from r to w reading chunks of the given
+// sizes.
+func chunkCopy(w io.Writer, r io.Reader, sizes []int) error {
+	for i := 0; ; i++ {
+		p := make([]byte, sizes[i%len(sizes)])
+		n, err := r.Read(p)
+		w.Write(p[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestReaderWorkersHugeBlockSize(t *testing.T) {
+	var buf bytes.Buffer
+	hdr := header{flags: None}
+	p, err := hdr.MarshalBinary()
+	if err != nil {
+		t.Fatalf("hdr.MarshalBinary error %s", err)
+	}
+	buf.Write(p)
+	// The block consists of the LZMA2 end marker but declares an
+	// uncompressed size of 32 TiB.
+	bh := blockHeader{
+		compressedSize:   1,
+		uncompressedSize: 1 << 45,
+		filters:          []Filter{&LZMA2Filter{DictCap: 1 << 12}},
+	}
+	if p, err = bh.MarshalBinary(); err != nil {
+		t.Fatalf("bh.MarshalBinary error %s", err)
+	}
+	buf.Write(p)
+	buf.Write([]byte{0, 0, 0, 0})
+	r, err := ReaderConfig{Workers: 2}.NewReader(
+		onlyReader{bytes.NewReader(buf.Bytes())})
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.ReadAll(r); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("io.ReadAll error %v; want %v", err, ErrCorrupt)
+	}
+}
+
+func TestReaderWorkersMemLimit(t *testing.T) {
+	data := make([]byte, 1<<20)
+	io.ReadFull(randtxt.NewReader(rand.NewSource(5)), data)
+	var buf bytes.Buffer
+	w, err := WriterConfig{DictCap: 1 << 16, BlockSize: 1 << 18}.NewWriter(
+		&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	for _, memLimit := range []int64{1 << 19, 1 << 21} {
+		cfg := ReaderConfig{MemLimit: memLimit, Workers: 4}
+		r, err := cfg.NewReader(onlyReader{bytes.NewReader(buf.Bytes())})
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		p, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("MemLimit %d: io.ReadAll error %s", memLimit,
+				err)
+		}
+		if !bytes.Equal(p, data) {
+			t.Fatalf("MemLimit %d: decompressed data differs",
+				memLimit)
+		}
+	}
+
+	r := &streamReader{ReaderConfig: ReaderConfig{MemLimit: 100}}
+	r.cur = make([]byte, 10)
+	r.pending = []parJob{{mem: 50}}
+	tests := []struct {
+		size, n int64
+		want    bool
+	}{
+		{30, 10, true},
+		{30, 11, false},
+		{-1, 10, false},
+	}
+	for _, c := range tests {
+		if got := r.readAhead(c.size, c.n); got != c.want {
+			t.Errorf("readAhead(%d, %d) = %t; want %t",
+				c.size, c.n, got, c.want)
+		}
+	}
+}
+
+func TestReaderWorkersChecksum(t *testing.T) {
+	data, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	// The first block has an unpadded size of 4404 bytes and a
+	// CRC-64 check at the end.
+	data[12+4404-1] ^= 1
+	r, err := ReaderConfig{Workers: 4}.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.ReadAll(r); err == nil {
+		t.Fatal("io.ReadAll returned no error for wrong checksum")
+	}
+}
+
+func TestReaderMemLimit(t *testing.T) {
+	data, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	// blocks.xz uses a dictionary capacity of 8 MiB
+	for _, workers := range []int{0, 2} {
+		cfg := ReaderConfig{MemLimit: 4 << 20, Workers: workers}
+		r, err := cfg.NewReader(bytes.NewReader(data))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		var e *ErrMemLimit
+		if !errors.As(err, &e) {
+			t.Fatalf("workers %d: got error %v; want *ErrMemLimit",
+				workers, err)
+		}
+		if e.Need <= 8<<20 {
+			t.Fatalf("workers %d: memory needed %d; want more "+
+				"than %d", workers, e.Need, 8<<20)
+		}
+		cfg.MemLimit = 16 << 20
+		if r, err = cfg.NewReader(bytes.NewReader(data)); err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		p, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("io.ReadAll error %s", err)
+		}
+		if !bytes.Equal(p, blocksTestData()) {
+			t.Fatalf("workers %d: decompressed data differs", workers)
+		}
+	}
+	ra, err := ReaderConfig{MemLimit: 4 << 20}.NewReaderAt(
+		bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReaderAt error %s", err)
+	}
+	var e *ErrMemLimit
+	if _, err = ra.ReadAt(make([]byte, 10), 0); !errors.As(err, &e) {
+		t.Fatalf("ReadAt error %v; want *ErrMemLimit", err)
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	data := blocksTestData()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	// the block header doesn't declare the sizes
+	noSizes := bytes.Clone(buf.Bytes())
+	zeros := make([]byte, 100000)
+	buf.Reset()
+	if w, err = NewWriter(&buf); err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(zeros); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	zerosXZ := buf.Bytes()
+
+	tests := []struct {
+		name string
+		xz   io.Reader
+		cfg  ReaderConfig
+		want []byte
+		err  error
+	}{
+		// the header of the third block declares a size of 8000
+		{"header", onlyReader{bytes.NewReader(blocksXZ)},
+			ReaderConfig{MaxUncompressed: 20000}, data[:16000],
+			ErrMaxUncompressed},
+		{"headerWorkers", onlyReader{bytes.NewReader(blocksXZ)},
+			ReaderConfig{MaxUncompressed: 20000, Workers: 2},
+			data[:16000], ErrMaxUncompressed},
+		{"read", onlyReader{bytes.NewReader(noSizes)},
+			ReaderConfig{MaxUncompressed: 20000}, data[:20000],
+			ErrMaxUncompressed},
+		{"exact", onlyReader{bytes.NewReader(noSizes)},
+			ReaderConfig{MaxUncompressed: 40000}, data, nil},
+		{"ratio", onlyReader{bytes.NewReader(blocksXZ)},
+			ReaderConfig{MaxRatio: 10}, data, nil},
+		{"zeros", onlyReader{bytes.NewReader(zerosXZ)},
+			ReaderConfig{MaxRatio: 10}, nil, ErrMaxRatio},
+	}
+	for _, c := range tests {
+		r, err := c.cfg.NewReader(c.xz)
+		if err != nil {
+			t.Fatalf("%s: NewReader error %s", c.name, err)
+		}
+		var out bytes.Buffer
+		_, err = io.Copy(&out, r)
+		if err != c.err {
+			t.Fatalf("%s: io.Copy returned error %v; want %v",
+				c.name, err, c.err)
+		}
+		if c.want != nil && !bytes.Equal(out.Bytes(), c.want) {
+			t.Fatalf("%s: got %d bytes; want %d", c.name, out.Len(),
+				len(c.want))
+		}
+		if c.err == ErrMaxRatio && float64(out.Len()) >
+			c.cfg.MaxRatio*float64(len(zerosXZ)) {
+			t.Fatalf("%s: got %d bytes exceeding ratio", c.name,
+				out.Len())
+		}
+	}
+
+	// The indexes of seekable inputs are checked immediately.
+	_, err = ReaderConfig{MaxUncompressed: 20000}.NewReader(
+		bytes.NewReader(blocksXZ))
+	if err != ErrMaxUncompressed {
+		t.Fatalf("NewReader returned error %v; want %v", err,
+			ErrMaxUncompressed)
+	}
+	_, err = ReaderConfig{MaxRatio: 10}.NewReaderAt(
+		bytes.NewReader(zerosXZ), int64(len(zerosXZ)))
+	if err != ErrMaxRatio {
+		t.Fatalf("NewReaderAt returned error %v; want %v", err,
+			ErrMaxRatio)
+	}
+	if err = (&ReaderConfig{MaxRatio: -1}).Verify(); err == nil {
+		t.Fatal("Verify accepted negative MaxRatio")
+	}
+}
+
 func BenchmarkReader(b *testing.B) {
 	const testFile = "testdata/enwik7"
 	data, err := os.ReadFile(testFile)
@@ -0,0 +1,517 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// streamDesc describes an xz stream located by scanning the file
+// backward from the end.
+type streamDesc struct {
+	// offset of the stream header in the file
+	offset int64
+	// size of the stream including header and footer
+	size  int64
+	flags byte
+	// length of the stream padding following the stream
+	padding int64
+	index   []record
+	// length of the index including the index indicator
+	indexSize int64
+}
+
+// readAtFull reads len(p) bytes at offset off. The error
+// io.ErrUnexpectedEOF is returned if not all bytes could be read.
+func readAtFull(ra io.ReaderAt, p []byte, off int64) error {
+	n, err := ra.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// scanStreams locates all xz streams in the file of the given size by
+// reading the stream footers and indexes from the end of the file.
+// The streams are returned in file order.
+func scanStreams(ra io.ReaderAt, size int64) (streams []streamDesc,
+	err error) {
+
+	if size < 0 {
+		return nil, errors.New("xz: negative file size")
+	}
+	if size%4 != 0 {
+		return nil, locate(formatError(ErrCorrupt,
+			"xz: file size not a multiple of four"), size, -1, -1)
+	}
+	pos := size
+	p := make([]byte, footerLen)
+	for pos > 0 {
+		// stream padding
+		var padding int64
+		for pos > 0 {
+			if err = readAtFull(ra, p[:4], pos-4); err != nil {
+				return nil, locate(err, pos-4, -1, -1)
+			}
+			if !allZeros(p[:4]) {
+				break
+			}
+			pos -= 4
+			padding += 4
+		}
+		if pos == 0 {
+			return nil, locate(formatError(ErrCorrupt,
+				"xz: file starts with padding"), 0, -1, -1)
+		}
+
+		// footer
+		footerStart := pos - footerLen
+		if pos < HeaderLen+footerLen {
+			return nil, locate(formatError(ErrTruncated,
+				"xz: stream too short"), 0, -1, -1)
+		}
+		if err = readAtFull(ra, p, footerStart); err != nil {
+			return nil, locate(err, footerStart, -1, -1)
+		}
+		var f footer
+		if err = f.UnmarshalBinary(p); err != nil {
+			return nil, locate(err, footerStart, -1, -1)
+		}
+
+		// index
+		indexStart := footerStart - f.indexSize
+		if indexStart < HeaderLen {
+			return nil, locate(formatError(ErrCorrupt,
+				"xz: index size in footer wrong"),
+				footerStart, -1, -1)
+		}
+		sr := io.NewSectionReader(ra, indexStart, f.indexSize)
+		if err = readAtFull(sr, p[:1], 0); err != nil {
+			return nil, locate(err, indexStart, -1, -1)
+		}
+		if p[0] != 0 {
+			return nil, locate(formatError(ErrCorrupt,
+				"xz: index indicator expected"),
+				indexStart, -1, -1)
+		}
+		if _, err = sr.Seek(1, io.SeekStart); err != nil {
+			return nil, err
+		}
+		index, n, err := readIndexBody(sr, -1)
+		if err != nil {
+			if err == io.EOF {
+				// the index is shorter than its size in
+				// the footer
+				err = formatError(ErrCorrupt,
+					"xz: index size in footer wrong")
+			}
+			return nil, locate(err, indexStart+1+n, -1, -1)
+		}
+		if n+1 != f.indexSize {
+			return nil, locate(formatError(ErrCorrupt,
+				"xz: index size in footer wrong"),
+				footerStart, -1, -1)
+		}
+
+		// blocks
+		var blocksSize int64
+		for _, rec := range index {
+			s := rec.unpaddedSize + int64(padLen(rec.unpaddedSize))
+			if s > indexStart-HeaderLen-blocksSize {
+				return nil, locate(formatError(ErrCorrupt,
+					"xz: index records too large"),
+					indexStart, -1, -1)
+			}
+			blocksSize += s
+		}
+
+		// header
+		offset := indexStart - blocksSize - HeaderLen
+		if err = readAtFull(ra, p[:HeaderLen], offset); err != nil {
+			return nil, locate(err, offset, -1, -1)
+		}
+		var h header
+		if err = h.UnmarshalBinary(p[:HeaderLen]); err != nil {
+			return nil, locate(err, offset, -1, -1)
+		}
+		if h.flags != f.flags {
+			return nil, locate(formatError(ErrCorrupt,
+				"xz: footer flags incorrect"), footerStart, -1, -1)
+		}
+
+		streams = append(streams, streamDesc{
+			offset:    offset,
+			size:      pos - offset,
+			flags:     h.flags,
+			padding:   padding,
+			index:     index,
+			indexSize: f.indexSize,
+		})
+		pos = offset
+	}
+	if len(streams) == 0 {
+		return nil, locate(formatError(ErrTruncated,
+			"xz: no stream found"), 0, -1, -1)
+	}
+	for i, j := 0, len(streams)-1; i < j; i, j = i+1, j-1 {
+		streams[i], streams[j] = streams[j], streams[i]
+	}
+	return streams, nil
+}
+
+// blockDesc describes the position of a block in the xz file and in
+// the uncompressed data.
+type blockDesc struct {
+	record
+	// offset of the block header in the file
+	offset int64
+	// offset of the block data in the uncompressed data
+	uncompressedOffset int64
+	// check flags of the stream containing the block
+	flags byte
+	// index of the stream and of the block in the stream
+	stream int
+	block  int
+}
+
+// readerAtCacheLen defines the number of decoded blocks kept by a
+// ReaderAt.
+const readerAtCacheLen = 8
+
+// ReaderAt provides random access to the uncompressed data of an xz
+// file. It supports multiple streams and stream padding. Only the
+// blocks covering a requested range are decoded. The blocks are always
+// decoded completely and a small number of decoded blocks is cached,
+// so the ReaderAt is most useful for files with small block sizes.
+//
+// ReadAt can be called concurrently. Read and Seek use an offset shared
+// by all callers.
+type ReaderAt struct {
+	ReaderConfig
+
+	ra     io.ReaderAt
+	size   int64
+	blocks []blockDesc
+
+	mu    sync.Mutex
+	cache blockCache
+	off   int64
+}
+
+// NewReaderAt creates a ReaderAt for the xz file of the given size
+// using the default parameters.
+func NewReaderAt(xz io.ReaderAt, size int64) (r *ReaderAt, err error) {
+	return ReaderConfig{}.NewReaderAt(xz, size)
+}
+
+// NewReaderAt creates a ReaderAt for the xz file of the given size. The
+// function locates all streams and reads their indexes. If the
+// SingleStream parameter is set, the file must contain a single stream
+// without padding. The limits MaxUncompressed and MaxRatio are checked
+// against the sizes recorded in the indexes. Since the blocks are
+// decoded completely, the uncompressed size of every block must not
+// exceed MemLimit.
+func (c ReaderConfig) NewReaderAt(xz io.ReaderAt, size int64) (r *ReaderAt,
+	err error) {
+
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+	streams, err := scanStreams(xz, size)
+	if err != nil {
+		return nil, err
+	}
+	if c.SingleStream && (len(streams) > 1 || streams[0].padding > 0) {
+		return nil, errUnexpectedData
+	}
+	if err = c.limits().checkStreams(streams); err != nil {
+		return nil, err
+	}
+	r = &ReaderAt{
+		ReaderConfig: c,
+		ra:           xz,
+		cache:        blockCache{max: readerAtCacheLen},
+	}
+	for i, s := range streams {
+		if err = c.checkStream(s.offset, s.flags); err != nil {
+			return nil, locate(err, s.offset, i, -1)
+		}
+		offset := s.offset + HeaderLen
+		for j, rec := range s.index {
+			if err = c.checkRecord(rec); err != nil {
+				return nil, locate(err, -1, i, j)
+			}
+			if rec.uncompressedSize > maxInt64-r.size {
+				return nil, locate(formatError(ErrCorrupt,
+					"xz: uncompressed size overflow"),
+					-1, i, j)
+			}
+			r.blocks = append(r.blocks, blockDesc{
+				record:             rec,
+				offset:             offset,
+				uncompressedOffset: r.size,
+				flags:              s.flags,
+				stream:             i,
+				block:              j,
+			})
+			offset += rec.unpaddedSize +
+				int64(padLen(rec.unpaddedSize))
+			r.size += rec.uncompressedSize
+		}
+	}
+	return r, nil
+}
+
+// Size returns the size of the uncompressed data.
+func (r *ReaderAt) Size() int64 { return r.size }
+
+// ReadAt reads len(p) bytes of uncompressed data starting at offset
+// off. It returns io.EOF if fewer bytes are read because the end of the
+// data has been reached.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("xz: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	i := sort.Search(len(r.blocks), func(i int) bool {
+		b := &r.blocks[i]
+		return b.uncompressedOffset+b.uncompressedSize > off
+	})
+	for ; n < len(p) && i < len(r.blocks); i++ {
+		b := &r.blocks[i]
+		if b.uncompressedSize == 0 {
+			continue
+		}
+		data, err := r.block(i)
+		if err != nil {
+			return n, err
+		}
+		k := copy(p[n:], data[off+int64(n)-b.uncompressedOffset:])
+		n += k
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read reads uncompressed data from the current offset.
+func (r *ReaderAt) Read(p []byte) (n int, err error) {
+	r.mu.Lock()
+	off := r.off
+	r.mu.Unlock()
+	n, err = r.ReadAt(p, off)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	r.mu.Lock()
+	r.off = off + int64(n)
+	r.mu.Unlock()
+	return n, err
+}
+
+// Seek sets the offset for the next Read. Offsets beyond the end of the
+// uncompressed data are allowed.
+func (r *ReaderAt) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.off, errors.New("xz: invalid whence")
+	}
+	if offset < 0 {
+		return r.off, errors.New("xz: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// block returns the uncompressed data of block i using the cache.
+func (r *ReaderAt) block(i int) (data []byte, err error) {
+	r.mu.Lock()
+	data, ok := r.cache.get(i)
+	r.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+	if data, err = r.decodeBlock(&r.blocks[i]); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cache.put(i, data)
+	r.mu.Unlock()
+	return data, nil
+}
+
+// maxBlockRatio bounds the ratio of the uncompressed size of a block to
+// its unpadded size. LZMA2 cannot compress data by more than a factor
+// of about 7000 and the other filters of the xz format don't change the
+// size of the data.
+const maxBlockRatio = 1 << 14
+
+// checkRecord checks the uncompressed size of an index record before
+// the block is decoded. The size must be possible for the unpadded size
+// of the block and must not exceed the limits of the configuration.
+func (c *ReaderConfig) checkRecord(rec record) error {
+	u := rec.uncompressedSize
+	if rec.unpaddedSize <= maxInt64/maxBlockRatio &&
+		u > rec.unpaddedSize*maxBlockRatio {
+		return formatError(ErrCorrupt,
+			"xz: uncompressed size impossible for unpadded size")
+	}
+	if c.MaxUncompressed > 0 && u > c.MaxUncompressed {
+		return ErrMaxUncompressed
+	}
+	if c.MemLimit > 0 && u > c.MemLimit {
+		return &ErrMemLimit{Need: u, Limit: c.MemLimit}
+	}
+	if u > int64(maxInt) {
+		return errors.New("xz: block too large for ReaderAt")
+	}
+	return nil
+}
+
+// preallocRatio limits the size of the buffer allocated before a block
+// is decoded to a multiple of the compressed size of the block.
+const preallocRatio = 8
+
+// bufferSize returns the number of bytes to allocate for the
+// uncompressed data of a block before the block is decoded. The size
+// declared for the block is negative if unknown. It cannot be trusted,
+// so the result is limited by the compressed size and by MemLimit.
+func (c *ReaderConfig) bufferSize(declared, compressed int64) int {
+	n := int64(maxInt)
+	if compressed <= n/preallocRatio {
+		n = compressed * preallocRatio
+	}
+	if 0 <= declared && declared < n {
+		n = declared
+	}
+	if 0 < c.MemLimit && c.MemLimit < n {
+		n = c.MemLimit
+	}
+	return int(n)
+}
+
+// decodeBlock decodes the complete block and verifies its checksum. The
+// buffer for the data grows while the block is decoded, so the record
+// of a damaged index cannot cause the allocation of a huge buffer.
+func (r *ReaderAt) decodeBlock(b *blockDesc) (data []byte, err error) {
+	sr := io.NewSectionReader(r.ra, b.offset,
+		b.unpaddedSize+int64(padLen(b.unpaddedSize)))
+	h, hlen, err := readBlockHeader(sr)
+	if err != nil {
+		if err == io.EOF || err == errIndexIndicator {
+			err = formatError(ErrCorrupt, "xz: block header expected")
+		}
+		return nil, b.locate(err, b.offset)
+	}
+	newHash, err := r.ReaderConfig.newCheckFunc(b.flags)
+	if err != nil {
+		return nil, err
+	}
+	dataOffset := b.offset + int64(hlen)
+	br, err := r.ReaderConfig.newBlockReader(sr, dataOffset, h, hlen,
+		newHash(), nil)
+	if err != nil {
+		return nil, b.locate(err, b.offset)
+	}
+	var buf bytes.Buffer
+	buf.Grow(r.ReaderConfig.bufferSize(b.uncompressedSize,
+		b.unpaddedSize))
+	lr := io.LimitReader(br, b.uncompressedSize)
+	if _, err = io.Copy(&buf, lr); err != nil {
+		return nil, b.locate(err, dataOffset+br.lxz.n)
+	}
+	if int64(buf.Len()) < b.uncompressedSize {
+		return nil, b.locate(formatError(ErrCorrupt,
+			"xz: block smaller than recorded in index"),
+			dataOffset+br.lxz.n)
+	}
+	// reading the end of the block verifies the checksum
+	var q [1]byte
+	for {
+		k, err := br.Read(q[:])
+		if k > 0 {
+			return nil, b.locate(formatError(ErrCorrupt,
+				"xz: block larger than recorded in index"),
+				dataOffset+br.lxz.n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, b.locate(err, -1)
+		}
+	}
+	if rec := br.record(); rec != b.record {
+		return nil, b.locate(formatError(ErrCorrupt, fmt.Sprintf(
+			"xz: block is %v; want %v", rec, b.record)), b.offset)
+	}
+	return buf.Bytes(), nil
+}
+
+// locate adds the offset and the stream and block index of the block to
+// a *FormatError.
+func (b *blockDesc) locate(err error, offset int64) error {
+	return locate(err, offset, b.stream, b.block)
+}
+
+// maxInt defines the maximum value of the int type.
+const maxInt = int(^uint(0) >> 1)
+
+// blockCache is a least-recently-used cache for decoded blocks.
+type blockCache struct {
+	// entries sorted from the most to the least recently used
+	entries []cacheEntry
+	max     int
+}
+
+// cacheEntry stores the data of a decoded block.
+type cacheEntry struct {
+	i    int
+	data []byte
+}
+
+// get returns the data for block i and marks the block as most recently
+// used.
+func (c *blockCache) get(i int) (data []byte, ok bool) {
+	for j, e := range c.entries {
+		if e.i == i {
+			copy(c.entries[1:j+1], c.entries[:j])
+			c.entries[0] = e
+			return e.data, true
+		}
+	}
+	return nil, false
+}
+
+// put adds the data for block i to the cache. The least recently used
+// block is removed if the cache is full.
+func (c *blockCache) put(i int, data []byte) {
+	if _, ok := c.get(i); ok {
+		return
+	}
+	if len(c.entries) < c.max {
+		c.entries = append(c.entries, cacheEntry{})
+	}
+	copy(c.entries[1:], c.entries)
+	c.entries[0] = cacheEntry{i: i, data: data}
+}
@@ -0,0 +1,244 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+// multiStreamFile creates an xz file with several streams containing
+// multiple blocks and stream padding. It returns the file and the
+// uncompressed data.
+func multiStreamFile(t *testing.T) (xzData, data []byte) {
+	var buf, dbuf bytes.Buffer
+	txt := randtxt.NewReader(rand.NewSource(23))
+	for i, n := range []int64{10000, 0, 3000, 25000} {
+		cfg := WriterConfig{BlockSize: 4096, CheckSum: CRC32}
+		if i%2 == 1 {
+			cfg.CheckSum = SHA256
+		}
+		w, err := cfg.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if _, err = io.CopyN(io.MultiWriter(w, &dbuf), txt, n); err != nil {
+			t.Fatalf("io.CopyN error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		// stream padding
+		buf.Write(make([]byte, 4*i))
+	}
+	return buf.Bytes(), dbuf.Bytes()
+}
+
+func TestReaderAt(t *testing.T) {
+	xzData, data := multiStreamFile(t)
+	r, err := NewReaderAt(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("NewReaderAt error %s", err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("r.Size() returned %d; want %d", r.Size(), len(data))
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		off := rnd.Int63n(int64(len(data)))
+		p := make([]byte, rnd.Intn(10000))
+		n, err := r.ReadAt(p, off)
+		want := data[off:]
+		if len(want) > len(p) {
+			want = want[:len(p)]
+		}
+		if n != len(want) {
+			t.Fatalf("ReadAt(%d, %d) returned %d bytes; want %d",
+				len(p), off, n, len(want))
+		}
+		if n < len(p) && err != io.EOF {
+			t.Fatalf("ReadAt(%d, %d) error %v; want io.EOF",
+				len(p), off, err)
+		}
+		if n == len(p) && err != nil {
+			t.Fatalf("ReadAt(%d, %d) error %s", len(p), off, err)
+		}
+		if !bytes.Equal(p[:n], want) {
+			t.Fatalf("ReadAt(%d, %d) returned wrong data",
+				len(p), off)
+		}
+	}
+	if _, err = r.ReadAt(make([]byte, 1), int64(len(data))); err != io.EOF {
+		t.Fatalf("ReadAt at end returned %v; want io.EOF", err)
+	}
+}
+
+func TestReaderAtSeek(t *testing.T) {
+	xzData, data := multiStreamFile(t)
+	r, err := NewReaderAt(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("NewReaderAt error %s", err)
+	}
+	off, err := r.Seek(-5000, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("Seek error %s", err)
+	}
+	if off != int64(len(data))-5000 {
+		t.Fatalf("Seek returned %d; want %d", off, len(data)-5000)
+	}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(p, data[off:]) {
+		t.Fatal("data read after Seek differs")
+	}
+	if _, err = r.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("Seek to negative position returned no error")
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek error %s", err)
+	}
+	p, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(p, data) {
+		t.Fatal("data read after Seek to start differs")
+	}
+}
+
+func TestReaderAtFile(t *testing.T) {
+	f, err := os.Open("testdata/x86.xz")
+	if err != nil {
+		t.Fatalf("os.Open error %s", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("f.Stat error %s", err)
+	}
+	r, err := NewReaderAt(f, fi.Size())
+	if err != nil {
+		t.Fatalf("NewReaderAt error %s", err)
+	}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(p, x86TestData()) {
+		t.Fatal("decompressed data differs from original")
+	}
+}
+
+func TestReaderAtErrors(t *testing.T) {
+	xzData, _ := multiStreamFile(t)
+	corrupt := bytes.Clone(xzData)
+	// modify the compressed data of the first block
+	corrupt[100] ^= 0xff
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"padding", make([]byte, 8)},
+		{"truncated", xzData[:len(xzData)-16]},
+		{"unaligned", xzData[:len(xzData)-1]},
+	}
+	for _, c := range tests {
+		_, err := NewReaderAt(bytes.NewReader(c.data), int64(len(c.data)))
+		if err == nil {
+			t.Errorf("%s: NewReaderAt returned no error", c.name)
+		}
+	}
+	r, err := NewReaderAt(bytes.NewReader(corrupt), int64(len(corrupt)))
+	if err != nil {
+		t.Fatalf("NewReaderAt error %s", err)
+	}
+	if _, err = r.ReadAt(make([]byte, 10), 0); err == nil {
+		t.Fatal("ReadAt on corrupt block returned no error")
+	}
+	_, err = ReaderConfig{SingleStream: true}.NewReaderAt(
+		bytes.NewReader(xzData), int64(len(xzData)))
+	if err == nil {
+		t.Fatal("NewReaderAt with SingleStream returned no error")
+	}
+}
+
+// replaceIndex replaces the index of the single stream xz file by a
+// modified copy of the index and updates the footer.
+func replaceIndex(t *testing.T, xzData []byte, modify func(index []record),
+) []byte {
+	streams, err := scanStreams(bytes.NewReader(xzData),
+		int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("scanStreams error %s", err)
+	}
+	s := streams[0]
+	index := append([]record(nil), s.index...)
+	modify(index)
+	indexStart := s.offset + s.size - footerLen - s.indexSize
+	var buf bytes.Buffer
+	buf.Write(xzData[:indexStart])
+	n, err := writeIndex(&buf, index)
+	if err != nil {
+		t.Fatalf("writeIndex error %s", err)
+	}
+	f := footer{indexSize: n, flags: s.flags}
+	p, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("f.MarshalBinary error %s", err)
+	}
+	buf.Write(p)
+	return buf.Bytes()
+}
+
+func TestReaderAtIndexSizes(t *testing.T) {
+	xzData, err := os.ReadFile("fox.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	huge := replaceIndex(t, xzData, func(index []record) {
+		index[0].uncompressedSize = 1 << 45
+	})
+	_, err = NewReaderAt(bytes.NewReader(huge), int64(len(huge)))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("NewReaderAt error %v; want %v", err, ErrCorrupt)
+	}
+
+	cfg := ReaderConfig{MemLimit: 40}
+	_, err = cfg.NewReaderAt(bytes.NewReader(xzData), int64(len(xzData)))
+	var e *ErrMemLimit
+	if !errors.As(err, &e) {
+		t.Fatalf("NewReaderAt error %v; want *ErrMemLimit", err)
+	}
+	cfg = ReaderConfig{MaxUncompressed: 40}
+	_, err = cfg.NewReaderAt(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != ErrMaxUncompressed {
+		t.Fatalf("NewReaderAt error %v; want %v", err,
+			ErrMaxUncompressed)
+	}
+
+	for _, d := range []int64{-1, 1, 1000} {
+		wrong := replaceIndex(t, xzData, func(index []record) {
+			index[0].uncompressedSize += d
+		})
+		r, err := NewReaderAt(bytes.NewReader(wrong), int64(len(wrong)))
+		if err != nil {
+			t.Fatalf("NewReaderAt error %s", err)
+		}
+		_, err = io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("size %+d: read error %v; want %v", d, err,
+				ErrCorrupt)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// unreadReader is a reader that supports pushing back data that has
+// already been read.
+type unreadReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// Read reads the data pushed back first and then from the underlying
+// reader.
+func (u *unreadReader) Read(p []byte) (n int, err error) {
+	if len(u.buf) > 0 {
+		n = copy(p, u.buf)
+		u.buf = u.buf[n:]
+		return n, nil
+	}
+	return u.r.Read(p)
+}
+
+// unread pushes the data in p back. It will be read before the data
+// pushed back earlier.
+func (u *unreadReader) unread(p []byte) {
+	buf := make([]byte, len(p)+len(u.buf))
+	n := copy(buf, p)
+	copy(buf[n:], u.buf)
+	u.buf = buf
+}
+
+// unread pushes data back into the input of the Reader.
+func (p *readProgress) unread(q []byte) {
+	p.ur.unread(q)
+	p.cxz.n -= int64(len(q))
+}
+
+// report calls the Recover function for the damaged block starting at
+// offset off. It returns false if salvaging isn't active or the error
+// doesn't describe a problem of the compressed data.
+func (r *streamReader) report(off int64, err error) bool {
+	var e *FormatError
+	if r.Recover == nil || r.prog == nil || !errors.As(err, &e) {
+		return false
+	}
+	r.Recover(off, locate(err, -1, r.stream, -1))
+	return true
+}
+
+// skipRecord adds the record for a damaged block to the index. If the
+// record isn't known from the index of a seekable input, a placeholder
+// is used and the records of the index are not compared anymore.
+func (r *streamReader) skipRecord() (rec record, ok bool) {
+	if i := len(r.index); i < len(r.records) {
+		rec, ok = r.records[i], true
+	} else {
+		r.damaged = true
+	}
+	r.index = append(r.index, rec)
+	return rec, ok
+}
+
+// salvage reports the damaged block starting at offset off and
+// positions the input at the next block header. The position is
+// computed from the index of a seekable input if possible; otherwise
+// the input is scanned. If the scan finds the end of the stream or
+// the input, io.EOF is returned. Errors that cannot be salvaged are
+// returned unchanged.
+func (r *streamReader) salvage(off int64, err error) error {
+	if !r.report(off, err) {
+		return err
+	}
+	r.br = nil
+	rec, ok := r.skipRecord()
+	if ok && off >= 0 {
+		next := off + rec.unpaddedSize + int64(padLen(rec.unpaddedSize))
+		if d := next - r.offset(); d >= 0 {
+			if _, err = io.CopyN(io.Discard, r.xz, d); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return locate(err, r.offset(), -1, -1)
+			}
+			return nil
+		}
+		r.damaged = true
+	}
+	return r.scan()
+}
+
+// scanBufLen is the size of the buffer used for scanning. It must be
+// larger than the maximum block header length.
+const scanBufLen = 1 << 16
+
+// maxBlockHeaderLen is the maximum length of a block header.
+const maxBlockHeaderLen = 1024
+
+// scan searches the input for a valid block header, a stream footer or
+// the header of the next stream at positions aligned to four bytes
+// relative to the start of the stream. If a block header is found the
+// input is positioned at it and nil is returned. A stream footer or a
+// stream header terminates the stream and io.EOF is returned as for
+// the end of the input.
+func (r *streamReader) scan() error {
+	k := padLen(r.offset() - r.start)
+	if _, err := io.CopyN(io.Discard, r.xz, int64(k)); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return err
+	}
+	p := make([]byte, 0, scanBufLen)
+	var err error
+	for {
+		if err == nil {
+			var n int
+			n, err = io.ReadFull(r.xz, p[len(p):cap(p)])
+			p = p[:len(p)+n]
+		}
+		end := len(p) - maxBlockHeaderLen
+		if err != nil {
+			end = len(p)
+		}
+		i := 0
+		for ; i < end; i += 4 {
+			q := p[i:]
+			switch {
+			case isBlockHeader(q):
+				r.prog.unread(q)
+				return nil
+			case isFooter(q):
+				r.prog.unread(q[footerLen:])
+				return io.EOF
+			case isStreamHeader(q):
+				r.prog.unread(q)
+				return io.EOF
+			}
+		}
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return err
+		}
+		p = p[:copy(p, p[i:])]
+	}
+}
+
+// isBlockHeader checks whether p starts with a valid block header.
+func isBlockHeader(p []byte) bool {
+	if len(p) == 0 || p[0] == 0 {
+		return false
+	}
+	n := (int(p[0]) + 1) * 4
+	if len(p) < n {
+		return false
+	}
+	var h blockHeader
+	return h.UnmarshalBinary(p[:n]) == nil
+}
+
+// isFooter checks whether p starts with a valid stream footer.
+func isFooter(p []byte) bool {
+	if len(p) < footerLen || !bytes.Equal(p[10:12], footerMagic) {
+		return false
+	}
+	var f footer
+	return f.UnmarshalBinary(p[:footerLen]) == nil
+}
+
+// isStreamHeader checks whether p starts with a valid stream header.
+func isStreamHeader(p []byte) bool {
+	if len(p) < HeaderLen || !bytes.Equal(p[:6], headerMagic) {
+		return false
+	}
+	var h header
+	return h.UnmarshalBinary(p[:HeaderLen]) == nil
+}
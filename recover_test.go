@@ -0,0 +1,162 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+)
+
+// salvageAll reads xzData in salvage mode and returns the data and the
+// errors reported to the Recover function.
+func salvageAll(t *testing.T, xzData []byte, workers int, seekable bool) (
+	data []byte, offsets []int64, errs []error) {
+
+	cfg := ReaderConfig{
+		Workers: workers,
+		Recover: func(offset int64, err error) {
+			offsets = append(offsets, offset)
+			errs = append(errs, err)
+		},
+	}
+	var xz io.Reader = bytes.NewReader(xzData)
+	if !seekable {
+		xz = onlyReader{xz}
+	}
+	r, err := cfg.NewReader(xz)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if data, err = io.ReadAll(r); err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	return data, offsets, errs
+}
+
+func TestReaderRecover(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	want := blocksTestData()
+	// The blocks of blocks.xz start at the offsets 12, 4416, 8784,
+	// 13132 and 17504 and contain 8000 bytes each.
+	tests := []struct {
+		name   string
+		modify func(p []byte)
+		block  int
+		offset int64
+		kind   error
+		// exact is false if the data of the damaged block might
+		// have been partly returned
+		exact bool
+	}{
+		{"data", func(p []byte) { p[6000] ^= 0x55 }, 1, 4416,
+			nil, false},
+		{"check", func(p []byte) { p[13131] ^= 1 }, 2, 8784,
+			ErrChecksum, false},
+		{"header", func(p []byte) { p[8789] ^= 1 }, 2, 8784,
+			ErrChecksum, true},
+		{"filter", func(p []byte) {
+			p[13132+6] = 0x7f
+			putUint32LE(p[13132+12:],
+				crc32.ChecksumIEEE(p[13132:13132+12]))
+		}, 3, 13132, ErrUnsupported, true},
+	}
+	for _, c := range tests {
+		xzData := bytes.Clone(blocksXZ)
+		c.modify(xzData)
+		for _, workers := range []int{1, 2} {
+			for _, seekable := range []bool{false, true} {
+				data, offsets, errs := salvageAll(t, xzData,
+					workers, seekable)
+				if len(errs) != 1 {
+					t.Fatalf("%s: got %d errors; want 1",
+						c.name, len(errs))
+				}
+				if offsets[0] != c.offset {
+					t.Fatalf("%s: got offset %d; want %d",
+						c.name, offsets[0], c.offset)
+				}
+				var e *FormatError
+				if !errors.As(errs[0], &e) {
+					t.Fatalf("%s: error %v is not a *FormatError",
+						c.name, errs[0])
+				}
+				if e.Block != c.block || e.Stream != 0 {
+					t.Fatalf("%s: got block %d stream %d;"+
+						" want %d and 0", c.name, e.Block,
+						e.Stream, c.block)
+				}
+				if c.kind != nil && !errors.Is(e, c.kind) {
+					t.Fatalf("%s: got error %v; want %v",
+						c.name, e, c.kind)
+				}
+				start := c.block * 8000
+				if !bytes.HasPrefix(data, want[:start]) ||
+					!bytes.HasSuffix(data, want[start+8000:]) {
+					t.Fatalf("%s: workers %d seekable %t:"+
+						" data differs", c.name, workers,
+						seekable)
+				}
+				exact := c.exact || workers > 1
+				if exact && len(data) != len(want)-8000 {
+					t.Fatalf("%s: got %d bytes; want %d",
+						c.name, len(data), len(want)-8000)
+				}
+			}
+		}
+	}
+}
+
+func TestReaderRecoverTruncated(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	want := blocksTestData()
+	for _, workers := range []int{1, 2} {
+		data, _, errs := salvageAll(t, blocksXZ[:10000], workers, true)
+		if len(errs) != 1 || !errors.Is(errs[0], ErrTruncated) {
+			t.Fatalf("got errors %v; want one truncation", errs)
+		}
+		if !bytes.HasPrefix(data, want[:16000]) {
+			t.Fatalf("workers %d: data differs", workers)
+		}
+	}
+}
+
+func TestReaderRecoverIndex(t *testing.T) {
+	xzData, want := multiStreamFile(t)
+	xzData = bytes.Clone(xzData)
+	// The second stream follows the first one directly. Damage the
+	// CRC32 of the index of the first stream.
+	i := bytes.Index(xzData[1:], headerMagic) + 1
+	xzData[i-footerLen-1] ^= 1
+	for _, seekable := range []bool{false, true} {
+		data, _, errs := salvageAll(t, xzData, 1, seekable)
+		if len(errs) != 1 || !errors.Is(errs[0], ErrChecksum) {
+			t.Fatalf("got errors %v; want one checksum error",
+				errs)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("seekable %t: data differs", seekable)
+		}
+	}
+
+	// Without salvage mode the error is returned.
+	r, err := NewReader(bytes.NewReader(xzData))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if _, err = io.ReadAll(r); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("io.ReadAll returned error %v; want %v", err,
+			ErrChecksum)
+	}
+}
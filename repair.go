@@ -0,0 +1,153 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// RepairReport describes the data recovered by Repair.
+type RepairReport struct {
+	// number of streams written
+	Streams int
+	// number of blocks kept
+	Blocks int
+	// size of the uncompressed data of the blocks kept
+	Uncompressed int64
+	// number of bytes written to the destination
+	Written int64
+	// Errs lists the problems found in the input. Each problem
+	// caused the drop of a block, of an index or of the tail of the
+	// input.
+	Errs []error
+}
+
+// Repair copies the xz streams from src to dst keeping every block that
+// can be decoded and verified. Damaged blocks and an incomplete tail
+// are dropped and the indexes and stream footers are rebuilt, so that
+// dst receives a valid xz file. The problems found are listed in the
+// report. An error is returned if src doesn't start with an xz stream
+// or reading or writing fails.
+func Repair(dst io.Writer, src io.Reader) (report *RepairReport, err error) {
+	report = new(RepairReport)
+	cfg := ReaderConfig{
+		Recover: func(offset int64, err error) {
+			report.Errs = append(report.Errs, err)
+		},
+	}
+	var prog readProgress
+	prog.ur = unreadReader{r: src}
+	prog.cxz = countingReader{r: &prog.ur}
+	cw := countingWriter{w: dst}
+	defer func() { report.Written = cw.n }()
+	for {
+		off := prog.cxz.n
+		sr, err := cfg.newStreamReader(&prog.cxz)
+		if err != nil {
+			switch {
+			case err == errPadding:
+				continue
+			case err == io.EOF:
+				if report.Streams > 0 {
+					return report, nil
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			err = locate(err, off, report.Streams, -1)
+			var e *FormatError
+			if report.Streams == 0 || !errors.As(err, &e) {
+				return report, err
+			}
+			// The rest of the input cannot be used.
+			report.Errs = append(report.Errs, err)
+			return report, nil
+		}
+		sr.prog = &prog
+		sr.start = off
+		sr.stream = report.Streams
+		if err = sr.repair(&cw, report); err != nil {
+			return report, err
+		}
+		report.Streams++
+	}
+}
+
+// repair writes the stream header, the blocks that can be verified and
+// a new index and stream footer to w.
+func (r *streamReader) repair(w io.Writer, report *RepairReport) error {
+	data, err := r.h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	var kept []record
+	var raw bytes.Buffer
+	for {
+		r.blockOff = r.offset()
+		raw.Reset()
+		tee := io.TeeReader(r.xz, &raw)
+		var (
+			bh   *blockHeader
+			hlen int
+		)
+		bh, hlen, err = readBlockHeader(tee)
+		switch {
+		case err == errIndexIndicator:
+			if err = r.readTail(); err == nil {
+				return writeTail(w, r.h.flags, kept)
+			}
+			err = locate(err, r.blockOff, -1, -1)
+		case err != nil:
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			err = locate(err, r.blockOff, -1, len(r.index))
+		default:
+			var br *blockReader
+			br, err = r.ReaderConfig.newBlockReader(tee,
+				r.offset(), bh, hlen, r.newHash(), nil)
+			if err == nil {
+				_, err = io.Copy(io.Discard, br)
+			}
+			if err == nil {
+				if _, err = w.Write(raw.Bytes()); err != nil {
+					return err
+				}
+				rec := br.record()
+				r.index = append(r.index, rec)
+				kept = append(kept, rec)
+				report.Blocks++
+				report.Uncompressed += rec.uncompressedSize
+				continue
+			}
+			err = locate(err, r.blockOff, -1, len(r.index))
+		}
+		if err = r.salvage(r.blockOff, err); err != nil {
+			if err == io.EOF {
+				return writeTail(w, r.h.flags, kept)
+			}
+			return err
+		}
+	}
+}
+
+// writeTail writes the index and the stream footer.
+func writeTail(w io.Writer, flags byte, index []record) error {
+	f := footer{flags: flags}
+	var err error
+	if f.indexSize, err = writeIndex(w, index); err != nil {
+		return err
+	}
+	p, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(p)
+	return err
+}
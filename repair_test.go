@@ -0,0 +1,108 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// repairAll repairs xzData and returns the repaired file, its
+// uncompressed data and the report.
+func repairAll(t *testing.T, xzData []byte) (repaired, data []byte,
+	report *RepairReport) {
+
+	var buf bytes.Buffer
+	report, err := Repair(&buf, onlyReader{bytes.NewReader(xzData)})
+	if err != nil {
+		t.Fatalf("Repair error %s", err)
+	}
+	if report.Written != int64(buf.Len()) {
+		t.Fatalf("report.Written is %d; want %d", report.Written,
+			buf.Len())
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	if data, err = io.ReadAll(r); err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if report.Uncompressed != int64(len(data)) {
+		t.Fatalf("report.Uncompressed is %d; want %d",
+			report.Uncompressed, len(data))
+	}
+	return buf.Bytes(), data, report
+}
+
+func TestRepair(t *testing.T) {
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	want := blocksTestData()
+
+	repaired, data, report := repairAll(t, blocksXZ)
+	if !bytes.Equal(repaired, blocksXZ) {
+		t.Fatalf("repair of a valid file changed it")
+	}
+	if report.Streams != 1 || report.Blocks != 5 || len(report.Errs) > 0 {
+		t.Fatalf("got report %+v for valid file", report)
+	}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("data differs")
+	}
+
+	// The third block starts at offset 8784.
+	for _, n := range []int{10000, 8784, 21900} {
+		_, data, report = repairAll(t, blocksXZ[:n])
+		if len(report.Errs) != 1 ||
+			!errors.Is(report.Errs[0], ErrTruncated) {
+			t.Fatalf("truncated at %d: got errors %v", n,
+				report.Errs)
+		}
+		m := 16000
+		if n > 17504 {
+			m = 40000
+		}
+		if !bytes.Equal(data, want[:m]) {
+			t.Fatalf("truncated at %d: got %d bytes; want %d",
+				n, len(data), m)
+		}
+	}
+
+	// damaged second block
+	p := bytes.Clone(blocksXZ)
+	p[6000] ^= 0x55
+	_, data, report = repairAll(t, p)
+	if report.Blocks != 4 || len(report.Errs) != 1 {
+		t.Fatalf("got report %+v for damaged block", report)
+	}
+	if !bytes.Equal(data, append(want[:8000:8000], want[16000:]...)) {
+		t.Fatalf("damaged block: data differs")
+	}
+
+	if _, err = Repair(io.Discard, bytes.NewReader(want)); err == nil {
+		t.Fatalf("Repair of uncompressed data returned no error")
+	}
+}
+
+func TestRepairStreams(t *testing.T) {
+	xzData, want := multiStreamFile(t)
+	n := len(xzData) - 4000
+	_, data, report := repairAll(t, xzData[:n])
+	if report.Streams != 4 {
+		t.Fatalf("got %d streams; want 4", report.Streams)
+	}
+	if len(report.Errs) != 1 {
+		t.Fatalf("got errors %v; want one", report.Errs)
+	}
+	if !bytes.HasPrefix(want, data) || len(data) < 10000+3000 {
+		t.Fatalf("data differs")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"io"
+)
+
+// writeResetter is implemented by filter writers that can be reused for
+// a new block.
+type writeResetter interface {
+	Reset(w io.Writer) error
+}
+
+// readResetter is implemented by filter readers that can be reused for
+// a new block.
+type readResetter interface {
+	Reset(r io.Reader) error
+}
+
+// errNoReset indicates that a filter reader or writer doesn't support
+// Reset.
+var errNoReset = errors.New("xz: filter doesn't support Reset")
+
+// resetWriters resets the filter writers in chain, which is ordered
+// from the outermost to the innermost writer. The innermost writer will
+// write to w. The function returns errNoReset without changing any
+// writer if a writer doesn't support Reset.
+func resetWriters(chain []io.WriteCloser, w io.WriteCloser) error {
+	for _, fw := range chain {
+		if _, ok := fw.(writeResetter); !ok {
+			return errNoReset
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := chain[i].(writeResetter).Reset(w); err != nil {
+			return err
+		}
+		w = chain[i]
+	}
+	return nil
+}
+
+// resetReaders resets the filter readers in chain, which is ordered
+// from the outermost to the innermost reader. The innermost reader will
+// read from r. The function returns errNoReset without changing any
+// reader if a reader doesn't support Reset.
+func resetReaders(chain []io.Reader, r io.Reader) error {
+	for _, fr := range chain {
+		if _, ok := fr.(readResetter); !ok {
+			return errNoReset
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := chain[i].(readResetter).Reset(r); err != nil {
+			return err
+		}
+		r = chain[i]
+	}
+	return nil
+}
+
+// filterCache keeps the filter readers of the last block, so they can
+// be reused for the next block with the same filters. Reusing the LZMA2
+// reader avoids the allocation of a new dictionary for every block.
+type filterCache struct {
+	filters []Filter
+	// filter readers ordered from the outermost to the innermost
+	readers []io.Reader
+}
+
+// reader returns the filter reader for the filters f reading from r.
+// The cached readers are reset if the filters are the same as for the
+// last block.
+func (fc *filterCache) reader(c *ReaderConfig, r io.Reader, f []Filter,
+) (fr io.Reader, err error) {
+	if fc.matches(f) && resetReaders(fc.readers, r) == nil {
+		return fc.readers[0], nil
+	}
+	fc.filters = fc.filters[:0]
+	fc.readers, err = c.newFilterReaders(r, f, fc.readers[:0])
+	if err != nil {
+		fc.readers = fc.readers[:0]
+		return nil, err
+	}
+	fc.filters = append(fc.filters[:0], f...)
+	return fc.readers[0], nil
+}
+
+// matches checks whether the filters f are the same as the filters of
+// the cached readers.
+func (fc *filterCache) matches(f []Filter) bool {
+	if len(f) == 0 || len(f) != len(fc.filters) {
+		return false
+	}
+	for i, g := range f {
+		if !sameFilter(g, fc.filters[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameFilter checks whether f and g are the same filter with the same
+// parameters. Only the filters provided by the package are compared.
+func sameFilter(f, g Filter) bool {
+	switch f := f.(type) {
+	case *LZMA2Filter:
+		g, ok := g.(*LZMA2Filter)
+		return ok && *f == *g
+	case *DeltaFilter:
+		g, ok := g.(*DeltaFilter)
+		return ok && *f == *g
+	case *BCJFilter:
+		g, ok := g.(*BCJFilter)
+		return ok && *f == *g
+	}
+	return false
+}
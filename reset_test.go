@@ -0,0 +1,203 @@
+// Copyright 2014-2025 Ulrich Kunitz. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/ulikunitz/xz/internal/randtxt"
+)
+
+// resetMessages returns small messages for the Reset tests.
+func resetMessages() [][]byte {
+	txt := randtxt.NewReader(rand.NewSource(11))
+	var msgs [][]byte
+	for _, n := range []int64{1000, 0, 10, 9000, 300} {
+		var buf bytes.Buffer
+		io.CopyN(&buf, txt, n)
+		msgs = append(msgs, buf.Bytes())
+	}
+	return msgs
+}
+
+// compressXZ compresses data with a new writer for the configuration.
+func compressXZ(t *testing.T, cfg WriterConfig, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterReset(t *testing.T) {
+	msgs := resetMessages()
+	tests := []struct {
+		name string
+		cfg  WriterConfig
+	}{
+		{"default", WriterConfig{DictCap: 1 << 16}},
+		{"blocks", WriterConfig{DictCap: 1 << 16, BlockSize: 4000}},
+		{"filters", WriterConfig{DictCap: 1 << 16, DeltaDist: 2,
+			BCJ: X86}},
+		{"workers", WriterConfig{DictCap: 1 << 16, BlockSize: 4000,
+			Workers: 2}},
+	}
+	for _, c := range tests {
+		var w *Writer
+		for i, msg := range msgs {
+			var buf bytes.Buffer
+			var err error
+			if w == nil {
+				w, err = c.cfg.NewWriter(&buf)
+			} else {
+				err = w.Reset(&buf)
+			}
+			if err != nil {
+				t.Fatalf("%s: message %d: NewWriter or Reset"+
+					" error %s", c.name, i, err)
+			}
+			if _, err = w.Write(msg); err != nil {
+				t.Fatalf("w.Write error %s", err)
+			}
+			// The writer is reset without closing it.
+			if i == 2 {
+				continue
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("w.Close error %s", err)
+			}
+			want := compressXZ(t, c.cfg, msg)
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("%s: message %d: output differs from"+
+					" new writer", c.name, i)
+			}
+		}
+	}
+}
+
+func TestReaderReset(t *testing.T) {
+	msgs := resetMessages()
+	blocksXZ, err := os.ReadFile("testdata/blocks.xz")
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	var files [][]byte
+	for _, msg := range msgs {
+		files = append(files, compressXZ(t,
+			WriterConfig{DictCap: 1 << 16, BlockSize: 4000}, msg))
+	}
+	files = append(files, blocksXZ)
+	msgs = append(msgs, blocksTestData())
+	files = append(files, compressXZ(t,
+		WriterConfig{DictCap: 1 << 16, DeltaDist: 4}, msgs[3]))
+	msgs = append(msgs, msgs[3])
+
+	var r *Reader
+	for i, xzData := range files {
+		if r == nil {
+			r, err = NewReader(bytes.NewReader(xzData))
+		} else {
+			err = r.Reset(bytes.NewReader(xzData))
+		}
+		if err != nil {
+			t.Fatalf("file %d: NewReader or Reset error %s", i, err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("file %d: io.ReadAll error %s", i, err)
+		}
+		if !bytes.Equal(data, msgs[i]) {
+			t.Fatalf("file %d: data differs", i)
+		}
+	}
+
+	if err = r.Reset(bytes.NewReader(msgs[0])); err == nil {
+		t.Fatalf("Reset with uncompressed data returned no error")
+	}
+	if _, err = r.Read(make([]byte, 10)); err == nil {
+		t.Fatalf("Read after failed Reset returned no error")
+	}
+	if err = r.Reset(bytes.NewReader(files[0])); err != nil {
+		t.Fatalf("Reset error %s", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(data, msgs[0]) {
+		t.Fatalf("data after failed Reset differs")
+	}
+}
+
+func BenchmarkReset(b *testing.B) {
+	cfg := WriterConfig{DictCap: 1 << 20}
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			txt := randtxt.NewReader(rand.NewSource(7))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(txt, msg); err != nil {
+				b.Fatalf("io.ReadFull error %s", err)
+			}
+			// The writer and the reader are created outside of
+			// the timed loop.
+			var buf bytes.Buffer
+			w, err := cfg.NewWriter(&buf)
+			if err != nil {
+				b.Fatalf("NewWriter error %s", err)
+			}
+			if err = w.Close(); err != nil {
+				b.Fatalf("w.Close error %s", err)
+			}
+			var br bytes.Reader
+			br.Reset(buf.Bytes())
+			r, err := NewReader(&br)
+			if err != nil {
+				b.Fatalf("NewReader error %s", err)
+			}
+			if _, err = io.Copy(io.Discard, r); err != nil {
+				b.Fatalf("io.Copy error %s", err)
+			}
+			out := make([]byte, n)
+			b.ReportAllocs()
+			b.SetBytes(int64(n))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err = w.Reset(&buf); err != nil {
+					b.Fatalf("w.Reset error %s", err)
+				}
+				if _, err = w.Write(msg); err != nil {
+					b.Fatalf("w.Write error %s", err)
+				}
+				if err = w.Close(); err != nil {
+					b.Fatalf("w.Close error %s", err)
+				}
+				br.Reset(buf.Bytes())
+				if err = r.Reset(&br); err != nil {
+					b.Fatalf("r.Reset error %s", err)
+				}
+				if _, err = io.ReadFull(r, out); err != nil {
+					b.Fatalf("io.ReadFull error %s", err)
+				}
+				if _, err = r.Read(out[:1]); err != io.EOF {
+					b.Fatalf("r.Read returned %v; want io.EOF",
+						err)
+				}
+			}
+		})
+	}
+}
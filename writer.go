@@ -5,6 +5,7 @@
 package xz
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"hash"
@@ -25,10 +26,112 @@ type WriterConfig struct {
 	NoCheckSum bool
 	// match algorithm
 	Matcher lzma.MatchAlgorithm
+	// Preset selects the dictionary capacity, the match algorithm,
+	// the parser and the search parameters of the LZMA2 compressor
+	// as the presets of xz-utils do. DictCap, Matcher, Parser,
+	// NiceLen and Depth override the preset if they are not zero.
+	// (default: NoPreset)
+	Preset lzma.Preset
+	// KeepMatcher prevents a preset from replacing Matcher and
+	// Parser, so that their zero values HashTable4 and GreedyParser
+	// can be used with a preset.
+	KeepMatcher bool
+	// Extreme selects the slower extreme variant of the preset. If
+	// Preset is not set, the extreme variant of Preset6 is used.
+	Extreme bool
+	// Parser selects the method choosing the operations of the
+	// LZMA2 encoder (default: GreedyParser).
+	Parser lzma.Parser
+	// NiceLen is the length of a match that is accepted by the
+	// matcher without further search in the range 2 to 273 (default:
+	// value of the preset or of the matcher).
+	NiceLen int
+	// Depth limits the number of match candidates checked by the
+	// matcher at a position up to 65536 (default: value of the
+	// preset or of the matcher).
+	Depth int
+	// MaxCandidates limits the matches reported by the matcher at a
+	// position to the longest ones up to 273 (default: no limit).
+	MaxCandidates int
+	// distance for the delta filter in the range 1 to 256; zero
+	// disables the delta filter (default: 0)
+	DeltaDist int
+	// branch converter filter for executable code (default: NoBCJ)
+	BCJ BCJ
+	// start offset for the branch converter filter (default: 0)
+	BCJStartOffset uint32
+	// Filters describes the filter chain for the blocks. The chain
+	// may contain up to four filters and only the last filter may
+	// be, and must be, a filter whose Last method returns true, for
+	// instance the LZMA2 filter. If Filters is nil the chain
+	// is derived from the fields DeltaDist, BCJ and BCJStartOffset,
+	// which must not be set otherwise.
+	Filters []Filter
+	// BlockSizes lists the uncompressed sizes of the blocks in the
+	// order of the blocks, similar to the --block-list option of xz.
+	// After the end of the list the last size is used for all
+	// remaining blocks. A zero value as last size puts the remaining
+	// data into a single block. The sizes are limited by BlockSize.
+	// Blocks ended by EndBlock or Flush count as list entries as well.
+	BlockSizes []int64
+	// Workers defines the number of goroutines compressing blocks in
+	// parallel. Values of zero and one request sequential
+	// compression. Parallel compression requires that BlockSize or
+	// BlockSizes limit the size of all blocks; otherwise Verify
+	// sets Workers to one. The output doesn't depend on the number
+	// of workers. Up to Workers blocks are kept in memory.
+	Workers int
+	// FlushMode selects the behavior of Writer.Flush (default:
+	// SyncFlush).
+	FlushMode FlushMode
+	// BlockHeaderSizes requests that the compressed and uncompressed
+	// sizes are recorded in the block headers, which allows readers
+	// to decode the blocks in parallel or to skip them. The header
+	// is written after the block data, so each block is kept in
+	// memory. If the block size isn't limited by BlockSize or
+	// BlockSizes, the underlying writer must be an io.WriteSeeker.
+	// Then the block headers are written with padding and replaced
+	// after each block. Flush always ends the current block.
+	BlockHeaderSizes bool
 }
 
+// FlushMode selects how Writer.Flush makes the data written so far
+// available to the reader.
+type FlushMode byte
+
+const (
+	// SyncFlush terminates the current LZMA2 chunk and continues the
+	// block. If a filter in the filter chain doesn't support
+	// flushing, for instance a BCJ filter, the block is ended
+	// instead.
+	SyncFlush FlushMode = iota
+	// BlockFlush ends the current block. The next write starts a new
+	// block.
+	BlockFlush
+)
+
 // fill replaces zero values with default values.
 func (c *WriterConfig) fill() {
+	if c.Preset != lzma.NoPreset || c.Extreme {
+		// The LZMA2 configuration resolves the preset.
+		lc := lzma.Writer2Config{
+			DictCap:     c.DictCap,
+			Matcher:     c.Matcher,
+			Preset:      c.Preset,
+			KeepMatcher: c.KeepMatcher,
+			Extreme:     c.Extreme,
+			Parser:      c.Parser,
+			NiceLen:     c.NiceLen,
+			Depth:       c.Depth,
+		}
+		if lc.Verify() == nil {
+			c.DictCap = lc.DictCap
+			c.Matcher = lc.Matcher
+			c.Parser = lc.Parser
+			c.NiceLen = lc.NiceLen
+			c.Depth = lc.Depth
+		}
+	}
 	if c.Properties == nil {
 		c.Properties = &lzma.Properties{LC: 3, LP: 0, PB: 2}
 	}
@@ -41,6 +144,10 @@ func (c *WriterConfig) fill() {
 	if c.BlockSize == 0 {
 		c.BlockSize = maxInt64
 	}
+	if c.Workers > 1 && !c.boundedBlocks() {
+		// The blocks of the parallel writer are kept in memory.
+		c.Workers = 1
+	}
 	if c.CheckSum == 0 {
 		c.CheckSum = CRC64
 	}
@@ -57,10 +164,17 @@ func (c *WriterConfig) Verify() error {
 	}
 	c.fill()
 	lc := lzma.Writer2Config{
-		Properties: c.Properties,
-		DictCap:    c.DictCap,
-		BufSize:    c.BufSize,
-		Matcher:    c.Matcher,
+		Properties:    c.Properties,
+		DictCap:       c.DictCap,
+		BufSize:       c.BufSize,
+		Matcher:       c.Matcher,
+		Preset:        c.Preset,
+		KeepMatcher:   c.KeepMatcher,
+		Extreme:       c.Extreme,
+		Parser:        c.Parser,
+		NiceLen:       c.NiceLen,
+		Depth:         c.Depth,
+		MaxCandidates: c.MaxCandidates,
 	}
 	if err := lc.Verify(); err != nil {
 		return err
@@ -68,15 +182,90 @@ func (c *WriterConfig) Verify() error {
 	if c.BlockSize <= 0 {
 		return errors.New("xz: block size out of range")
 	}
+	for i, size := range c.BlockSizes {
+		if size < 0 || (size == 0 && i < len(c.BlockSizes)-1) {
+			return errors.New("xz: block size list entry out of range")
+		}
+	}
+	if c.Workers < 0 {
+		return errors.New("xz: number of workers negative")
+	}
+	if c.FlushMode > BlockFlush {
+		return errors.New("xz: unsupported flush mode")
+	}
 	if err := verifyFlags(c.CheckSum); err != nil {
 		return err
 	}
+	if c.Filters != nil {
+		if c.DeltaDist != 0 || c.BCJ != NoBCJ || c.BCJStartOffset != 0 {
+			return errors.New("xz: filter chain and filter " +
+				"fields set")
+		}
+		return verifyFilterChain(c.filters())
+	}
+	if c.DeltaDist != 0 {
+		if err := verifyDeltaDist(c.DeltaDist); err != nil {
+			return err
+		}
+	}
+	if c.BCJ != NoBCJ {
+		if err := verifyBCJ(c.BCJ, c.BCJStartOffset); err != nil {
+			return err
+		}
+	} else if c.BCJStartOffset != 0 {
+		return errors.New("xz: start offset without BCJ filter")
+	}
 	return nil
 }
 
-// filters creates the filter list for the given parameters.
-func (c *WriterConfig) filters() []filter {
-	return []filter{&lzmaFilter{int64(c.DictCap)}}
+// filters creates the filter list for the given parameters. An LZMA2
+// filter in the filter chain without dictionary capacity gets the
+// DictCap value of the configuration.
+func (c *WriterConfig) filters() []Filter {
+	if c.Filters != nil {
+		f := make([]Filter, len(c.Filters))
+		for i, g := range c.Filters {
+			if lf, ok := g.(*LZMA2Filter); ok && lf.DictCap == 0 {
+				g = &LZMA2Filter{int64(c.DictCap)}
+			}
+			f[i] = g
+		}
+		return f
+	}
+	f := make([]Filter, 0, 3)
+	if c.BCJ != NoBCJ {
+		f = append(f, &BCJFilter{c.BCJ, c.BCJStartOffset})
+	}
+	if c.DeltaDist != 0 {
+		f = append(f, &DeltaFilter{c.DeltaDist})
+	}
+	return append(f, &LZMA2Filter{int64(c.DictCap)})
+}
+
+// blockSize returns the maximum uncompressed size for block i of a
+// stream.
+func (c *WriterConfig) blockSize(i int) int64 {
+	if len(c.BlockSizes) == 0 {
+		return c.BlockSize
+	}
+	if i >= len(c.BlockSizes) {
+		i = len(c.BlockSizes) - 1
+	}
+	size := c.BlockSizes[i]
+	if size == 0 || size > c.BlockSize {
+		return c.BlockSize
+	}
+	return size
+}
+
+// boundedBlocks reports whether the uncompressed sizes of all blocks
+// are limited by BlockSize or BlockSizes.
+func (c *WriterConfig) boundedBlocks() bool {
+	if c.BlockSize < maxInt64 {
+		return true
+	}
+	n := len(c.BlockSizes)
+	return n > 0 && c.BlockSizes[n-1] > 0
 }
 
 // maxInt64 defines the maximum 64-bit signed integer.
@@ -84,7 +273,7 @@ const maxInt64 = 1<<63 - 1
 
 // verifyFilters checks the filter list for the length and the right
 // sequence of filters.
-func verifyFilters(f []filter) error {
+func verifyFilters(f []Filter) error {
 	if len(f) == 0 {
 		return errors.New("xz: no filters")
 	}
@@ -92,30 +281,61 @@ func verifyFilters(f []filter) error {
 		return errors.New("xz: more than four filters")
 	}
 	for _, g := range f[:len(f)-1] {
-		if g.last() {
+		if g.Last() {
 			return errors.New("xz: last filter is not last")
 		}
 	}
-	if !f[len(f)-1].last() {
+	if !f[len(f)-1].Last() {
 		return errors.New("xz: wrong last filter")
 	}
 	return nil
 }
 
-// newFilterWriteCloser converts a filter list into a WriteCloser that
-// can be used by a blockWriter.
-func (c *WriterConfig) newFilterWriteCloser(w io.Writer, f []filter) (fw io.WriteCloser, err error) {
+// verifyFilterChain checks a filter chain provided by the user. In
+// addition to the checks of verifyFilters, the parameters of the
+// filters are checked by marshalling them.
+func verifyFilterChain(f []Filter) error {
+	for _, g := range f {
+		if g == nil {
+			return errors.New("xz: nil filter in filter chain")
+		}
+	}
+	if err := verifyFilters(f); err != nil {
+		return err
+	}
+	for _, g := range f {
+		if lf, ok := g.(*LZMA2Filter); ok {
+			if !(lzma.MinDictCap <= lf.DictCap &&
+				lf.DictCap <= lzma.MaxDictCap) {
+				return errors.New("xz: LZMA2 filter dictionary " +
+					"capacity out of range")
+			}
+		}
+		if _, err := g.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newFilterWriters converts a filter list into the chain of
+// WriteClosers used by a blockWriter. The chain is ordered from the
+// outermost to the innermost writer, which writes to w.
+func (c *WriterConfig) newFilterWriters(w io.Writer, f []Filter,
+) (chain []io.WriteCloser, err error) {
 	if err = verifyFilters(f); err != nil {
 		return nil, err
 	}
-	fw = nopWriteCloser(w)
+	chain = make([]io.WriteCloser, len(f))
+	fw := nopWriteCloser(w)
 	for i := len(f) - 1; i >= 0; i-- {
-		fw, err = f[i].writeCloser(fw, c)
+		fw, err = f[i].WriteCloser(fw, c)
 		if err != nil {
 			return nil, err
 		}
+		chain[i] = fw
 	}
-	return fw, nil
+	return chain, nil
 }
 
 // nopWCloser implements a WriteCloser with a Close method not doing
@@ -129,6 +349,11 @@ func (c nopWCloser) Close() error {
 	return nil
 }
 
+// Flush returns nil. The underlying writer is not flushed.
+func (c nopWCloser) Flush() error {
+	return nil
+}
+
 // nopWriteCloser converts the Writer into a WriteCloser with a Close
 // function that does nothing beside returning nil.
 func nopWriteCloser(w io.Writer) io.WriteCloser {
@@ -139,35 +364,107 @@ func nopWriteCloser(w io.Writer) io.WriteCloser {
 type Writer struct {
 	WriterConfig
 
-	xz      io.Writer
-	bw      *blockWriter
-	newHash func() hash.Hash
-	h       header
-	index   []record
-	closed  bool
+	xz io.Writer
+	bw *blockWriter
+	// block writer of the last block kept for reuse
+	free *blockWriter
+	// recording of the block sizes in the block headers
+	sizes     sizesMode
+	blockBuf  bytes.Buffer
+	headerPos int64
+	par       *parWriter
+	newHash   func() hash.Hash
+	h         header
+	index     []record
+	closed    bool
 }
 
-// newBlockWriter creates a new block writer writes the header out.
+// sizesMode describes how the sequential Writer records the sizes of a
+// block in the block header.
+type sizesMode byte
+
+const (
+	// The sizes are not recorded.
+	noSizes sizesMode = iota
+	// The block is buffered and written after it has been closed.
+	bufferSizes
+	// The header is written with padding and is replaced by a header
+	// with the sizes after the block has been closed.
+	patchSizes
+)
+
+// newBlockWriter creates a new block writer and writes the header out.
+// The block writer of the last block is reused if possible.
 func (w *Writer) newBlockWriter() error {
-	var err error
-	w.bw, err = w.WriterConfig.newBlockWriter(w.xz, w.newHash())
-	if err != nil {
-		return err
+	xz := w.xz
+	if w.sizes == bufferSizes {
+		w.blockBuf.Reset()
+		xz = &w.blockBuf
+	}
+	bw := w.free
+	w.free = nil
+	if bw == nil || bw.reset(xz) != nil {
+		var err error
+		if bw, err = w.WriterConfig.newBlockWriter(xz, w.newHash()); err != nil {
+			return err
+		}
+	}
+	bw.blockSize = w.blockSize(len(w.index))
+	switch w.sizes {
+	case bufferSizes:
+		w.bw = bw
+		return nil
+	case patchSizes:
+		var err error
+		ws := w.xz.(io.WriteSeeker)
+		if w.headerPos, err = ws.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		if bw.minHeaderLen, err = bw.maxHeaderLen(); err != nil {
+			return err
+		}
 	}
-	if err = w.bw.writeHeader(w.xz); err != nil {
+	if err := bw.writeHeader(w.xz); err != nil {
 		return err
 	}
+	w.bw = bw
 	return nil
 }
 
-// closeBlockWriter closes a block writer and records the sizes in the
-// index.
+// closeBlockWriter closes the block writer and records the sizes in the
+// index. If the sizes are recorded in the block header, the header is
+// written or replaced.
 func (w *Writer) closeBlockWriter() error {
 	var err error
 	if err = w.bw.Close(); err != nil {
 		return err
 	}
+	switch w.sizes {
+	case bufferSizes:
+		if err = w.bw.writeHeader(w.xz); err != nil {
+			return err
+		}
+		if _, err = w.xz.Write(w.blockBuf.Bytes()); err != nil {
+			return err
+		}
+	case patchSizes:
+		ws := w.xz.(io.WriteSeeker)
+		end, err := ws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err = ws.Seek(w.headerPos, io.SeekStart); err != nil {
+			return err
+		}
+		if err = w.bw.writeHeader(ws); err != nil {
+			return err
+		}
+		if _, err = ws.Seek(end, io.SeekStart); err != nil {
+			return err
+		}
+	}
 	w.index = append(w.index, w.bw.record())
+	w.free, w.bw = w.bw, nil
 	return nil
 }
 
@@ -176,6 +473,17 @@ func NewWriter(xz io.Writer) (w *Writer, err error) {
 	return WriterConfig{}.NewWriter(xz)
 }
 
+// NewWriterLevel creates a new xz writer using the preset for the
+// compression level in the range 0 to 9. Level 6 is the default level
+// of the xz tool.
+func NewWriterLevel(xz io.Writer, level int) (w *Writer, err error) {
+	p, err := lzma.LevelPreset(level)
+	if err != nil {
+		return nil, err
+	}
+	return WriterConfig{Preset: p}.NewWriter(xz)
+}
+
 // NewWriter creates a new Writer using the given configuration parameters.
 func (c WriterConfig) NewWriter(xz io.Writer) (w *Writer, err error) {
 	if err = c.Verify(); err != nil {
@@ -190,18 +498,55 @@ func (c WriterConfig) NewWriter(xz io.Writer) (w *Writer, err error) {
 	if w.newHash, err = newHashFunc(c.CheckSum); err != nil {
 		return nil, err
 	}
+	if err = w.writeHeader(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// writeHeader writes the stream header, creates the parallel writer if
+// required and selects how the block sizes are recorded.
+func (w *Writer) writeHeader() error {
+	w.sizes = noSizes
+	if w.BlockHeaderSizes && w.Workers <= 1 {
+		_, seekable := w.xz.(io.WriteSeeker)
+		switch {
+		case w.boundedBlocks():
+			w.sizes = bufferSizes
+		case seekable:
+			w.sizes = patchSizes
+		default:
+			return errors.New("xz: block header sizes require " +
+				"a limited block size or an io.WriteSeeker")
+		}
+	}
 	data, err := w.h.MarshalBinary()
 	if err != nil {
-		return nil, fmt.Errorf("w.h.MarshalBinary(): error %w", err)
+		return fmt.Errorf("w.h.MarshalBinary(): error %w", err)
 	}
-	if _, err = xz.Write(data); err != nil {
-		return nil, err
+	if _, err = w.xz.Write(data); err != nil {
+		return err
 	}
-	if err = w.newBlockWriter(); err != nil {
-		return nil, err
+	if w.Workers > 1 {
+		w.par = newParWriter(&w.WriterConfig, w.xz, w.newHash)
 	}
-	return w, nil
+	return nil
+}
 
+// Reset discards the state of the writer and starts a new xz stream
+// written to xz using the same configuration. Data not yet written to
+// the previous underlying writer is dropped. The compressor of the last
+// block is reused for the blocks of the new stream, which avoids the
+// allocation of a new dictionary.
+func (w *Writer) Reset(xz io.Writer) error {
+	if w.bw != nil {
+		w.free, w.bw = w.bw, nil
+	}
+	w.xz = xz
+	w.par = nil
+	w.index = w.index[:0]
+	w.closed = false
+	return w.writeHeader()
 }
 
 // Write compresses the uncompressed data provided.
@@ -209,19 +554,67 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 	if w.closed {
 		return 0, errClosed
 	}
-	for {
+	if w.par != nil {
+		return w.par.Write(p)
+	}
+	for n < len(p) {
+		if w.bw == nil {
+			if err = w.newBlockWriter(); err != nil {
+				return n, err
+			}
+		}
 		k, err := w.bw.Write(p[n:])
 		n += k
 		if err != errNoSpace {
-			return n, err
+			if err != nil {
+				return n, err
+			}
+			continue
 		}
 		if err = w.closeBlockWriter(); err != nil {
 			return n, err
 		}
-		if err = w.newBlockWriter(); err != nil {
-			return n, err
+	}
+	return n, nil
+}
+
+// Flush makes all data written so far available to the reader of the
+// underlying writer. The FlushMode field of the configuration selects
+// whether the current LZMA2 chunk or the current block is terminated.
+// Flush doesn't flush the underlying writer.
+func (w *Writer) Flush() error {
+	if w.closed {
+		return errClosed
+	}
+	if w.par != nil {
+		return w.par.Flush()
+	}
+	if w.bw == nil {
+		return nil
+	}
+	if w.FlushMode == SyncFlush && !w.BlockHeaderSizes {
+		if err := w.bw.flush(); err != errNoFlush {
+			return err
 		}
 	}
+	return w.closeBlockWriter()
+}
+
+// EndBlock ends the current block, so that the data written before and
+// after the call are stored in different blocks. The block boundaries
+// can be used for random access with ReaderAt. EndBlock doesn't do
+// anything if no data has been written since the last block ended.
+func (w *Writer) EndBlock() error {
+	if w.closed {
+		return errClosed
+	}
+	if w.par != nil {
+		return w.par.EndBlock()
+	}
+	if w.bw == nil {
+		return nil
+	}
+	return w.closeBlockWriter()
 }
 
 // Close closes the writer and adds the footer to the Writer. Close
@@ -232,8 +625,22 @@ func (w *Writer) Close() error {
 	}
 	w.closed = true
 	var err error
-	if err = w.closeBlockWriter(); err != nil {
-		return err
+	if w.par != nil {
+		if w.index, err = w.par.Close(); err != nil {
+			return err
+		}
+	} else {
+		// An empty stream gets an empty block.
+		if w.bw == nil && len(w.index) == 0 {
+			if err = w.newBlockWriter(); err != nil {
+				return err
+			}
+		}
+		if w.bw != nil {
+			if err = w.closeBlockWriter(); err != nil {
+				return err
+			}
+		}
 	}
 
 	f := footer{flags: w.h.flags}
@@ -270,14 +677,19 @@ func (cw *countingWriter) Write(p []byte) (n int, err error) {
 type blockWriter struct {
 	cxz countingWriter
 	// mw combines io.WriteCloser w and the hash.
-	mw        io.Writer
-	w         io.WriteCloser
+	mw io.Writer
+	w  io.WriteCloser
+	// filter writers ordered from the outermost writer w to the
+	// innermost writer
+	chain     []io.WriteCloser
 	n         int64
 	blockSize int64
 	closed    bool
 	headerLen int
+	// minimum length of the header; the header is padded if required
+	minHeaderLen int
 
-	filters []filter
+	filters []Filter
 	hash    hash.Hash
 }
 
@@ -289,10 +701,11 @@ func (c *WriterConfig) newBlockWriter(xz io.Writer, hash hash.Hash) (bw *blockWr
 		filters:   c.filters(),
 		hash:      hash,
 	}
-	bw.w, err = c.newFilterWriteCloser(&bw.cxz, bw.filters)
+	bw.chain, err = c.newFilterWriters(&bw.cxz, bw.filters)
 	if err != nil {
 		return nil, err
 	}
+	bw.w = bw.chain[0]
 	if bw.hash.Size() != 0 {
 		bw.mw = io.MultiWriter(bw.w, bw.hash)
 	} else {
@@ -301,6 +714,34 @@ func (c *WriterConfig) newBlockWriter(xz io.Writer, hash hash.Hash) (bw *blockWr
 	return bw, nil
 }
 
+// reset prepares the block writer for a new block written to xz reusing
+// the filter writers. The function returns errNoReset if a filter
+// writer doesn't support it.
+func (bw *blockWriter) reset(xz io.Writer) error {
+	bw.cxz = countingWriter{w: xz}
+	if err := resetWriters(bw.chain, nopWriteCloser(&bw.cxz)); err != nil {
+		return err
+	}
+	bw.n = 0
+	bw.closed = false
+	bw.headerLen = 0
+	bw.minHeaderLen = 0
+	bw.hash.Reset()
+	return nil
+}
+
+// startBlock creates a new block writer and writes the block header to
+// xz.
+func (c *WriterConfig) startBlock(xz io.Writer, hash hash.Hash) (bw *blockWriter, err error) {
+	if bw, err = c.newBlockWriter(xz, hash); err != nil {
+		return nil, err
+	}
+	if err = bw.writeHeader(xz); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
 // writeHeader writes the header. If the function is called after Close
 // the commpressedSize and uncompressedSize fields will be filled.
 func (bw *blockWriter) writeHeader(w io.Writer) error {
@@ -313,7 +754,7 @@ func (bw *blockWriter) writeHeader(w io.Writer) error {
 		h.compressedSize = bw.compressedSize()
 		h.uncompressedSize = bw.uncompressedSize()
 	}
-	data, err := h.MarshalBinary()
+	data, err := h.marshalLen(bw.minHeaderLen)
 	if err != nil {
 		return err
 	}
@@ -324,6 +765,22 @@ func (bw *blockWriter) writeHeader(w io.Writer) error {
 	return nil
 }
 
+// maxHeaderLen returns the length of the block header with the largest
+// sizes possible. A header with this length can be replaced by the
+// header with the actual sizes.
+func (bw *blockWriter) maxHeaderLen() (n int, err error) {
+	h := blockHeader{
+		compressedSize:   maxInt64,
+		uncompressedSize: maxInt64,
+		filters:          bw.filters,
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
 // compressed size returns the amount of data written to the underlying
 // stream.
 func (bw *blockWriter) compressedSize() int64 {
@@ -379,6 +836,35 @@ func (bw *blockWriter) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// errNoFlush indicates that a writer in the filter chain doesn't
+// support flushing.
+var errNoFlush = errors.New("xz: filter doesn't support flushing")
+
+// flusher is implemented by filter writers supporting flushing.
+type flusher interface {
+	Flush() error
+}
+
+// flushWriter flushes w. It returns errNoFlush if w doesn't support
+// flushing.
+func flushWriter(w io.Writer) error {
+	f, ok := w.(flusher)
+	if !ok {
+		return errNoFlush
+	}
+	return f.Flush()
+}
+
+// flush writes all data written to the block writer to the underlying
+// writer. The block is continued. The function returns errNoFlush if
+// the filter chain doesn't support flushing.
+func (bw *blockWriter) flush() error {
+	if bw.closed {
+		return errClosed
+	}
+	return flushWriter(bw.w)
+}
+
 // Close closes the writer.
 func (bw *blockWriter) Close() error {
 	if bw.closed {
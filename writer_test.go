@@ -6,13 +6,17 @@ package xz
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/ulikunitz/xz/internal/randtxt"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 func TestWriter(t *testing.T) {
@@ -176,6 +180,282 @@ func TestWriterNoneCheck(t *testing.T) {
 	}
 }
 
+func TestWriterFilterChain(t *testing.T) {
+	data := x86TestData()
+	var buf bytes.Buffer
+	cfg := WriterConfig{Filters: []Filter{
+		&BCJFilter{BCJ: X86},
+		&DeltaFilter{Dist: 2},
+		&LZMA2Filter{DictCap: 1 << 16},
+	}}
+	w, err := cfg.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	var out bytes.Buffer
+	if _, err = io.Copy(&out, r); err != nil {
+		t.Fatalf("io.Copy error %s", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decompressed data differs from original")
+	}
+}
+
+func TestWriterConfigFilters(t *testing.T) {
+	tests := []struct {
+		cfg WriterConfig
+		ok  bool
+	}{
+		{WriterConfig{Filters: []Filter{&LZMA2Filter{}}}, true},
+		{WriterConfig{Filters: []Filter{
+			&DeltaFilter{Dist: 1}, &DeltaFilter{Dist: 2},
+			&BCJFilter{BCJ: ARM}, &LZMA2Filter{}}}, true},
+		{WriterConfig{Filters: []Filter{}}, false},
+		{WriterConfig{Filters: []Filter{&DeltaFilter{Dist: 4}}}, false},
+		{WriterConfig{Filters: []Filter{
+			&LZMA2Filter{}, &LZMA2Filter{}}}, false},
+		{WriterConfig{Filters: []Filter{
+			&LZMA2Filter{}, &DeltaFilter{Dist: 4}}}, false},
+		{WriterConfig{Filters: []Filter{
+			&DeltaFilter{Dist: 1}, &DeltaFilter{Dist: 2},
+			&DeltaFilter{Dist: 3}, &DeltaFilter{Dist: 4},
+			&LZMA2Filter{}}}, false},
+		{WriterConfig{Filters: []Filter{
+			&DeltaFilter{Dist: 300}, &LZMA2Filter{}}}, false},
+		{WriterConfig{Filters: []Filter{
+			&BCJFilter{BCJ: ARM, StartOffset: 2},
+			&LZMA2Filter{}}}, false},
+		{WriterConfig{Filters: []Filter{
+			&LZMA2Filter{DictCap: 1 << 10}}}, false},
+		{WriterConfig{Filters: []Filter{nil, &LZMA2Filter{}}}, false},
+		{WriterConfig{DeltaDist: 4,
+			Filters: []Filter{&LZMA2Filter{}}}, false},
+	}
+	for i, c := range tests {
+		err := c.cfg.Verify()
+		if c.ok && err != nil {
+			t.Errorf("test %d: Verify error %s", i, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("test %d: Verify returned no error", i)
+		}
+	}
+}
+
+func TestWriterWorkers(t *testing.T) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(43)), 100000)
+	txt := buf.Bytes()
+	for _, n := range []int{0, 1, 30000, 100000} {
+		data := txt[:n]
+		var want []byte
+		for _, workers := range []int{0, 1, 2, 3, 8} {
+			var out bytes.Buffer
+			cfg := WriterConfig{BlockSize: 10000, Workers: workers}
+			w, err := cfg.NewWriter(&out)
+			if err != nil {
+				t.Fatalf("NewWriter error %s", err)
+			}
+			if err = chunkWrite(w, data, []int{1, 4096, 20000}); err != nil {
+				t.Fatalf("chunkWrite error %s", err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("w.Close error %s", err)
+			}
+			if workers == 0 {
+				want = out.Bytes()
+				continue
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Fatalf("len %d workers %d: output differs from "+
+					"sequential writer", n, workers)
+			}
+		}
+		r, err := NewReader(bytes.NewReader(want))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		p, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("io.ReadAll error %s", err)
+		}
+		if !bytes.Equal(p, data) {
+			t.Fatalf("len %d: decompressed data differs", n)
+		}
+	}
+	tests := []struct {
+		cfg     WriterConfig
+		workers int
+	}{
+		{WriterConfig{Workers: 4}, 1},
+		{WriterConfig{Workers: 4, BlockSizes: []int64{1000, 0}}, 1},
+		{WriterConfig{Workers: 4, BlockSize: 1 << 20}, 4},
+		{WriterConfig{Workers: 4, BlockSizes: []int64{1000}}, 4},
+	}
+	for _, c := range tests {
+		if err := c.cfg.Verify(); err != nil {
+			t.Fatalf("Verify error %s", err)
+		}
+		if c.cfg.Workers != c.workers {
+			t.Fatalf("Verify sets Workers to %d; want %d",
+				c.cfg.Workers, c.workers)
+		}
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(47)), 50000)
+	txt := buf.Bytes()
+	sizes := []int{1000, 0, 12000, 7000, 30000}
+	tests := []struct {
+		name    string
+		mode    FlushMode
+		filters []Filter
+		blocks  int
+	}{
+		{"sync", SyncFlush, nil, 5},
+		{"block", BlockFlush, nil, 7},
+		{"syncBCJ", SyncFlush,
+			[]Filter{&BCJFilter{BCJ: X86}, &LZMA2Filter{}}, 7},
+	}
+	for _, c := range tests {
+		var want []byte
+		for _, workers := range []int{0, 1, 2} {
+			var out bytes.Buffer
+			cfg := WriterConfig{
+				BlockSize: 10000,
+				Workers:   workers,
+				FlushMode: c.mode,
+				Filters:   c.filters,
+			}
+			w, err := cfg.NewWriter(&out)
+			if err != nil {
+				t.Fatalf("%s: NewWriter error %s", c.name, err)
+			}
+			n := 0
+			for _, k := range sizes {
+				if _, err = w.Write(txt[n : n+k]); err != nil {
+					t.Fatalf("%s: w.Write error %s", c.name, err)
+				}
+				n += k
+				if err = w.Flush(); err != nil {
+					t.Fatalf("%s: w.Flush error %s", c.name, err)
+				}
+				r, err := NewReader(bytes.NewReader(out.Bytes()))
+				if err != nil {
+					t.Fatalf("%s: NewReader error %s", c.name, err)
+				}
+				p := make([]byte, n)
+				if _, err = io.ReadFull(r, p); err != nil {
+					t.Fatalf("%s: workers %d: io.ReadFull error "+
+						"after flush at %d: %s",
+						c.name, workers, n, err)
+				}
+				if !bytes.Equal(p, txt[:n]) {
+					t.Fatalf("%s: flushed data differs", c.name)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("%s: w.Close error %s", c.name, err)
+			}
+			if workers == 0 {
+				want = out.Bytes()
+				continue
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Fatalf("%s: workers %d: output differs from "+
+					"sequential writer", c.name, workers)
+			}
+		}
+		info, err := Info(bytes.NewReader(want), int64(len(want)))
+		if err != nil {
+			t.Fatalf("%s: Info error %s", c.name, err)
+		}
+		if info.BlockCount != c.blocks {
+			t.Fatalf("%s: got %d blocks; want %d", c.name,
+				info.BlockCount, c.blocks)
+		}
+		r, err := NewReader(bytes.NewReader(want))
+		if err != nil {
+			t.Fatalf("%s: NewReader error %s", c.name, err)
+		}
+		p, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: io.ReadAll error %s", c.name, err)
+		}
+		if !bytes.Equal(p, txt) {
+			t.Fatalf("%s: decompressed data differs", c.name)
+		}
+	}
+	if err := (&WriterConfig{FlushMode: 2}).Verify(); err == nil {
+		t.Fatal("Verify accepted unsupported flush mode")
+	}
+}
+
+func TestWriterFlushMatchers(t *testing.T) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(48)), 100000)
+	txt := buf.Bytes()
+	var configs []WriterConfig
+	for level := 4; level <= 9; level++ {
+		configs = append(configs,
+			WriterConfig{Preset: lzma.Preset0 + lzma.Preset(level)})
+	}
+	for _, m := range []lzma.MatchAlgorithm{lzma.HashTable4,
+		lzma.BinaryTree, lzma.HC3, lzma.HC4, lzma.BT2, lzma.BT3,
+		lzma.BT4} {
+		configs = append(configs, WriterConfig{Matcher: m,
+			Parser: lzma.OptimalParser, DictCap: 1 << 16})
+	}
+	for _, cfg := range configs {
+		name := fmt.Sprintf("%s %s %s", cfg.Preset, cfg.Matcher,
+			cfg.Parser)
+		var out bytes.Buffer
+		w, err := cfg.NewWriter(&out)
+		if err != nil {
+			t.Fatalf("%s: NewWriter error %s", name, err)
+		}
+		for p := txt; len(p) > 0; {
+			k := 4096
+			if k > len(p) {
+				k = len(p)
+			}
+			if _, err = w.Write(p[:k]); err != nil {
+				t.Fatalf("%s: w.Write error %s", name, err)
+			}
+			if err = w.Flush(); err != nil {
+				t.Fatalf("%s: w.Flush error %s", name, err)
+			}
+			p = p[k:]
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("%s: w.Close error %s", name, err)
+		}
+		r, err := NewReader(&out)
+		if err != nil {
+			t.Fatalf("%s: NewReader error %s", name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: io.ReadAll error %s", name, err)
+		}
+		if !bytes.Equal(got, txt) {
+			t.Fatalf("%s: decompressed data differs", name)
+		}
+	}
+}
+
 func BenchmarkWriter(b *testing.B) {
 	const testFile = "testdata/enwik7"
 	data, err := os.ReadFile(testFile)
@@ -201,3 +481,362 @@ func BenchmarkWriter(b *testing.B) {
 	}
 	b.ReportMetric(float64(buf.Len())/float64(len(data)), "rate")
 }
+
+func TestNewWriterLevel(t *testing.T) {
+	var data bytes.Buffer
+	txt := randtxt.NewReader(rand.NewSource(21))
+	if _, err := io.CopyN(&data, txt, 30000); err != nil {
+		t.Fatalf("io.CopyN error %s", err)
+	}
+	for _, level := range []int{0, 6, 9} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatalf("NewWriterLevel(%d) error %s", level, err)
+		}
+		if _, err = w.Write(data.Bytes()); err != nil {
+			t.Fatalf("w.Write error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("io.ReadAll error %s", err)
+		}
+		if !bytes.Equal(out, data.Bytes()) {
+			t.Fatalf("level %d: data differs", level)
+		}
+	}
+	if _, err := NewWriterLevel(io.Discard, -1); err == nil {
+		t.Fatalf("NewWriterLevel(-1) returned no error")
+	}
+
+	c := WriterConfig{Preset: lzma.Preset3, Extreme: true}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.DictCap != 4<<20 {
+		t.Fatalf("DictCap is %d; want %d", c.DictCap, 4<<20)
+	}
+}
+
+// blockSizes returns the uncompressed sizes of the blocks of xzData.
+func blockSizes(t *testing.T, xzData []byte) []int64 {
+	info, err := Info(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("Info error %s", err)
+	}
+	var sizes []int64
+	for _, s := range info.Streams {
+		for _, b := range s.Blocks {
+			sizes = append(sizes, b.UncompressedSize)
+		}
+	}
+	return sizes
+}
+
+func TestWriterBlockBoundaries(t *testing.T) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(53)), 30000)
+	txt := buf.Bytes()
+	tests := []struct {
+		name string
+		cfg  WriterConfig
+		// positions of EndBlock calls
+		ends []int
+		want []int64
+	}{
+		{"EndBlock", WriterConfig{}, []int{0, 1000, 1000, 5000},
+			[]int64{1000, 4000, 25000}},
+		{"BlockSizes", WriterConfig{BlockSizes: []int64{100, 9000}},
+			nil, []int64{100, 9000, 9000, 9000, 2900}},
+		{"BlockSizesZero", WriterConfig{
+			BlockSizes: []int64{5000, 0}}, nil,
+			[]int64{5000, 25000}},
+		{"BlockSize", WriterConfig{BlockSize: 8000,
+			BlockSizes: []int64{20000, 3000}}, []int{10000},
+			[]int64{8000, 2000, 3000, 3000, 3000, 3000, 3000,
+				3000, 2000}},
+	}
+	for _, c := range tests {
+		var want []byte
+		for _, workers := range []int{1, 3} {
+			cfg := c.cfg
+			cfg.Workers = workers
+			var out bytes.Buffer
+			w, err := cfg.NewWriter(&out)
+			if err != nil {
+				t.Fatalf("NewWriter error %s", err)
+			}
+			pos := 0
+			for _, end := range append(c.ends, len(txt)) {
+				if _, err = w.Write(txt[pos:end]); err != nil {
+					t.Fatalf("w.Write error %s", err)
+				}
+				pos = end
+				if err = w.EndBlock(); err != nil {
+					t.Fatalf("w.EndBlock error %s", err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("w.Close error %s", err)
+			}
+			if workers == 1 {
+				want = out.Bytes()
+			} else if !bytes.Equal(out.Bytes(), want) {
+				t.Fatalf("%s: output for workers %d differs",
+					c.name, workers)
+			}
+			sizes := blockSizes(t, out.Bytes())
+			if fmt.Sprint(sizes) != fmt.Sprint(c.want) {
+				t.Fatalf("%s: got block sizes %v; want %v",
+					c.name, sizes, c.want)
+			}
+		}
+		r, err := NewReader(bytes.NewReader(want))
+		if err != nil {
+			t.Fatalf("NewReader error %s", err)
+		}
+		p, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("io.ReadAll error %s", err)
+		}
+		if !bytes.Equal(p, txt) {
+			t.Fatalf("%s: decompressed data differs", c.name)
+		}
+	}
+
+	cfg := WriterConfig{BlockSizes: []int64{0, 100}}
+	if err := cfg.Verify(); err == nil {
+		t.Fatalf("Verify accepted zero size before the end of the list")
+	}
+}
+
+// checkBlockHeaderSizes checks that the block headers of xzData record
+// the sizes of the blocks.
+func checkBlockHeaderSizes(t *testing.T, xzData []byte) {
+	info, err := Info(bytes.NewReader(xzData), int64(len(xzData)))
+	if err != nil {
+		t.Fatalf("Info error %s", err)
+	}
+	for _, s := range info.Streams {
+		for i, b := range s.Blocks {
+			h, _, err := readBlockHeader(bytes.NewReader(
+				xzData[b.Offset:]))
+			if err != nil {
+				t.Fatalf("readBlockHeader error %s", err)
+			}
+			if h.compressedSize != b.CompressedSize ||
+				h.uncompressedSize != b.UncompressedSize {
+				t.Fatalf("block %d: header has sizes %d and %d;"+
+					" want %d and %d", i, h.compressedSize,
+					h.uncompressedSize, b.CompressedSize,
+					b.UncompressedSize)
+			}
+		}
+	}
+}
+
+func TestWriterBlockHeaderSizes(t *testing.T) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(59)), 30000)
+	txt := buf.Bytes()
+
+	var want []byte
+	for _, workers := range []int{1, 3} {
+		cfg := WriterConfig{BlockSize: 7000, BlockHeaderSizes: true,
+			Workers: workers}
+		var out bytes.Buffer
+		w, err := cfg.NewWriter(&out)
+		if err != nil {
+			t.Fatalf("NewWriter error %s", err)
+		}
+		if err = chunkWrite(w, txt, []int{1, 5000, 3000}); err != nil {
+			t.Fatalf("chunkWrite error %s", err)
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatalf("w.Flush error %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("w.Close error %s", err)
+		}
+		if workers == 1 {
+			want = out.Bytes()
+		} else if !bytes.Equal(out.Bytes(), want) {
+			t.Fatalf("output for workers %d differs", workers)
+		}
+	}
+	checkBlockHeaderSizes(t, want)
+	r, err := ReaderConfig{Workers: 2}.NewReader(onlyReader{
+		bytes.NewReader(want)})
+	if err != nil {
+		t.Fatalf("NewReader error %s", err)
+	}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll error %s", err)
+	}
+	if !bytes.Equal(p, txt) {
+		t.Fatalf("decompressed data differs")
+	}
+
+	// Unlimited blocks require an io.WriteSeeker.
+	cfg := WriterConfig{BlockHeaderSizes: true}
+	if _, err = cfg.NewWriter(&buf); err == nil {
+		t.Fatalf("NewWriter accepted unlimited blocks without seeking")
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "sizes.xz"))
+	if err != nil {
+		t.Fatalf("os.Create error %s", err)
+	}
+	defer f.Close()
+	w, err := cfg.NewWriter(f)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(txt[:10000]); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.EndBlock(); err != nil {
+		t.Fatalf("w.EndBlock error %s", err)
+	}
+	if _, err = w.Write(txt[10000:]); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	xzData, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("os.ReadFile error %s", err)
+	}
+	checkBlockHeaderSizes(t, xzData)
+	if p, err = decompress(xzData); err != nil {
+		t.Fatalf("decompress error %s", err)
+	}
+	if !bytes.Equal(p, txt) {
+		t.Fatalf("decompressed data of patched file differs")
+	}
+}
+
+// decompress decompresses the xz data sequentially.
+func decompress(xzData []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(xzData))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestReaderBlockHeaderSizes(t *testing.T) {
+	var buf bytes.Buffer
+	io.CopyN(&buf, randtxt.NewReader(rand.NewSource(61)), 10000)
+	cfg := WriterConfig{BlockSize: 4000, BlockHeaderSizes: true}
+	var out bytes.Buffer
+	w, err := cfg.NewWriter(&out)
+	if err != nil {
+		t.Fatalf("NewWriter error %s", err)
+	}
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		t.Fatalf("w.Write error %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("w.Close error %s", err)
+	}
+	xzData := out.Bytes()
+	// The first block header follows the stream header.
+	for _, d := range []struct{ c, u int64 }{{1, 0}, {-1, 0}, {0, 1},
+		{0, -1}} {
+		p := bytes.Clone(xzData)
+		h, hlen, err := readBlockHeader(bytes.NewReader(p[HeaderLen:]))
+		if err != nil {
+			t.Fatalf("readBlockHeader error %s", err)
+		}
+		h.compressedSize += d.c
+		h.uncompressedSize += d.u
+		data, err := h.marshalLen(hlen)
+		if err != nil {
+			t.Fatalf("marshalLen error %s", err)
+		}
+		if len(data) != hlen {
+			t.Fatalf("header length changed")
+		}
+		copy(p[HeaderLen:], data)
+		for _, workers := range []int{1, 2} {
+			r, err := ReaderConfig{Workers: workers}.NewReader(
+				bytes.NewReader(p))
+			if err != nil {
+				t.Fatalf("NewReader error %s", err)
+			}
+			_, err = io.ReadAll(r)
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("size change %v workers %d: got error"+
+					" %v; want %v", d, workers, err,
+					ErrCorrupt)
+			}
+		}
+	}
+}
+
+func TestWriterParsers(t *testing.T) {
+	data := blocksTestData()
+	greedy := compressXZ(t, WriterConfig{DictCap: 1 << 16,
+		BlockSize: 16000}, data)
+	parsers := []lzma.Parser{lzma.LazyParser, lzma.Lazy2Parser,
+		lzma.OptimalParser}
+	for _, p := range parsers {
+		for _, workers := range []int{1, 2} {
+			cfg := WriterConfig{DictCap: 1 << 16, BlockSize: 16000,
+				Parser: p, Workers: workers}
+			xzData := compressXZ(t, cfg, data)
+			out, err := decompress(xzData)
+			if err != nil {
+				t.Fatalf("decompress error %s", err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Fatalf("%s: workers %d: data differs", p,
+					workers)
+			}
+			if len(xzData) >= len(greedy) {
+				t.Fatalf("%s: workers %d: output %d not"+
+					" smaller than greedy parser output %d",
+					p, workers, len(xzData), len(greedy))
+			}
+		}
+	}
+	c := WriterConfig{Parser: 0xff}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Verify accepted unsupported parser")
+	}
+}
+
+func TestWriterMatcherLimits(t *testing.T) {
+	data := blocksTestData()
+	cfg := WriterConfig{DictCap: 1 << 16, Matcher: lzma.BT4,
+		Parser: lzma.OptimalParser, NiceLen: 32, Depth: 8,
+		MaxCandidates: 4}
+	out, err := decompress(compressXZ(t, cfg, data))
+	if err != nil {
+		t.Fatalf("decompress error %s", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("data differs")
+	}
+	c := WriterConfig{NiceLen: 300}
+	if err := c.Verify(); err == nil {
+		t.Fatalf("Verify accepted NiceLen 300")
+	}
+	c = WriterConfig{Preset: lzma.Preset6, Depth: 3}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify error %s", err)
+	}
+	if c.Depth != 3 || c.NiceLen == 0 {
+		t.Fatalf("NiceLen %d Depth %d after Verify", c.NiceLen,
+			c.Depth)
+	}
+}